@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"roar/internal/app"
+
+	"github.com/spf13/pflag"
+)
+
+func runCMP(args []string) {
+	if len(args) == 0 || args[0] != "generate" {
+		fmt.Fprintf(os.Stderr, "Usage: %s cmp generate [flags]\n", roar)
+		os.Exit(1)
+	}
+
+	flags := pflag.NewFlagSet("cmp generate", pflag.ExitOnError)
+	cfg := app.Config{}
+	flags.StringVarP(&cfg.LogLevel, "log-level", "l", "warn", "Log level (debug, info, warn, error)")
+	flags.StringVar(&cfg.LogFormat, "log-format", logFormatText, "Log format: text, json or logfmt")
+	flags.DurationVar(&cfg.RenderTimeout, "render-timeout", 2*time.Minute, "Timeout of the 'helm template' call (0 to disable)")
+	flags.BoolVar(&cfg.IgnoreMissingValues, "ignore-missing-values", false, "Skip WERF_VALUES_* files that do not exist instead of failing")
+	flags.BoolVar(&cfg.StrictValues, "strict-values", false, "Reject duplicate WERF_VALUES_* indices, warn on gaps and accept named suffixes like WERF_VALUES_PROD")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s cmp generate [flags]\n\n", roar)
+		fmt.Fprintf(os.Stderr, "Argo CD Config Management Plugin mode: renders the application in the current directory\n")
+		fmt.Fprintf(os.Stderr, "from ARGOCD_APP_* and ARGOCD_ENV_WERF_* variables and writes the manifests to stdout.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args[1:])
+	setupLogger(cfg.LogLevel, cfg.LogFormat)
+
+	dir, err := os.Getwd()
+	if err != nil {
+		exitOnError("Generate failed", err)
+	}
+
+	ctx, stop := signalContext()
+	err = app.GenerateCMP(ctx, cfg, dir, os.Environ(), os.Stdout)
+	stop()
+	if err != nil {
+		exitOnError("Generate failed", err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"roar/internal/app"
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/lock"
+	"roar/internal/pkg/logger"
+
+	"github.com/spf13/pflag"
+)
+
+func runExplain(args []string) {
+	flags := pflag.NewFlagSet("explain", pflag.ExitOnError)
+	cfg := app.Config{}
+
+	common := registerCommonFlags(flags, &cfg, argo.DuplicateWarn)
+	format := flags.String("format", "text", "Output format: text or json")
+	flags.StringVar(&cfg.LockFile, "lockfile", lock.DefaultFileName, "Path to the lock file, used with --locked")
+	flags.BoolVar(&cfg.Locked, "locked", false, "Clone the commit from the lock file, as a locked run would")
+	flags.BoolVar(&cfg.Submodules, "submodules", false, "Check out git submodules recursively")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s explain APP_NAME [CHART_PATH] [flags]\n\n", roar)
+		fmt.Fprintf(os.Stderr, "Shows how every Application with this name is resolved: its manifest, output path, where env, instance, repository and path come from,\n")
+		fmt.Fprintf(os.Stderr, "the mirror transformation, the clone URL and commit, and the 'helm template' command used to render it.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+	setupLogger(cfg.LogLevel, cfg.LogFormat)
+
+	if *format != "text" && *format != "json" {
+		exitOnError("Explain failed", fmt.Errorf("unsupported format '%s' (supported: text, json)", *format))
+	}
+	chartArgs := 1
+	if len(cfg.AppFiles) > 0 {
+		chartArgs = 0
+	}
+	if flags.NArg() != 1+chartArgs {
+		logger.Log.Error("Error: arguments APP_NAME and [CHART_PATH] (or --app-file) are required.")
+		flags.Usage()
+		os.Exit(1)
+	}
+	name := flags.Arg(0)
+	cfg.ChartPath = flags.Arg(chartArgs)
+	common.apply(&cfg)
+	if !cfg.Locked {
+		cfg.LockFile = ""
+	}
+
+	ctx, stop := signalContext()
+	explanations, err := app.Explain(ctx, cfg, name)
+	stop()
+	// Partial explanations are printed on error too, they show the failing step.
+	if len(explanations) > 0 {
+		if *format == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if encErr := encoder.Encode(explanations); encErr != nil && err == nil {
+				err = encErr
+			}
+		} else {
+			if len(explanations) > 1 {
+				fmt.Fprintf(os.Stdout, "Found %d Applications named '%s'.\n\n", len(explanations), name)
+			}
+			for i, explanation := range explanations {
+				if i > 0 {
+					fmt.Fprintln(os.Stdout)
+				}
+				writeExplanation(os.Stdout, explanation)
+			}
+		}
+	}
+	if err != nil {
+		exitOnError("Explain failed", err)
+	}
+}
+
+func writeExplanation(w io.Writer, e *app.Explanation) {
+	fmt.Fprintf(w, "Application: %s\n", e.Name)
+	fmt.Fprintf(w, "Template: %s\n", orDash(e.Source))
+	fmt.Fprintf(w, "Output: %s\n\n", e.OutputPath)
+	fmt.Fprintf(w, "Manifest:\n%s\n", indent(e.Manifest))
+	if e.Skipped != nil {
+		value := "<missing>"
+		if e.Skipped.Found {
+			value = fmt.Sprintf("'%s'", e.Skipped.Value)
+		}
+		fmt.Fprintf(w, "Skipped by filter %s (actual value %s), a run would not render it.\n\n", e.Skipped.Filter, value)
+	}
+
+	writeResolution(w, "Env", e.Env)
+	writeResolution(w, "Instance", e.Instance)
+	writeResolution(w, "Repository", e.RepoURL)
+	writeResolution(w, "Path", e.Path)
+
+	switch {
+	case e.Mirror != nil:
+		fmt.Fprintf(w, "Mirror:\n  repository: %s -> %s\n  path: %s -> %s\n\n", e.Mirror.FromRepoURL, e.Mirror.ToRepoURL, e.Mirror.FromPath, e.Mirror.ToPath)
+	default:
+		fmt.Fprintf(w, "Mirror: not applied\n\n")
+	}
+
+	if e.Override != "" {
+		fmt.Fprintf(w, "Source: local override %s\n", e.Override)
+	} else if e.CloneURL != "" {
+		fmt.Fprintf(w, "Source: %s (transport %s)\n", e.CloneURL, e.Transport)
+	}
+	fmt.Fprintf(w, "Revision: %s\n", e.TargetRevision)
+	if e.Commit != "" {
+		fmt.Fprintf(w, "Commit: %s (from %s)\n", e.Commit, e.CommitSource)
+	}
+	if len(e.HelmCommand) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nChart: %s\n", e.Helm.ChartPath)
+	fmt.Fprintf(w, "Release: %s\n", e.Helm.ReleaseName)
+	fmt.Fprintf(w, "Namespace: %s\n", orDash(e.Helm.Namespace))
+	fmt.Fprintf(w, "Values files:\n")
+	for _, file := range e.Helm.ValuesFiles {
+		fmt.Fprintf(w, "  %s\n", file)
+	}
+	keys := make([]string, 0, len(e.Helm.SetValues))
+	for key := range e.Helm.SetValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "Set values:\n")
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s=%s\n", key, e.Helm.SetValues[key])
+	}
+
+	quoted := make([]string, len(e.HelmCommand))
+	for i, arg := range e.HelmCommand {
+		quoted[i] = shellQuote(arg)
+	}
+	fmt.Fprintf(w, "\nHelm command:\n  %s\n", strings.Join(quoted, " "))
+}
+
+func writeResolution(w io.Writer, title string, r argo.FieldResolution) {
+	fmt.Fprintf(w, "%s:\n", title)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range r.Candidates {
+		value := "<missing>"
+		if c.Present {
+			value = fmt.Sprintf("'%s'", c.Value)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", c.Source, value)
+	}
+	tw.Flush()
+	if r.Source != "" {
+		fmt.Fprintf(w, "  => '%s' from %s\n\n", r.Value, r.Source)
+	} else {
+		fmt.Fprintf(w, "  => not set\n\n")
+	}
+}
+
+func indent(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "  " + line
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// shellQuote quotes an argument for a POSIX shell when it contains anything
+// but safe characters.
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@+") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
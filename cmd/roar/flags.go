@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"roar/internal/app"
+	"roar/internal/pkg/logger"
+
+	"github.com/spf13/pflag"
+)
+
+// commonFlags holds flags shared by all commands that are not stored in app.Config directly.
+type commonFlags struct {
+	configPath    string
+	repoOverrides []string
+	gitTransport  string
+	netrcFile     string
+}
+
+// registerCommonFlags adds flags describing the app-of-apps chart and how its
+// applications are selected and fetched. onDuplicate is the default of
+// --on-duplicate: commands that only read the applications should not fail on
+// duplicates a render would reject.
+func registerCommonFlags(flags *pflag.FlagSet, cfg *app.Config, onDuplicate string) *commonFlags {
+	common := &commonFlags{}
+
+	flags.StringSliceVarP(&cfg.ValuesFiles, "values", "f", []string{}, "Path to a values file for the app-of-apps chart (can be repeated)")
+	flags.StringVarP(&cfg.LogLevel, "log-level", "l", "warn", "Log level (debug, info, warn, error)")
+	flags.StringVar(&cfg.LogFormat, "log-format", logFormatText, "Log format: text (colored on a terminal unless NO_COLOR is set), json or logfmt")
+
+	// Используем StringSliceVar для поддержки множественных флагов
+	// Пример: --filter "a==b" --filter "c!=d"
+	flags.StringSliceVar(&cfg.Filters, "filter", []string{}, "Filter applications by field (e.g. spec.source.targetRevision==master). Can be repeated.")
+
+	flags.StringArrayVar(&cfg.AppFiles, "app-file", []string{}, "Read Application manifests from this file ('-' for stdin) instead of rendering CHART_PATH. Can be repeated.")
+
+	flags.StringVar(&cfg.OnDuplicate, "on-duplicate", onDuplicate, "What to do with Applications sharing an output path (env/instance/name): error, warn or suffix (write the latter to <name>-2, ...)")
+
+	flags.BoolVarP(&cfg.Mirror, "mirror", "m", false, "Enable mirror URL transformation (temporary workaround)")
+
+	flags.StringVarP(&common.configPath, "config", "c", "", "Path to a roar config file (YAML)")
+	flags.StringArrayVar(&common.repoOverrides, "repo-override", []string{}, "Use a local directory instead of cloning a repository: <repoURL>=<local dir>. Can be repeated.")
+	flags.StringVar(&common.gitTransport, "git-transport", "", "Default git transport for all hosts: ssh or https (default ssh, per-host settings in --config)")
+	flags.StringVar(&common.netrcFile, "netrc-file", "", "Path to a netrc file with credentials for https transport (default $NETRC or ~/.netrc)")
+
+	flags.DurationVar(&cfg.CloneTimeout, "clone-timeout", 5*time.Minute, "Timeout of a single git clone or ls-remote attempt (0 to disable)")
+	flags.IntVar(&cfg.CloneRetries, "clone-retries", 2, "Number of retries with exponential backoff for git operations failing with a transient network error")
+	flags.DurationVar(&cfg.RenderTimeout, "render-timeout", 2*time.Minute, "Timeout of a single 'helm template' call (0 to disable)")
+	flags.BoolVar(&cfg.IgnoreMissingValues, "ignore-missing-values", false, "Skip WERF_VALUES_* files that do not exist instead of failing the application")
+	flags.BoolVar(&cfg.StrictValues, "strict-values", false, "Reject duplicate WERF_VALUES_* indices, warn on gaps and accept named suffixes like WERF_VALUES_PROD")
+
+	return common
+}
+
+// apply merges the config file and command-line overrides into cfg.
+// Command-line values take precedence over the config file.
+func (c *commonFlags) apply(cfg *app.Config) {
+	cfg.RepoOverrides = make(map[string]string)
+	if c.configPath != "" {
+		fileCfg, err := app.LoadFileConfig(c.configPath)
+		if err != nil {
+			logger.Log.Fatalf("Failed to load config: %v", err)
+		}
+		for repoURL, dir := range fileCfg.RepoOverrides {
+			cfg.RepoOverrides[repoURL] = dir
+		}
+		cfg.Git = fileCfg.Git
+	}
+	if c.gitTransport != "" {
+		cfg.Git.Transport = c.gitTransport
+	}
+	if c.netrcFile != "" {
+		cfg.Git.NetrcFile = c.netrcFile
+	}
+	for _, override := range c.repoOverrides {
+		repoURL, dir, err := app.ParseRepoOverride(override)
+		if err != nil {
+			logger.Log.Fatal(err)
+		}
+		cfg.RepoOverrides[repoURL] = dir
+	}
+}
+
+func setupLogger(level, format string) {
+	logger.InitLogger()
+	logger.Log.SetLevel(logger.ParseLogLevel(level))
+	formatter, err := newFormatter(format, os.Stderr)
+	if err != nil {
+		logger.Log.SetFormatter(&CustomFormatter{DisableColors: true})
+		exitOnError("Invalid flags", err)
+	}
+	logger.Log.SetFormatter(formatter)
+}
+
+// requireChartPath returns the single positional CHART_PATH argument or exits
+// with usage. With --app-file the chart is not rendered and no argument is allowed.
+func requireChartPath(flags *pflag.FlagSet, cfg *app.Config) string {
+	args := flags.Args()
+	if len(cfg.AppFiles) > 0 {
+		if len(args) != 0 {
+			logger.Log.Error("Error: [CHART_PATH] cannot be used together with --app-file.")
+			flags.Usage()
+			os.Exit(1)
+		}
+		return ""
+	}
+	if len(args) != 1 {
+		logger.Log.Error("Error: exactly one argument [CHART_PATH] or --app-file is required.")
+		flags.Usage()
+		os.Exit(1)
+	}
+	return args[0]
+}
+
+// exitCodeInterrupted is the conventional exit code of a process stopped by SIGINT.
+const exitCodeInterrupted = 130
+
+// signalContext returns a context that is canceled on SIGINT or SIGTERM, so
+// running clones and renders are aborted and temporary files are cleaned up.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// exitOnError logs a fatal error and exits, using exit code 130 when the
+// command was interrupted by a signal.
+func exitOnError(prefix string, err error) {
+	if errors.Is(err, context.Canceled) {
+		logger.Log.Errorf("%s: %v", prefix, err)
+		os.Exit(exitCodeInterrupted)
+	}
+	logger.Log.Fatalf("%s: %v", prefix, err)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"sort"
 	"strings"
 
@@ -18,7 +19,40 @@ const (
 	colorReset  = "\033[0m"
 )
 
-type CustomFormatter struct{}
+// Log formats selected with --log-format.
+const (
+	logFormatText   = "text"
+	logFormatJSON   = "json"
+	logFormatLogfmt = "logfmt"
+)
+
+const timestampFormat = "2006-01-02T15:04:05-07:00"
+
+// newFormatter returns the formatter for --log-format. Colors of the text
+// format are used only when out is a terminal and NO_COLOR is not set.
+func newFormatter(format string, out *os.File) (logrus.Formatter, error) {
+	switch format {
+	case logFormatText, "":
+		return &CustomFormatter{DisableColors: os.Getenv("NO_COLOR") != "" || !isTerminal(out)}, nil
+	case logFormatJSON:
+		return &logrus.JSONFormatter{TimestampFormat: timestampFormat}, nil
+	case logFormatLogfmt:
+		return &logrus.TextFormatter{DisableColors: true, FullTimestamp: true, TimestampFormat: timestampFormat, QuoteEmptyFields: true}, nil
+	default:
+		return nil, fmt.Errorf("unsupported log format '%s' (supported: %s, %s, %s)", format, logFormatText, logFormatJSON, logFormatLogfmt)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// CustomFormatter is the human-readable text format: timestamp, level,
+// message and sorted key=value fields.
+type CustomFormatter struct {
+	DisableColors bool
+}
 
 func (f *CustomFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	var b *bytes.Buffer
@@ -28,11 +62,14 @@ func (f *CustomFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 		b = &bytes.Buffer{}
 	}
 
-	timestamp := entry.Time.Format("2006-01-02T15:04:05-07:00")
+	timestamp := entry.Time.Format(timestampFormat)
 	levelText := strings.ToUpper(entry.Level.String())
-	levelColor := getColorByLevel(entry.Level)
+	levelColor, fieldColor, reset := getColorByLevel(entry.Level), colorBlue, colorReset
+	if f.DisableColors {
+		levelColor, fieldColor, reset = "", "", ""
+	}
 
-	fmt.Fprintf(b, "%s %s%s%s %s", timestamp, levelColor, levelText, colorReset, entry.Message)
+	fmt.Fprintf(b, "%s %s%s%s %s", timestamp, levelColor, levelText, reset, entry.Message)
 
 	if len(entry.Data) > 0 {
 		b.WriteString(" ")
@@ -42,7 +79,7 @@ func (f *CustomFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 		}
 		sort.Strings(keys)
 		for _, k := range keys {
-			fmt.Fprintf(b, "%s%s=%v%s ", colorBlue, k, entry.Data[k], colorReset)
+			fmt.Fprintf(b, "%s%s=%v%s ", fieldColor, k, entry.Data[k], reset)
 		}
 	}
 
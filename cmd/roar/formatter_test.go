@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func tempFile(t *testing.T) *os.File {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func pipeWriter(t *testing.T) *os.File {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+	return w
+}
+
+// formatEntry formats an application log entry with the given formatter.
+func formatEntry(t *testing.T, formatter logrus.Formatter) string {
+	t.Helper()
+	log := logrus.New()
+	entry := logrus.NewEntry(log).WithFields(logrus.Fields{
+		"application": "web",
+		"repo":        "https://git.example.com/org/web.git",
+		"revision":    "main",
+	})
+	entry.Time = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	entry.Level = logrus.InfoLevel
+	entry.Message = "Rendered application"
+	out, err := formatter.Format(entry)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestNewFormatter(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	out := tempFile(t)
+
+	tests := []struct {
+		format string
+		want   logrus.Formatter
+	}{
+		{format: "", want: &CustomFormatter{}},
+		{format: logFormatText, want: &CustomFormatter{}},
+		{format: logFormatJSON, want: &logrus.JSONFormatter{}},
+		{format: logFormatLogfmt, want: &logrus.TextFormatter{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			formatter, err := newFormatter(tt.format, out)
+			require.NoError(t, err)
+			require.IsType(t, tt.want, formatter)
+		})
+	}
+}
+
+func TestNewFormatter_UnknownFormat(t *testing.T) {
+	_, err := newFormatter("xml", tempFile(t))
+	require.EqualError(t, err, "unsupported log format 'xml' (supported: text, json, logfmt)")
+}
+
+func TestNewFormatter_Colors(t *testing.T) {
+	tests := []struct {
+		name    string
+		noColor string
+		out     func(t *testing.T) *os.File
+	}{
+		{name: "file", out: tempFile},
+		{name: "pipe", out: pipeWriter},
+		{name: "NO_COLOR", noColor: "1", out: tempFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			formatter, err := newFormatter(logFormatText, tt.out(t))
+			require.NoError(t, err)
+			require.True(t, formatter.(*CustomFormatter).DisableColors)
+
+			line := formatEntry(t, formatter)
+			require.NotContains(t, line, "\033[")
+			require.Equal(t, "2024-05-01T10:00:00+00:00 INFO Rendered application application=web repo=https://git.example.com/org/web.git revision=main \n", line)
+		})
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	require.False(t, isTerminal(tempFile(t)))
+	require.False(t, isTerminal(pipeWriter(t)))
+}
+
+func TestNewFormatter_StructuredFields(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		formatter, err := newFormatter(logFormatJSON, tempFile(t))
+		require.NoError(t, err)
+
+		var fields map[string]string
+		require.NoError(t, json.Unmarshal([]byte(formatEntry(t, formatter)), &fields))
+		require.Equal(t, map[string]string{
+			"application": "web",
+			"repo":        "https://git.example.com/org/web.git",
+			"revision":    "main",
+			"level":       "info",
+			"msg":         "Rendered application",
+			"time":        "2024-05-01T10:00:00+00:00",
+		}, fields)
+	})
+
+	t.Run("logfmt", func(t *testing.T) {
+		formatter, err := newFormatter(logFormatLogfmt, tempFile(t))
+		require.NoError(t, err)
+
+		line := formatEntry(t, formatter)
+		require.Equal(t, `time="2024-05-01T10:00:00+00:00" level=info msg="Rendered application" application=web repo="https://git.example.com/org/web.git" revision=main`+"\n", line)
+		require.NotContains(t, line, "\033[")
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"roar/internal/app"
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/lock"
+
+	"github.com/spf13/pflag"
+)
+
+func runImages(args []string) {
+	flags := pflag.NewFlagSet("images", pflag.ExitOnError)
+	cfg := app.Config{}
+
+	common := registerCommonFlags(flags, &cfg, argo.DuplicateError)
+	fromDir := flags.String("from-dir", "", "Read manifests rendered earlier into this directory instead of rendering (CHART_PATH is not needed)")
+	format := flags.String("format", "table", "Output format: table or json")
+	unpinned := flags.Bool("unpinned", false, "List only images that are not pinned by digest")
+	flags.StringVar(&cfg.LockFile, "lockfile", lock.DefaultFileName, "Path to the lock file used with --locked")
+	flags.BoolVar(&cfg.Locked, "locked", false, "Clone exactly the commits from the lock file")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s images [CHART_PATH] [flags]\n", roar)
+		fmt.Fprintf(os.Stderr, "       %s images --from-dir DIR [flags]\n\n", roar)
+		fmt.Fprintf(os.Stderr, "Lists container images used by every application, grouped by env, instance and application.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+	setupLogger(cfg.LogLevel, cfg.LogFormat)
+
+	if *format != "table" && *format != "json" {
+		exitOnError("Images failed", fmt.Errorf("unsupported format '%s' (supported: table, json)", *format))
+	}
+
+	var result []app.ApplicationImages
+	var err error
+	if *fromDir != "" {
+		result, err = app.ImagesFromDir(*fromDir)
+	} else {
+		cfg.ChartPath = requireChartPath(flags, &cfg)
+		common.apply(&cfg)
+		if !cfg.Locked {
+			// Инвентаризация не должна переписывать lock-файл
+			cfg.LockFile = ""
+		}
+		ctx, stop := signalContext()
+		result, err = app.Images(ctx, cfg)
+		stop()
+	}
+	if err != nil {
+		exitOnError("Images failed", err)
+	}
+
+	if *unpinned {
+		result = filterUnpinned(result)
+	}
+	if *format == "json" {
+		err = writeImagesJSON(os.Stdout, result)
+	} else {
+		err = writeImagesTable(os.Stdout, result)
+	}
+	if err != nil {
+		exitOnError("Images failed", err)
+	}
+}
+
+// filterUnpinned keeps only images referenced by tag without a digest.
+func filterUnpinned(list []app.ApplicationImages) []app.ApplicationImages {
+	var filtered []app.ApplicationImages
+	for _, appImages := range list {
+		var kept []app.ImageEntry
+		for _, image := range appImages.Images {
+			if !image.Pinned {
+				kept = append(kept, image)
+			}
+		}
+		if len(kept) > 0 {
+			appImages.Images = kept
+			filtered = append(filtered, appImages)
+		}
+	}
+	return filtered
+}
+
+func writeImagesJSON(w io.Writer, list []app.ApplicationImages) error {
+	if list == nil {
+		list = []app.ApplicationImages{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(list)
+}
+
+func writeImagesTable(w io.Writer, list []app.ApplicationImages) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENV\tINSTANCE\tAPPLICATION\tIMAGE\tTAG\tDIGEST\tPINNED")
+	for _, appImages := range list {
+		for _, image := range appImages.Images {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%t\n",
+				orDash(appImages.Env), orDash(appImages.Instance), appImages.Application,
+				image.Repository, orDash(image.Tag), orDash(image.Digest), image.Pinned)
+		}
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
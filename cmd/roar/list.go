@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"roar/internal/app"
+	"roar/internal/pkg/argo"
+
+	"github.com/spf13/pflag"
+)
+
+func runList(args []string) {
+	flags := pflag.NewFlagSet("list", pflag.ExitOnError)
+	cfg := app.Config{}
+
+	common := registerCommonFlags(flags, &cfg, argo.DuplicateWarn)
+	format := flags.String("format", "table", "Output format: table or json")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s list [CHART_PATH] [flags]\n\n", roar)
+		fmt.Fprintf(os.Stderr, "Renders only the app-of-apps chart and lists the parsed Applications and the ones skipped by filters.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+	setupLogger(cfg.LogLevel, cfg.LogFormat)
+
+	if *format != "table" && *format != "json" {
+		exitOnError("List failed", fmt.Errorf("unsupported format '%s' (supported: table, json)", *format))
+	}
+
+	cfg.ChartPath = requireChartPath(flags, &cfg)
+	common.apply(&cfg)
+
+	ctx, stop := signalContext()
+	result, err := app.List(ctx, cfg)
+	stop()
+	if err != nil {
+		exitOnError("List failed", err)
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(result)
+	} else {
+		err = writeListTable(os.Stdout, result)
+	}
+	if err != nil {
+		exitOnError("List failed", err)
+	}
+}
+
+func writeListTable(w io.Writer, result *app.ListResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tENV\tINSTANCE\tREPO\tPATH\tREVISION\tSETTERS\tVALUES\tSOURCE")
+	for _, a := range result.Applications {
+		values := strings.Join(a.ValuesFiles, ",")
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			a.Name, orDash(a.Env), orDash(a.Instance), a.RepoURL, a.Path, a.TargetRevision, a.SetterCount, orDash(values), orDash(a.Source))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(result.Skipped) == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "\nSkipped by filters:\n")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tFILTER\tACTUAL VALUE\tSOURCE")
+	for _, s := range result.Skipped {
+		value := "<missing>"
+		if s.Found {
+			value = fmt.Sprintf("'%s'", s.Value)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, s.Filter, value, orDash(s.Source))
+	}
+	return tw.Flush()
+}
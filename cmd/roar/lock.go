@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"roar/internal/app"
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/lock"
+
+	"github.com/spf13/pflag"
+)
+
+func runLock(args []string) {
+	if len(args) == 0 || args[0] != "update" {
+		fmt.Fprintf(os.Stderr, "Usage: %s lock update [CHART_PATH] [flags]\n", roar)
+		os.Exit(1)
+	}
+
+	flags := pflag.NewFlagSet("lock update", pflag.ExitOnError)
+	cfg := app.Config{}
+
+	common := registerCommonFlags(flags, &cfg, argo.DuplicateError)
+	flags.StringVar(&cfg.LockFile, "lockfile", lock.DefaultFileName, "Path to the lock file to write")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s lock update [CHART_PATH] [flags]\n\n", roar)
+		fmt.Fprintf(os.Stderr, "Resolves the revision of every application repository to a commit and rewrites the lock file.\n\n")
+		fmt.Fprintf(os.Stderr, "Arguments:\n")
+		fmt.Fprintf(os.Stderr, "  CHART_PATH   Path to the app-of-apps Helm chart (required unless --app-file is given)\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args[1:])
+
+	setupLogger(cfg.LogLevel, cfg.LogFormat)
+	cfg.ChartPath = requireChartPath(flags, &cfg)
+	common.apply(&cfg)
+
+	ctx, stop := signalContext()
+	err := app.UpdateLock(ctx, cfg)
+	stop()
+	if err != nil {
+		exitOnError("Lock update failed", err)
+	}
+}
@@ -3,63 +3,146 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"roar/internal/app"
-	"roar/internal/pkg/logger"
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/lock"
+	"roar/internal/pkg/output"
+	"roar/internal/pkg/validate"
 
 	"github.com/spf13/pflag"
 )
 
 var version = "dev"
 
+const roar = "roar"
+
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "lock":
+			runLock(args[1:])
+			return
+		case "images":
+			runImages(args[1:])
+			return
+		case "list":
+			runList(args[1:])
+			return
+		case "explain":
+			runExplain(args[1:])
+			return
+		case "cmp":
+			runCMP(args[1:])
+			return
+		case "serve":
+			runServe(args[1:])
+			return
+		}
+	}
+	runRender(args)
+}
 
-	versionFlag := pflag.BoolP("version", "v", false, "Print version information and exit")
-	cfg := app.Config{}
-	
-	pflag.StringSliceVarP(&cfg.ValuesFiles, "values", "f", []string{}, "Path to a values file for the app-of-apps chart (can be repeated)")
-	pflag.StringVarP(&cfg.OutputDir, "output-dir", "o", "rendered", "Directory to save rendered manifests")
-	pflag.StringVarP(&cfg.LogLevel, "log-level", "l", "warn", "Log level (debug, info, warn, error)")
-	
-	// Используем StringSliceVar для поддержки множественных флагов
-	// Пример: --filter "a==b" --filter "c!=d"
-	pflag.StringSliceVar(&cfg.Filters, "filter", []string{}, "Filter applications by field (e.g. spec.source.targetRevision==master). Can be repeated.")
+// Default output targets of a render: a directory, or an archive file with
+// --output-archive.
+const (
+	defaultOutputDir     = "rendered"
+	defaultOutputArchive = "rendered.tar"
+)
 
-	pflag.BoolVarP(&cfg.Mirror, "mirror", "m", false, "Enable mirror URL transformation (temporary workaround)")
+func runRender(args []string) {
+	flags := pflag.NewFlagSet(roar, pflag.ExitOnError)
 
-	roar := "roar"
+	versionFlag := flags.BoolP("version", "v", false, "Print version information and exit")
+	cfg := app.Config{}
 
-	pflag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [CHART_PATH] [flags]\n\n", roar)
+	common := registerCommonFlags(flags, &cfg, argo.DuplicateError)
+	flags.StringVarP(&cfg.OutputDir, "output-dir", "o", defaultOutputDir, "Directory to save rendered manifests, archive path with --output-archive ("+defaultOutputArchive+" if not set), or '-' for stdout (alias --output)")
+	flags.StringVar(&cfg.OutputFormat, "output-format", output.FormatYAML, "Manifest format: "+strings.Join(output.Formats, ", ")+", or tar (yaml in an archive, same as --output-archive)")
+	flags.BoolVar(&cfg.OutputArchive, "output-archive", false, "Write a tar archive with the output directory layout")
+	flags.SetNormalizeFunc(outputAlias)
+	flags.StringVar(&cfg.LockFile, "lockfile", "", "Record resolved commits in this lock file (default none; with --locked the file to clone from, "+lock.DefaultFileName+" if not set)")
+	flags.BoolVar(&cfg.Locked, "locked", false, "Clone exactly the commits from the lock file and fail on repositories missing from it")
+	flags.BoolVar(&cfg.Sparse, "sparse", false, "Check out only the service paths and values file directories used by the applications")
+	flags.BoolVar(&cfg.Submodules, "submodules", false, "Check out git submodules recursively")
+	flags.StringVar(&cfg.LFSObjectsDir, "lfs-objects-dir", "", "Local Git LFS object store (layout of .git/lfs/objects) used to replace LFS pointer files")
+	flags.BoolVar(&cfg.Force, "force", false, "Re-render every application, ignoring the render cache in the output directory")
+	flags.StringVar(&cfg.ReportFile, "report", "", "Write a JSON report with the status of every application to this file")
+	flags.BoolVar(&cfg.Validate, "validate", false, "Validate rendered resources against Kubernetes JSON schemas from --schema-dir and rendered CRDs")
+	flags.BoolVar(&cfg.CheckDeprecations, "check-deprecations", false, "Report resources whose API versions are deprecated or removed in --kube-version")
+	flags.StringVar(&cfg.KubeVersion, "kube-version", validate.DefaultKubeVersion, "Target Kubernetes version for --validate and --check-deprecations (e.g. 1.29.0, master is the newest)")
+	flags.StringArrayVar(&cfg.PolicyFiles, "policy", []string{}, "Path to a YAML file with policy rules for rendered resources. Can be repeated.")
+	flags.StringVar(&cfg.SchemaDir, "schema-dir", "", "Directory with Kubernetes JSON schemas in the kubernetes-json-schema layout")
+	watch := flags.Bool("watch", false, "Keep running and re-render the applications affected by changes in CHART_PATH, values files, --app-file files and --repo-override directories")
+	watchInterval := flags.Duration("watch-interval", time.Second, "How often --watch polls the watched files for changes when filesystem notifications are unavailable")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [CHART_PATH] [flags]\n", roar)
+		fmt.Fprintf(os.Stderr, "       %s --app-file FILE [flags]\n", roar)
+		fmt.Fprintf(os.Stderr, "       %s lock update [CHART_PATH] [flags]\n", roar)
+		fmt.Fprintf(os.Stderr, "       %s images [CHART_PATH] [flags]\n", roar)
+		fmt.Fprintf(os.Stderr, "       %s list [CHART_PATH] [flags]\n", roar)
+		fmt.Fprintf(os.Stderr, "       %s explain APP_NAME [CHART_PATH] [flags]\n", roar)
+		fmt.Fprintf(os.Stderr, "       %s cmp generate [flags]\n", roar)
+		fmt.Fprintf(os.Stderr, "       %s serve [CHART_PATH] [flags]\n\n", roar)
 		fmt.Fprintf(os.Stderr, "Arguments:\n")
-		fmt.Fprintf(os.Stderr, "  CHART_PATH   Path to the app-of-apps Helm chart (required)\n\n")
+		fmt.Fprintf(os.Stderr, "  CHART_PATH   Path to the app-of-apps Helm chart (required unless --app-file is given)\n\n")
 		fmt.Fprintf(os.Stderr, "Flags:\n")
-		pflag.PrintDefaults()
+		flags.PrintDefaults()
 	}
 
-	pflag.Parse()
+	flags.Parse(args)
 
-	logger.InitLogger()
-	logger.Log.SetLevel(logger.ParseLogLevel(cfg.LogLevel))
-	logger.Log.SetFormatter(&CustomFormatter{})
+	setupLogger(cfg.LogLevel, cfg.LogFormat)
 
 	if *versionFlag {
 		fmt.Printf("roar version: %s\n", version)
 		return
 	}
 
-	args := pflag.Args()
-
-	if len(args) != 1 {
-		logger.Log.Error("Error: exactly one argument [CHART_PATH] is required.")
-		pflag.Usage()
-		os.Exit(1)
+	if cfg.OutputFormat == output.FormatTar {
+		cfg.OutputFormat = output.FormatYAML
+		cfg.OutputArchive = true
+	}
+	// The default directory name would become an extensionless archive file.
+	if cfg.OutputArchive && !flags.Changed("output-dir") {
+		cfg.OutputDir = defaultOutputArchive
 	}
 
-	cfg.ChartPath = args[0]
+	// A plain render records commits only into an explicitly given lock file;
+	// use 'roar lock update' to maintain roar.lock.
+	if cfg.Locked && cfg.LockFile == "" {
+		cfg.LockFile = lock.DefaultFileName
+	}
 
-	if err := app.Run(cfg); err != nil {
-		logger.Log.Fatalf("Application failed: %v", err)
+	cfg.ChartPath = requireChartPath(flags, &cfg)
+	common.apply(&cfg)
+
+	ctx, stop := signalContext()
+	var err error
+	if *watch {
+		// The change summary goes to stderr when the manifests are written to stdout.
+		out := os.Stdout
+		if cfg.OutputDir == output.Stdout {
+			out = os.Stderr
+		}
+		err = app.Watch(ctx, cfg, app.WatchOptions{PollInterval: *watchInterval, Out: out})
+	} else {
+		err = app.Run(ctx, cfg)
+	}
+	stop()
+	if err != nil {
+		exitOnError("Application failed", err)
 	}
 }
 
+// outputAlias makes --output an alias of --output-dir.
+func outputAlias(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if name == "output" {
+		name = "output-dir"
+	}
+	return pflag.NormalizedName(name)
+}
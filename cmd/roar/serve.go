@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"roar/internal/app"
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/lock"
+	"roar/internal/pkg/logger"
+
+	"github.com/spf13/pflag"
+)
+
+// shutdownTimeout is how long running requests may finish after a signal.
+const shutdownTimeout = 30 * time.Second
+
+func runServe(args []string) {
+	flags := pflag.NewFlagSet("serve", pflag.ExitOnError)
+	cfg := app.Config{}
+	opts := app.ServeOptions{}
+
+	common := registerCommonFlags(flags, &cfg, argo.DuplicateWarn)
+	listen := flags.String("listen", ":8080", "Address to listen on")
+	flags.DurationVar(&opts.RequestTimeout, "request-timeout", 5*time.Minute, "Timeout of a single request, including clones and renders (0 to disable)")
+	flags.IntVar(&opts.MaxConcurrent, "max-concurrent", 4, "Number of requests served at the same time")
+	flags.DurationVar(&opts.CloneTTL, "clone-ttl", 5*time.Minute, "How long a clone is reused before the repository is cloned again to pick up new commits (0 to keep clones until exit)")
+	flags.IntVar(&opts.MaxClones, "max-clones", 100, "Number of clones kept on disk, the least recently used are removed first (0 for no limit)")
+	flags.StringArrayVar(&opts.AllowedHosts, "allowed-host", []string{}, "Git host that POST /render may clone from. Can be repeated (default any remote host; local paths are always rejected)")
+	flags.StringVar(&cfg.LockFile, "lockfile", lock.DefaultFileName, "Path to the lock file, used with --locked")
+	flags.BoolVar(&cfg.Locked, "locked", false, "Clone exactly the commits from the lock file and fail on repositories missing from it")
+	flags.BoolVar(&cfg.Submodules, "submodules", false, "Check out git submodules recursively")
+	flags.StringVar(&cfg.LFSObjectsDir, "lfs-objects-dir", "", "Local Git LFS object store (layout of .git/lfs/objects) used to replace LFS pointer files")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [CHART_PATH] [flags]\n\n", roar)
+		fmt.Fprintf(os.Stderr, "Serves rendering over HTTP:\n")
+		fmt.Fprintf(os.Stderr, "  POST /render                 render the Application manifests in the request body\n")
+		fmt.Fprintf(os.Stderr, "  GET  /apps                   list the Applications of the app-of-apps chart\n")
+		fmt.Fprintf(os.Stderr, "  GET  /apps/{name}/manifest   render a single Application of the app-of-apps chart\n")
+		fmt.Fprintf(os.Stderr, "Manifests are returned in the format given by the 'format' query parameter (default yaml).\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+	setupLogger(cfg.LogLevel, cfg.LogFormat)
+
+	cfg.ChartPath = requireChartPath(flags, &cfg)
+	common.apply(&cfg)
+
+	server, err := app.NewServer(cfg, opts)
+	if err != nil {
+		exitOnError("Serve failed", err)
+	}
+	defer server.Close()
+
+	httpServer := &http.Server{Addr: *listen, Handler: server, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signalContext()
+	defer stop()
+	// ListenAndServe returns as soon as Shutdown starts; wait for running requests.
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		logger.Log.Info("Shutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Errorf("Shutdown failed: %v", err)
+		}
+	}()
+
+	logger.Log.Infof("Listening on %s", *listen)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		server.Close()
+		exitOnError("Serve failed", err)
+	}
+	<-shutdownDone
+}
@@ -3,6 +3,7 @@ module roar
 go 1.24.4
 
 require (
+	github.com/fsnotify/fsnotify v1.10.1
 	github.com/go-git/go-git/v5 v5.16.2
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/pflag v1.0.10
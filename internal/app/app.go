@@ -1,39 +1,158 @@
 package app
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"roar/internal/pkg/argo"
+	"roar/internal/pkg/deprecation"
 	"roar/internal/pkg/git"
 	"roar/internal/pkg/helm"
+	"roar/internal/pkg/lock"
 	"roar/internal/pkg/logger"
+	"roar/internal/pkg/output"
+	"roar/internal/pkg/policy"
+	"roar/internal/pkg/validate"
+	"roar/internal/pkg/werf"
+
+	"github.com/sirupsen/logrus"
 )
 
 type Config struct {
 	ChartPath   string
 	ValuesFiles []string
-	OutputDir   string
-	LogLevel    string
-	Filters     []string
+	// AppFiles are Application manifest files used instead of rendering the
+	// app-of-apps chart; "-" reads stdin.
+	AppFiles []string
+	// OutputDir is the directory for rendered manifests, the archive path
+	// with OutputArchive or "-" for stdout.
+	OutputDir string
+	// OutputFormat is one of output.Formats; empty means yaml as rendered.
+	OutputFormat string
+	// OutputArchive writes a tar archive with the output directory layout.
+	OutputArchive bool
+	LogLevel      string
+	// LogFormat is the log output format: text, json or logfmt.
+	LogFormat string
+	Filters   []string
+	// OnDuplicate is what to do with Applications sharing an output path: one of
+	// argo.DuplicateError (the default), argo.DuplicateWarn or argo.DuplicateSuffix.
+	OnDuplicate string
 	Mirror      bool
+	// RepoOverrides maps a repository URL to a local directory that is used
+	// as-is instead of cloning the repository.
+	RepoOverrides map[string]string
+	// LockFile is the path of the lock file with resolved commits. When empty,
+	// commits are neither recorded nor enforced.
+	LockFile string
+	// Locked makes Run clone exactly the commits from LockFile and fail on
+	// repositories that are not in it.
+	Locked bool
+	// Git selects the transport and credentials per git host.
+	Git git.Credentials
+	// Sparse checks out only the directories needed by the applications
+	// that share a repository and revision.
+	Sparse bool
+	// Submodules checks out git submodules recursively, applying the same
+	// transport and credentials rules to their URLs.
+	Submodules bool
+	// LFSObjectsDir is a local Git LFS object store used to replace LFS
+	// pointer files; without it a pointer file fails the application.
+	LFSObjectsDir string
+	// CloneTimeout limits a single clone attempt; zero means no limit.
+	CloneTimeout time.Duration
+	// CloneRetries is the number of additional attempts for clones that
+	// fail with a transient network error.
+	CloneRetries int
+	// RenderTimeout limits a single 'helm template' call; zero means no limit.
+	RenderTimeout time.Duration
+	// IgnoreMissingValues skips WERF_VALUES_* files that do not exist, like
+	// optional values files in werf, instead of failing the application.
+	IgnoreMissingValues bool
+	// StrictValues rejects duplicate WERF_VALUES_* indices, warns on gaps in
+	// them and accepts werf-style named suffixes such as WERF_VALUES_PROD.
+	StrictValues bool
+	// Force re-renders every application, ignoring the render cache kept in
+	// the output directory.
+	Force bool
+	// ReportFile is the path of the JSON run report. The report is written
+	// even when the run fails or is interrupted.
+	ReportFile string
+	// Validate checks rendered resources against Kubernetes JSON schemas
+	// from SchemaDir for KubeVersion and CRD schemas from rendered CRDs.
+	Validate  bool
+	SchemaDir string
+	// CheckDeprecations reports resources whose API versions are deprecated
+	// or removed in KubeVersion.
+	CheckDeprecations bool
+	// KubeVersion is the target Kubernetes version of the checks, e.g.
+	// "1.29.0"; "master" means the newest version.
+	KubeVersion string
+	// PolicyFiles are YAML files with policy rules checked against every
+	// rendered resource. Violations of severity error fail the run.
+	PolicyFiles []string
 	tempDir_    string
 }
 
+// retryBackoff is the pause before the first retry of a failed clone; it
+// doubles with every further attempt.
+const retryBackoff = 2 * time.Second
+
 type appState struct {
-	tempDir      string
-	outputDir    string
-	clonedRepos  map[string]string
-	cloneCounter int
-	mirror       bool
+	clones     *cloneCache
+	output     output.Writer
+	cache      *renderCache
+	mirror     bool
+	overrides  map[string]string
+	lock       *lock.File
+	locked     bool
+	creds      *git.Credentials
+	sparseDirs map[string][]string
+	submodules bool
+	lfsDir     string
+	retry      git.RetryPolicy
+	renderTime time.Duration
+
+	// ignoreMissingValues drops missing values files instead of failing.
+	ignoreMissingValues bool
+	// confined renders applications from untrusted sources, see
+	// renderOptionsFor.
+	confined bool
+}
+
+// Run renders all selected applications. Canceling ctx stops the run after
+// the current clone or render is aborted; the error then wraps context.Canceled.
+func Run(ctx context.Context, cfg Config) error {
+	return render(ctx, cfg, newReport())
 }
 
-func Run(cfg Config) error {
+// render implements Run and fills report with the outcome of every
+// application, including the rendered manifests.
+func render(ctx context.Context, cfg Config, report *Report) (err error) {
+	if cfg.ReportFile != "" {
+		defer func() {
+			report.finish(err)
+			if writeErr := report.Write(cfg.ReportFile); writeErr != nil {
+				if err == nil {
+					err = writeErr
+				} else {
+					logger.Log.Error(writeErr)
+				}
+			}
+		}()
+	}
+
 	var tempDir string
-	var err error
 
 	if cfg.tempDir_ != "" {
 		tempDir = cfg.tempDir_
@@ -47,142 +166,761 @@ func Run(cfg Config) error {
 
 	logger.Log.Infof("Using temporary directory for clones: %s", tempDir)
 
-	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory %s: %w", cfg.OutputDir, err)
+	writer, err := output.New(cfg.OutputDir, output.Options{Format: cfg.OutputFormat, Archive: cfg.OutputArchive}, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := writer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	overrides, err := normalizeRepoOverrides(cfg.RepoOverrides)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Git.Validate(); err != nil {
+		return err
+	}
+	var validator *validate.Validator
+	if cfg.Validate {
+		if cfg.SchemaDir == "" {
+			return errors.New("validation requires a schema directory")
+		}
+		validator, err = validate.New(cfg.SchemaDir, cfg.KubeVersion)
+		if err != nil {
+			return err
+		}
+	}
+	var rules *policy.Policy
+	if len(cfg.PolicyFiles) > 0 {
+		rules, err = policy.Load(cfg.PolicyFiles...)
+		if err != nil {
+			return err
+		}
+	}
+	var deprecations *deprecation.Checker
+	if cfg.CheckDeprecations {
+		deprecations, err = deprecation.NewChecker(cfg.KubeVersion)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Передаем список фильтров
-	applications, err := renderAndParseAppOfApps(cfg.ChartPath, cfg.ValuesFiles, cfg.Filters)
+	applications, err := loadApplications(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("initialization failed: %w", err)
 	}
 
+	lockFile, err := loadLockFile(cfg.LockFile, cfg.Locked)
+	if err != nil {
+		return err
+	}
+
 	state := &appState{
-		tempDir:     tempDir,
-		outputDir:   cfg.OutputDir,
-		clonedRepos: make(map[string]string),
-		mirror:      cfg.Mirror,
+		clones:     newCloneCache(tempDir),
+		output:     writer,
+		mirror:     cfg.Mirror,
+		overrides:  overrides,
+		lock:       lockFile,
+		locked:     cfg.Locked,
+		creds:      &cfg.Git,
+		submodules: cfg.Submodules,
+		lfsDir:     cfg.LFSObjectsDir,
+		retry:      retryPolicy(cfg),
+		renderTime: cfg.RenderTimeout,
+
+		ignoreMissingValues: cfg.IgnoreMissingValues,
+	}
+
+	if cfg.OutputDir != output.Stdout && !cfg.OutputArchive {
+		helmVersion, err := helm.Version(ctx)
+		if err != nil {
+			return err
+		}
+		state.cache, err = loadRenderCache(cfg.OutputDir, cfg.OutputFormat, helmVersion)
+		if err != nil {
+			return err
+		}
+		state.cache.force = cfg.Force
+		report.Cache = &CacheStats{}
 	}
 
+	if state.mirror {
+		for i := range applications {
+			applyMirror(&applications[i], applicationLogger(applications[i]))
+		}
+	}
+	if cfg.Sparse && cfg.Submodules {
+		logger.Log.Warn("Sparse checkout is not supported together with submodules, cloning repositories in full")
+	} else if cfg.Sparse {
+		state.sparseDirs = collectSparseDirs(applications)
+	}
+
+	var unlocked []string
 	for _, app := range applications {
-		err := processApplication(app, state)
+		result := ApplicationReport{Name: app.Name, Env: app.Env, Instance: app.Instance, Source: app.Origin(), ValuesFiles: valuesFileReports(app)}
+		if ctx.Err() != nil {
+			result.Status = AppCancelled
+			report.Applications = append(report.Applications, result)
+			continue
+		}
+
+		started := time.Now()
+		rendered, err := processApplication(ctx, app, state, &result)
+		result.manifest = rendered
+		result.Duration = time.Since(started).Round(time.Millisecond).String()
 		if err != nil {
-			logger.Log.WithField("application", app.Name).Errorf("Could not process application: %v. Skipping.", err)
+			result.Status = AppFailed
+			if ctx.Err() != nil {
+				result.Status = AppCancelled
+			}
+			result.Error = err.Error()
+			applicationLogger(app).Errorf("Could not process application: %v. Skipping.", err)
+			if errors.Is(err, errNotLocked) {
+				unlocked = append(unlocked, app.Name)
+			}
+		}
+		report.Applications = append(report.Applications, result)
+	}
+
+	if state.cache != nil {
+		report.Cache.Hits, report.Cache.Misses = state.cache.hits, state.cache.misses
+		logger.Log.Infof("Render cache: %d hits, %d misses", state.cache.hits, state.cache.misses)
+		if err := state.cache.save(); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("run interrupted, remaining applications were skipped: %w", err)
+	}
+
+	policyFailed := 0
+	if validator != nil || deprecations != nil || rules != nil {
+		parsed := parseManifests(report.Applications, validator != nil)
+		if validator != nil {
+			logger.Log.Info("Validating rendered manifests...")
+			validateApplications(validator, report.Applications, parsed)
+		}
+		if deprecations != nil {
+			logger.Log.Info("Checking rendered manifests for deprecated APIs...")
+			checkDeprecations(deprecations, report.Applications, parsed)
+		}
+		if rules != nil {
+			logger.Log.Info("Checking rendered manifests against policies...")
+			policyFailed = checkPolicies(rules, applications, report.Applications, parsed)
+		}
+	}
+	invalid := 0
+	for _, result := range report.Applications {
+		if result.Status == AppInvalid {
+			invalid++
 		}
 	}
 
+	if len(unlocked) > 0 {
+		return fmt.Errorf("applications %s use repositories missing from lock file %s, run 'roar lock update'", strings.Join(unlocked, ", "), cfg.LockFile)
+	}
+	if lockFile != nil && !cfg.Locked {
+		if err := lockFile.Save(cfg.LockFile); err != nil {
+			return err
+		}
+		logger.Log.Infof("Resolved commits saved to %s", cfg.LockFile)
+	}
+	var failures []string
+	if invalid > 0 {
+		failures = append(failures, fmt.Sprintf("schema validation failed for %d applications", invalid))
+	}
+	if policyFailed > 0 {
+		failures = append(failures, fmt.Sprintf("policy check failed for %d applications", policyFailed))
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+
 	logger.Log.Info("All done!")
 	return nil
 }
 
-func renderAndParseAppOfApps(chartPath string, valuesFiles []string, filters []string) ([]argo.Application, error) {
-	logger.Log.Info("Rendering the main 'app-of-apps' chart...")
-	appOfAppsOpts := helm.RenderOptions{ReleaseName: "app-of-apps", ChartPath: chartPath, ValuesFiles: valuesFiles}
-	appOfAppsManifests, err := helm.Template(appOfAppsOpts)
+// loadApplications returns the Applications selected by the filters.
+func loadApplications(ctx context.Context, cfg Config) ([]argo.Application, error) {
+	result, err := parseApplications(ctx, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to render app-of-apps chart: %w", err)
+		return nil, err
+	}
+	logger.Log.Infof("Found %d applications to process.", len(result.Applications))
+	return result.Applications, nil
+}
+
+// parseApplications parses the Applications from applicationManifests,
+// keeping the ones skipped by filters.
+func parseApplications(ctx context.Context, cfg Config) (*argo.ParseResult, error) {
+	manifests, err := applicationManifests(ctx, cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	logger.Log.Info("Parsing for Argo CD applications...")
 	// Передаем filters (slice) в парсер
-	applications, err := argo.ParseApplications(appOfAppsManifests, filters)
+	result, err := argo.Parse(manifests, argo.ParseOptions{Filters: cfg.Filters, OnDuplicate: cfg.OnDuplicate, StrictValues: cfg.StrictValues})
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse Argo applications: %w", err)
 	}
-
-	logger.Log.Infof("Found %d applications to process.", len(applications))
-	return applications, nil
+	return result, nil
 }
 
-func processApplication(app argo.Application, state *appState) error {
-	logCtx := logger.Log.WithField("application", app.Name)
-	logCtx.Info("Processing application...")
+// applicationManifests returns the Application manifests: the contents of
+// cfg.AppFiles when they are set, otherwise the rendered app-of-apps chart.
+func applicationManifests(ctx context.Context, cfg Config) ([]byte, error) {
+	if len(cfg.AppFiles) > 0 {
+		return readAppFiles(cfg.AppFiles, os.Stdin)
+	}
+	return renderAppOfApps(ctx, cfg.ChartPath, cfg.ValuesFiles, cfg.RenderTimeout)
+}
 
-	// Apply mirror transformation if enabled
-	if state.mirror {
-		newRepoURL, newPath, transformed := applyMirrorTransform(app.RepoURL, app.Path)
-		if transformed {
-			logCtx.Info("Mirror transformation applied")
-			logCtx.Infof("  Repository: %s -> %s", app.RepoURL, newRepoURL)
-			logCtx.Infof("  Path: %s -> %s", app.Path, newPath)
-			app.RepoURL = newRepoURL
-			app.Path = newPath
+// readAppFiles concatenates Application manifest files into one multi-document
+// YAML stream. The path "-" reads stdin.
+func readAppFiles(paths []string, stdin io.Reader) ([]byte, error) {
+	var manifests bytes.Buffer
+	stdinRead := false
+	for _, path := range paths {
+		var data []byte
+		var err error
+		if path == "-" {
+			if stdinRead {
+				return nil, errors.New("stdin ('-') can be given only once")
+			}
+			stdinRead = true
+			logger.Log.Info("Reading Application manifests from stdin...")
+			data, err = io.ReadAll(stdin)
+		} else {
+			logger.Log.Infof("Reading Application manifests from %s...", path)
+			data, err = os.ReadFile(path)
 		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read application file %s: %w", path, err)
+		}
+		// The file name is the source of its Applications, like the template
+		// name in the output of 'helm template'.
+		source := path
+		if path == "-" {
+			source = "stdin"
+		}
+		fmt.Fprintf(&manifests, "---\n# Source: %s\n", source)
+		manifests.Write(data)
+		manifests.WriteString("\n")
+	}
+	return manifests.Bytes(), nil
+}
+
+// renderAppOfApps renders the app-of-apps chart.
+func renderAppOfApps(ctx context.Context, chartPath string, valuesFiles []string, timeout time.Duration) ([]byte, error) {
+	logger.Log.Info("Rendering the main 'app-of-apps' chart...")
+	appOfAppsOpts := helm.RenderOptions{ReleaseName: "app-of-apps", ChartPath: chartPath, ValuesFiles: valuesFiles}
+	appOfAppsManifests, err := renderWithTimeout(ctx, timeout, appOfAppsOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render app-of-apps chart: %w", err)
 	}
+	return appOfAppsManifests, nil
+}
 
-	werfSetValues := app.Setters
-	if werfSetValues == nil {
-		werfSetValues = make(map[string]string)
+// applicationLogger returns a logger for app that also names the template of
+// the app-of-apps chart the Application comes from, when it is known.
+func applicationLogger(app argo.Application) *logrus.Entry {
+	fields := logrus.Fields{"application": app.Name}
+	if origin := app.Origin(); origin != "" {
+		fields["source"] = origin
 	}
+	return logger.Log.WithFields(fields)
+}
 
-	logCtx.Infof("Found %d --set values and %d --values files.", len(werfSetValues), len(app.ValuesFiles))
+// processApplication clones and renders a single application, recording the
+// render status and output file in result. It returns the rendered manifest.
+func processApplication(ctx context.Context, app argo.Application, state *appState, result *ApplicationReport) ([]byte, error) {
+	logCtx := applicationLogger(app).WithFields(logrus.Fields{"repo": app.RepoURL, "revision": app.TargetRevision})
+	logCtx.Info("Processing application...")
 
+	logCtx.Infof("Found %d --set values and %d --values files.", len(app.Setters), len(app.ValuesFiles))
+	werfSetValues := helmSetValues(app)
 	if app.Instance != "" {
-		werfSetValues["global.instance"] = app.Instance
 		logCtx.Infof("Resolved final 'instance' to '%s'", app.Instance)
 	}
 	if app.Env != "" {
-		werfSetValues["global.env"] = app.Env
 		logCtx.Infof("Resolved final 'env' to '%s'", app.Env)
 	}
 
-	sshURL, err := convertHTTPtoSSH(app.RepoURL)
-	if err != nil {
-		return fmt.Errorf("invalid repo URL '%s': %w", app.RepoURL, err)
-	}
-
-	cacheKey := fmt.Sprintf("%s@%s", sshURL, app.TargetRevision)
-	repoPath, isCached := state.clonedRepos[cacheKey]
-	if !isCached {
-		state.cloneCounter++
-		repoPath = filepath.Join(state.tempDir, fmt.Sprintf("clone-%d", state.cloneCounter))
-		logCtx.Infof("Cloning %s to %s", cacheKey, repoPath)
-		err = git.Clone(sshURL, app.TargetRevision, repoPath)
+	var repoPath string
+	if overrideDir, ok := state.findRepoOverride(app.RepoURL); ok {
+		logCtx.Infof("Using local override %s for repository %s", overrideDir, app.RepoURL)
+		repoPath = overrideDir
+	} else {
+		var release func()
+		var err error
+		repoPath, release, err = state.cloneRepo(ctx, app, logCtx)
 		if err != nil {
-			return fmt.Errorf("failed to clone repo: %w", err)
+			return nil, err
 		}
-		state.clonedRepos[cacheKey] = repoPath
-	} else {
-		logCtx.Infof("Using cached repository from path: %s", repoPath)
+		defer release()
 	}
 
-	appServicePath := filepath.Join(repoPath, app.Path)
-	appChartPath := filepath.Join(appServicePath, ".helm")
-	absoluteValuesFiles := make([]string, len(app.ValuesFiles))
-	for i, file := range app.ValuesFiles {
-		absoluteValuesFiles[i] = filepath.Join(appServicePath, file)
+	appOpts, err := renderOptionsFor(app, repoPath, werfSetValues, state.confined)
+	if err != nil {
+		return nil, err
 	}
+	logCtx.Infof("Using chart directory '%s' and release name '%s'", appOpts.ChartPath, appOpts.ReleaseName)
 
-	appOpts := helm.RenderOptions{ReleaseName: app.Name, ChartPath: appChartPath, ValuesFiles: absoluteValuesFiles, SetValues: werfSetValues}
-	renderedApp, err := helm.Template(appOpts)
+	appOpts.ValuesFiles, err = checkValuesFiles(app, appOpts.ValuesFiles, state.ignoreMissingValues, logCtx)
 	if err != nil {
-		logCtx.Errorf("Failed to render chart: %v. Writing empty manifest.", err)
-		renderedApp = []byte{}
+		return nil, err
+	}
+
+	appOpts, cleanupLFS, err := resolveLFSPointers(appOpts, state.lfsDir, logCtx)
+	if err != nil {
+		return nil, err
 	}
+	defer cleanupLFS()
 
-	finalOutputDir := state.outputDir
 	if app.Env != "" {
-		finalOutputDir = filepath.Join(finalOutputDir, app.Env)
 		logCtx.Infof("Using resolved 'env': '%s' for output directory.", app.Env)
 	}
 	if app.Instance != "" {
-		finalOutputDir = filepath.Join(finalOutputDir, app.Instance)
 		logCtx.Infof("Using resolved 'instance': '%s' for output directory.", app.Instance)
 	}
+	outputPath := app.OutputPath()
+	entry := output.Entry{Path: outputPath, Application: app.Name, Env: app.Env, Instance: app.Instance}
+
+	var inputHash string
+	if state.cache != nil {
+		if inputHash, err = state.cache.hash(appOpts, filepath.Join(repoPath, app.Path)); err != nil {
+			// Let helm report the problem with the chart.
+			logCtx.Warnf("Not using the render cache: %v", err)
+		} else if location, rendered, ok := state.cachedManifest(entry, inputHash, logCtx); ok {
+			result.Status = AppRendered
+			result.Cached = true
+			result.OutputFile = location
+			return rendered, nil
+		}
+		state.cache.misses++
+	}
 
-	if err := os.MkdirAll(finalOutputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output subdirectory %s: %w", finalOutputDir, err)
+	renderedApp, err := renderWithTimeout(ctx, state.renderTime, appOpts)
+	result.Status = AppRendered
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		logCtx.Errorf("Failed to render chart: %v. Writing empty manifest.", err)
+		renderedApp = []byte{}
+		result.Status = AppRenderFailed
+		result.Error = err.Error()
 	}
 
-	outputFile := filepath.Join(finalOutputDir, fmt.Sprintf("%s.yaml", app.Name))
-	err = os.WriteFile(outputFile, renderedApp, 0644)
+	entry.Data = renderedApp
+	outputFile, err := state.output.Write(entry)
 	if err != nil {
-		return fmt.Errorf("failed to write manifest to %s: %w", outputFile, err)
+		return nil, err
+	}
+	if state.cache != nil {
+		if result.Status == AppRendered && inputHash != "" {
+			state.cache.store(outputPath, inputHash)
+		} else {
+			state.cache.drop(outputPath)
+		}
+	}
+	result.OutputFile = outputFile
+	if outputFile == "" {
+		outputFile = "stdout"
 	}
 	logCtx.Infof("Successfully rendered and saved manifest to %s", outputFile)
+	return renderedApp, nil
+}
+
+// cachedManifest returns the manifest in the output when the render cache
+// says it was rendered from inputs with inputHash.
+func (s *appState) cachedManifest(entry output.Entry, inputHash string, logCtx *logrus.Entry) (string, []byte, bool) {
+	loader, ok := s.output.(output.Loader)
+	if !ok || !s.cache.lookup(entry.Path, inputHash) {
+		return "", nil, false
+	}
+	location, data, err := loader.Load(entry)
+	if err != nil {
+		logCtx.Warnf("Render cache entry is unusable, rendering again: %v", err)
+		return "", nil, false
+	}
+	s.cache.hits++
+	logCtx.Infof("Render inputs are unchanged, reusing manifest %s", location)
+	return location, data, true
+}
+
+// helmSetValues returns the --set values of the application: its WERF_SET_*
+// setters plus global.instance and global.env.
+func helmSetValues(app argo.Application) map[string]string {
+	values := make(map[string]string, len(app.Setters)+2)
+	for key, value := range app.Setters {
+		values[key] = value
+	}
+	if app.Instance != "" {
+		values["global.instance"] = app.Instance
+	}
+	if app.Env != "" {
+		values["global.env"] = app.Env
+	}
+	return values
+}
+
+// renderOptionsFor builds the 'helm template' options of an application
+// checked out at repoPath: the chart from werf.yaml or .helm and values files
+// relative to the service path. With confine the application comes from an
+// untrusted source: werf.yaml may not read the environment and the service
+// path, chart and values files must stay inside repoPath.
+func renderOptionsFor(app argo.Application, repoPath string, setValues map[string]string, confine bool) (helm.RenderOptions, error) {
+	appServicePath := filepath.Join(repoPath, app.Path)
+	if confine {
+		if err := confineToRepo(repoPath, appServicePath); err != nil {
+			return helm.RenderOptions{}, fmt.Errorf("service path '%s': %w", app.Path, err)
+		}
+	}
+	chart, err := resolveChartSettings(app, appServicePath, werf.LoadOptions{DisableEnv: confine})
+	if err != nil {
+		return helm.RenderOptions{}, err
+	}
+	absoluteValuesFiles := make([]string, len(app.ValuesFiles))
+	for i, file := range app.ValuesFiles {
+		absoluteValuesFiles[i] = filepath.Join(appServicePath, file)
+		if confine {
+			if err := confineToRepo(repoPath, absoluteValuesFiles[i]); err != nil {
+				return helm.RenderOptions{}, fmt.Errorf("values file '%s': %w", file, err)
+			}
+		}
+	}
+	opts := helm.RenderOptions{
+		ReleaseName: chart.releaseName,
+		Namespace:   chart.namespace,
+		ChartPath:   filepath.Join(appServicePath, chart.dir),
+		ValuesFiles: absoluteValuesFiles,
+		SetValues:   setValues,
+	}
+	if confine {
+		if err := confineChart(repoPath, opts.ChartPath); err != nil {
+			return helm.RenderOptions{}, err
+		}
+	}
+	return opts, nil
+}
+
+// confineToRepo checks that path, with symlinks resolved, is inside repoPath.
+// A path that does not exist is checked as written; helm reports it later.
+func confineToRepo(repoPath, path string) error {
+	root, err := filepath.EvalSymlinks(repoPath)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, os.ErrNotExist) {
+		root, resolved = repoPath, path
+	} else if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("'%s' is outside the repository", path)
+	}
 	return nil
 }
 
+// confineChart checks the chart directory and every symlink in it with
+// confineToRepo, so that helm does not read files outside the repository.
+func confineChart(repoPath, chartPath string) error {
+	if err := confineToRepo(repoPath, chartPath); err != nil {
+		return fmt.Errorf("chart directory: %w", err)
+	}
+	err := filepath.WalkDir(chartPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		if err := confineToRepo(repoPath, path); err != nil {
+			return fmt.Errorf("chart file: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// checkValuesFiles verifies that the values files of app, resolved to
+// absolutePaths by renderOptionsFor, exist, so a typo in WERF_VALUES_* is
+// reported with the variable it comes from instead of as a helm error. With
+// ignoreMissing the missing files are dropped from the returned list.
+func checkValuesFiles(app argo.Application, absolutePaths []string, ignoreMissing bool, logCtx *logrus.Entry) ([]string, error) {
+	existing := make([]string, 0, len(absolutePaths))
+	var missing []string
+	for i, file := range absolutePaths {
+		_, err := os.Stat(file)
+		if err == nil {
+			existing = append(existing, file)
+			continue
+		}
+		source := fmt.Sprintf("values file %d", i)
+		if i < len(app.ValuesFileVars) {
+			source = app.ValuesFileVars[i]
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s: cannot access values file '%s': %w", source, app.ValuesFiles[i], err)
+		}
+		if ignoreMissing {
+			logCtx.Warnf("Skipping missing values file '%s' from %s (%s)", app.ValuesFiles[i], source, file)
+			continue
+		}
+		missing = append(missing, fmt.Sprintf("%s=%s (%s)", source, app.ValuesFiles[i], file))
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing values files: %s; use --ignore-missing-values to skip them", strings.Join(missing, ", "))
+	}
+	return existing, nil
+}
+
+// renderWithTimeout runs 'helm template' limited by timeout, if it is set.
+func renderWithTimeout(ctx context.Context, timeout time.Duration, opts helm.RenderOptions) ([]byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return helm.Template(ctx, opts)
+}
+
+// retryPolicy builds the policy for network git operations from the config.
+func retryPolicy(cfg Config) git.RetryPolicy {
+	return git.RetryPolicy{
+		Attempts:       cfg.CloneRetries + 1,
+		Timeout:        cfg.CloneTimeout,
+		InitialBackoff: retryBackoff,
+	}
+}
+
+// cloneRepo clones the application repository into the temp directory, reusing
+// an earlier clone of the same repository and revision. The returned function
+// releases the clone once the caller is done with it.
+func (s *appState) cloneRepo(ctx context.Context, app argo.Application, logCtx *logrus.Entry) (string, func(), error) {
+	remote, err := s.remoteFor(app.RepoURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cloneOpts := git.CloneOptions{SparseDirs: s.sparseDirs[sourceKey(app)]}
+	if s.submodules {
+		cloneOpts.Submodules = s.remoteFor
+	}
+	if s.locked {
+		commit, ok := s.lock.Get(normalizeRepoURL(app.RepoURL), app.TargetRevision)
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %s@%s", errNotLocked, app.RepoURL, app.TargetRevision)
+		}
+		cloneOpts.Commit = commit
+	}
+
+	source := fmt.Sprintf("%s@%s", remote.URL, app.TargetRevision)
+	repoPath, release, isCached, err := s.clones.get(ctx, sourceKey(app), func(repoPath string) error {
+		logCtx.Infof("Cloning %s to %s", source, repoPath)
+		err := git.Retry(ctx, s.retry, "clone of "+source, func(ctx context.Context) error {
+			// A partial clone left by a failed attempt would make the next one fail.
+			if err := os.RemoveAll(repoPath); err != nil {
+				return err
+			}
+			return git.Clone(ctx, remote, app.TargetRevision, repoPath, cloneOpts)
+		})
+		if err != nil {
+			os.RemoveAll(repoPath)
+			return fmt.Errorf("failed to clone repo: %w", err)
+		}
+
+		if s.lock != nil && !s.locked {
+			commit, err := git.HeadCommit(repoPath)
+			if err != nil {
+				return err
+			}
+			logCtx.Infof("Revision %s resolved to commit %s", app.TargetRevision, commit)
+			s.lock.Set(normalizeRepoURL(app.RepoURL), app.TargetRevision, commit)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if isCached {
+		logCtx.Infof("Using cached repository from path: %s", repoPath)
+	}
+	return repoPath, release, nil
+}
+
+// remoteFor converts the repository URL to the transport configured for its
+// host and picks the credentials for it. Without configuration every http(s)
+// URL is converted to SSH and go-git falls back to ssh-agent.
+func (s *appState) remoteFor(repoURL string) (git.Remote, error) {
+	cloneURL := repoURL
+	switch s.creds.TransportFor(git.HostOf(repoURL)) {
+	case git.TransportHTTPS:
+		cloneURL = convertSSHtoHTTPS(repoURL)
+	default:
+		sshURL, err := convertHTTPtoSSH(repoURL)
+		if err != nil {
+			return git.Remote{}, fmt.Errorf("invalid repo URL '%s': %w", repoURL, err)
+		}
+		cloneURL = sshURL
+	}
+
+	auth, err := s.creds.Auth(cloneURL)
+	if err != nil {
+		return git.Remote{}, fmt.Errorf("failed to configure credentials for %s: %w", cloneURL, err)
+	}
+	return git.Remote{URL: cloneURL, Auth: auth}, nil
+}
+
+// sourceKey identifies the repository and revision an application is rendered
+// from. The repository URL is normalized, so the https and git@ forms of one
+// repository share a key: clones and sparse directories are looked up by it.
+func sourceKey(app argo.Application) string {
+	return fmt.Sprintf("%s@%s", normalizeRepoURL(app.RepoURL), app.TargetRevision)
+}
+
+// collectSparseDirs returns, per repository and revision, the directories that
+// the applications need: their service paths and the directories of values
+// files outside them. Repositories where some application needs the whole tree
+// (path "." or a values file outside the repository) are left out, so they are
+// cloned in full.
+func collectSparseDirs(applications []argo.Application) map[string][]string {
+	dirs := make(map[string]map[string]bool)
+	full := make(map[string]bool)
+
+	for _, app := range applications {
+		key := sourceKey(app)
+		servicePath := filepath.Clean(app.Path)
+		needed := []string{servicePath}
+		for _, file := range app.ValuesFiles {
+			needed = append(needed, filepath.Dir(filepath.Join(servicePath, file)))
+		}
+
+		for _, dir := range needed {
+			dir = filepath.ToSlash(dir)
+			if dir == "." || dir == ".." || strings.HasPrefix(dir, "../") || filepath.IsAbs(dir) {
+				full[key] = true
+				break
+			}
+			if dirs[key] == nil {
+				dirs[key] = make(map[string]bool)
+			}
+			dirs[key][dir] = true
+		}
+	}
+
+	result := make(map[string][]string, len(dirs))
+	for key, set := range dirs {
+		if full[key] {
+			continue
+		}
+		list := make([]string, 0, len(set))
+		for dir := range set {
+			list = append(list, dir)
+		}
+		sort.Strings(list)
+		result[key] = list
+	}
+	return result
+}
+
+// findRepoOverride returns the local directory configured for the repository.
+// The URL is matched after the mirror transformation.
+func (s *appState) findRepoOverride(repoURL string) (string, bool) {
+	dir, ok := s.overrides[normalizeRepoURL(repoURL)]
+	return dir, ok
+}
+
+// normalizeRepoOverrides validates override directories and keys them by
+// normalized repository URL.
+func normalizeRepoOverrides(overrides map[string]string) (map[string]string, error) {
+	normalized := make(map[string]string, len(overrides))
+	for repoURL, dir := range overrides {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid override directory %s for %s: %w", dir, repoURL, err)
+		}
+		info, err := os.Stat(absDir)
+		if err != nil {
+			return nil, fmt.Errorf("override directory for %s is not accessible: %w", repoURL, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("override path %s for %s is not a directory", absDir, repoURL)
+		}
+		normalized[normalizeRepoURL(repoURL)] = absDir
+	}
+	return normalized, nil
+}
+
+// normalizeRepoURL brings https and ssh forms of the same repository to one key,
+// e.g. "https://Git.Example.com/org/repo.git/" -> "git@git.example.com:org/repo".
+func normalizeRepoURL(repoURL string) string {
+	normalized := strings.TrimSpace(repoURL)
+	if sshURL, err := convertHTTPtoSSH(normalized); err == nil {
+		normalized = sshURL
+	}
+	normalized = strings.TrimSuffix(strings.TrimSuffix(normalized, "/"), ".git")
+	if host, path, found := strings.Cut(normalized, ":"); found && strings.HasPrefix(host, "git@") {
+		normalized = strings.ToLower(host) + ":" + path
+	}
+	return normalized
+}
+
+// ParseRepoOverride parses a "<repoURL>=<local dir>" flag value.
+func ParseRepoOverride(value string) (string, string, error) {
+	repoURL, dir, found := strings.Cut(value, "=")
+	repoURL = strings.TrimSpace(repoURL)
+	dir = strings.TrimSpace(dir)
+	if !found || repoURL == "" || dir == "" {
+		return "", "", fmt.Errorf("invalid repo override '%s': expected '<repoURL>=<local dir>'", value)
+	}
+	return repoURL, dir, nil
+}
+
+// chartSettings describes where the application chart lives and how it is released.
+type chartSettings struct {
+	dir         string
+	releaseName string
+	namespace   string
+}
+
+// resolveChartSettings reads werf.yaml from the service path, if present, to
+// determine the chart directory, release name and namespace. Without werf.yaml
+// (or without the corresponding deploy fields) the chart is expected in .helm
+// and the release is named after the Application.
+func resolveChartSettings(app argo.Application, servicePath string, opts werf.LoadOptions) (chartSettings, error) {
+	settings := chartSettings{dir: werf.DefaultHelmChartDir, releaseName: app.Name}
+
+	werfCfg, err := werf.Load(servicePath, app.Env, opts)
+	if err != nil {
+		return settings, fmt.Errorf("failed to load werf config: %w", err)
+	}
+	if werfCfg == nil {
+		return settings, nil
+	}
+
+	settings.dir = werfCfg.ChartDir()
+	if release, ok := werfCfg.Release(app.Env); ok {
+		settings.releaseName = release
+	}
+	if namespace, ok := werfCfg.Namespace(app.Env); ok {
+		settings.namespace = namespace
+	}
+	return settings, nil
+}
+
 func convertHTTPtoSSH(httpURL string) (string, error) {
 	if strings.HasPrefix(httpURL, "git@") {
 		return httpURL, nil
@@ -199,6 +937,39 @@ func convertHTTPtoSSH(httpURL string) (string, error) {
 	return sshURL, nil
 }
 
+// applyMirror rewrites the application source in place when the mirror
+// transformation applies to it.
+func applyMirror(app *argo.Application, logCtx *logrus.Entry) {
+	newRepoURL, newPath, transformed := applyMirrorTransform(app.RepoURL, app.Path)
+	if !transformed {
+		return
+	}
+	logCtx.Info("Mirror transformation applied")
+	logCtx.Infof("  Repository: %s -> %s", app.RepoURL, newRepoURL)
+	logCtx.Infof("  Path: %s -> %s", app.Path, newPath)
+	app.RepoURL = newRepoURL
+	app.Path = newPath
+}
+
+// convertSSHtoHTTPS is the reverse of convertHTTPtoSSH: "git@host:path" and
+// "ssh://user@host/path" become "https://host/path". Other URLs are returned as is.
+func convertSSHtoHTTPS(repoURL string) string {
+	if strings.HasPrefix(repoURL, "ssh://") {
+		parsedURL, err := url.Parse(repoURL)
+		if err != nil {
+			return repoURL
+		}
+		return fmt.Sprintf("https://%s%s", parsedURL.Hostname(), parsedURL.Path)
+	}
+	if rest, ok := strings.CutPrefix(repoURL, "git@"); ok {
+		host, path, found := strings.Cut(rest, ":")
+		if found {
+			return fmt.Sprintf("https://%s/%s", host, strings.TrimPrefix(path, "/"))
+		}
+	}
+	return repoURL
+}
+
 const (
 	mirrorSourceHost = "git.nvfn.ru"
 	mirrorTargetRepo = "https://git.uis.dev/deploy/product.git"
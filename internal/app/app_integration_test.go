@@ -4,13 +4,32 @@
 package app
 
 import (
+	"archive/tar"
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/images"
+	"roar/internal/pkg/output"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 
 	"github.com/stretchr/testify/require"
 )
@@ -21,6 +40,12 @@ func setupIntegrationTest(t *testing.T) (string, func()) {
 
 	helmScriptPath := filepath.Join(binDir, "helm")
 	helmScript := fmt.Sprintf(`#!/bin/bash
+# Версия helm для хеша кеша рендеринга
+if [ "$1" == "version" ]; then
+    echo "${FAKE_HELM_VERSION:-v3.14.0+g0000000}"
+    exit 0
+fi
+
 # Записываем вызванную команду в лог для последующей проверки в тесте
 echo "helm $@" >> %s
 
@@ -32,6 +57,13 @@ if [ "$RELEASE_NAME" == "app-of-apps" ]; then
     if [ -d "${CHART_PATH}/templates" ]; then
         cat "${CHART_PATH}"/templates/*.yaml
     fi
+elif [ -d "${CHART_PATH}/templates" ]; then
+    # Дочернее приложение с шаблонами: выводим их, как helm, с комментарием Source
+    for f in "${CHART_PATH}"/templates/*.yaml; do
+        echo "---"
+        echo "# Source: $(basename "$(dirname "$(dirname "$f")")")/templates/$(basename "$f")"
+        cat "$f"
+    done
 else
     # Иначе, это дочернее приложение. Выводим фейковый YAML.
     echo "kind: FakedHelmOutputForApp"
@@ -125,7 +157,7 @@ spec:
 		OutputDir: outputDir,
 		tempDir_:  clonesDir,
 	}
-	err := Run(cfg)
+	err := Run(context.Background(), cfg)
 	require.NoError(t, err)
 
 	expectedOutputFile := filepath.Join(outputDir, "dev", "inf1", "dev-inf1-my-service.yaml")
@@ -200,7 +232,7 @@ spec:
 		LogLevel:  "info",
 	}
 
-	err := Run(cfg)
+	err := Run(context.Background(), cfg)
 	require.NoError(t, err)
 
 	// 1. Файл для app-prod должен существовать
@@ -293,7 +325,7 @@ spec:
 		Mirror:   true, // Включаем Mirror (не повлияет на локальный путь, но проверяет что флаг не ломает работу)
 	}
 
-	err := Run(cfg)
+	err := Run(context.Background(), cfg)
 	require.NoError(t, err)
 
 	// Проверяем что файл создан
@@ -382,7 +414,7 @@ spec:
 		Mirror:   true,
 	}
 
-	err = Run(cfg)
+	err = Run(context.Background(), cfg)
 	require.NoError(t, err)
 
 	// Оба файла должны быть созданы
@@ -404,3 +436,1565 @@ spec:
 	require.Contains(t, cmdLog, filepath.Join("stable", "svc-a", ".helm"))
 	require.Contains(t, cmdLog, filepath.Join("stable", "svc-b", ".helm"))
 }
+
+// createFakeGitRepoWithFiles создает Git репозиторий с произвольным набором файлов.
+func createFakeGitRepoWithFiles(t *testing.T, files map[string]string) string {
+	repoPath := t.TempDir()
+
+	r, err := git.PlainInit(repoPath, false)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	for name, content := range files {
+		path := filepath.Join(repoPath, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	_, err = w.Add(".")
+	require.NoError(t, err)
+	_, err = w.Commit("Initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@test.com"},
+	})
+	require.NoError(t, err)
+
+	return repoPath
+}
+
+// writeAppOfAppsChart создает app-of-apps чарт с единственным шаблоном.
+func writeAppOfAppsChart(t *testing.T, dir, template string) {
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "templates"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"),
+		[]byte("apiVersion: v2\nname: root-chart\nversion: 0.1.0"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "templates", "apps.yaml"), []byte(template), 0644))
+}
+
+func TestAppRun_Integration_WerfConfig(t *testing.T) {
+	cmdLogPath, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	clonesDir := filepath.Join(testRootDir, "clones")
+
+	// werf.yaml переопределяет директорию чарта, релиз и namespace
+	fakeRepo := createFakeGitRepoWithFiles(t, map[string]string{
+		"stable/my-service/werf.yaml": `
+project: my-service
+configVersion: 1
+deploy:
+  helmChartDir: deploy/chart
+  helmRelease: "[[ project ]]-[[ env ]]"
+  helmNamespace: "{{ .Env }}-apps"
+`,
+		"stable/my-service/deploy/chart/Chart.yaml": "apiVersion: v2\nname: my-service\nversion: 1.0.0",
+	})
+
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: werf-app
+  labels: {env: dev}
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/my-service"
+spec:
+  source:
+    targetRevision: master
+    plugin: {env: []}
+`, fakeRepo))
+
+	cfg := Config{
+		ChartPath: appOfAppsDir,
+		OutputDir: outputDir,
+		tempDir_:  clonesDir,
+	}
+
+	require.NoError(t, Run(context.Background(), cfg))
+	require.FileExists(t, filepath.Join(outputDir, "dev", "werf-app.yaml"))
+
+	cmdLogContent, err := os.ReadFile(cmdLogPath)
+	require.NoError(t, err)
+	cmdLog := string(cmdLogContent)
+
+	require.Contains(t, cmdLog, "helm template my-service-dev")
+	require.Contains(t, cmdLog, filepath.Join("stable", "my-service", "deploy", "chart"))
+	require.Contains(t, cmdLog, "--namespace dev-apps")
+}
+
+func TestAppRun_Integration_RepoOverride(t *testing.T) {
+	cmdLogPath, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	clonesDir := filepath.Join(testRootDir, "clones")
+	require.NoError(t, os.Mkdir(clonesDir, 0755))
+
+	// Локальная рабочая копия без коммитов: репозиторий не должен клонироваться
+	localDir := filepath.Join(testRootDir, "local-product")
+	require.NoError(t, os.MkdirAll(filepath.Join(localDir, "stable", "my-service", ".helm"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "stable", "my-service", ".helm", "Chart.yaml"),
+		[]byte("apiVersion: v2\nname: my-service\nversion: 1.0.0"), 0644))
+
+	writeAppOfAppsChart(t, appOfAppsDir, `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: local-app
+  labels: {env: dev}
+  annotations:
+    rawRepository: "https://git.example.com/org/product.git"
+    rawPath: "stable/my-service"
+spec:
+  source:
+    targetRevision: master
+    plugin: {env: []}
+`)
+
+	cfg := Config{
+		ChartPath:     appOfAppsDir,
+		OutputDir:     outputDir,
+		tempDir_:      clonesDir,
+		RepoOverrides: map[string]string{"git@git.example.com:org/product.git": localDir},
+	}
+
+	require.NoError(t, Run(context.Background(), cfg))
+	require.FileExists(t, filepath.Join(outputDir, "dev", "local-app.yaml"))
+
+	cloneDirs, err := os.ReadDir(clonesDir)
+	require.NoError(t, err)
+	require.Empty(t, cloneDirs, "Overridden repository must not be cloned")
+
+	cmdLogContent, err := os.ReadFile(cmdLogPath)
+	require.NoError(t, err)
+	require.Contains(t, string(cmdLogContent), filepath.Join(localDir, "stable", "my-service", ".helm"))
+}
+
+func TestAppRun_Integration_LockFile(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	lockPath := filepath.Join(testRootDir, "roar.lock")
+
+	fakeRepo := createFakeGitRepoWithFiles(t, map[string]string{
+		"stable/my-service/.helm/Chart.yaml": "apiVersion: v2\nname: my-service\nversion: 1.0.0",
+		"stable/my-service/VERSION":          "v1",
+	})
+	r, err := git.PlainOpen(fakeRepo)
+	require.NoError(t, err)
+	firstCommit, err := r.Head()
+	require.NoError(t, err)
+
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: locked-app
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/my-service"
+spec:
+  source:
+    targetRevision: master
+`, fakeRepo))
+
+	// 1. Обычный запуск записывает lock-файл с текущим коммитом
+	clonesDir := filepath.Join(testRootDir, "clones-1")
+	require.NoError(t, Run(context.Background(), Config{ChartPath: appOfAppsDir, OutputDir: filepath.Join(testRootDir, "out"), LockFile: lockPath, tempDir_: clonesDir}))
+	lockContent, err := os.ReadFile(lockPath)
+	require.NoError(t, err)
+	require.Contains(t, string(lockContent), firstCommit.Hash().String())
+
+	// 2. Ветка ушла вперед, но в locked-режиме клонируется зафиксированный коммит
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(fakeRepo, "stable", "my-service", "VERSION"), []byte("v2"), 0644))
+	_, err = w.Add(".")
+	require.NoError(t, err)
+	_, err = w.Commit("Second commit", &git.CommitOptions{Author: &object.Signature{Name: "Test", Email: "test@test.com"}})
+	require.NoError(t, err)
+
+	clonesDir = filepath.Join(testRootDir, "clones-2")
+	require.NoError(t, Run(context.Background(), Config{ChartPath: appOfAppsDir, OutputDir: filepath.Join(testRootDir, "out"), LockFile: lockPath, Locked: true, tempDir_: clonesDir}))
+	version, err := os.ReadFile(filepath.Join(clonesDir, "clone-1", "stable", "my-service", "VERSION"))
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(version))
+
+	// 3. lock update фиксирует новую вершину ветки
+	require.NoError(t, UpdateLock(context.Background(), Config{ChartPath: appOfAppsDir, LockFile: lockPath}))
+	secondCommit, err := r.Head()
+	require.NoError(t, err)
+	lockContent, err = os.ReadFile(lockPath)
+	require.NoError(t, err)
+	require.Contains(t, string(lockContent), secondCommit.Hash().String())
+	require.NotContains(t, string(lockContent), firstCommit.Hash().String())
+}
+
+func TestAppRun_Integration_LockedMissingEntry(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	lockPath := filepath.Join(testRootDir, "roar.lock")
+	require.NoError(t, os.WriteFile(lockPath, []byte("version: 1\nrepositories: []\n"), 0644))
+
+	fakeRepo := createFakeGitRepo(t)
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: new-app
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/my-service"
+spec:
+  source:
+    targetRevision: master
+`, fakeRepo))
+
+	err := Run(context.Background(), Config{ChartPath: appOfAppsDir, OutputDir: filepath.Join(testRootDir, "out"), LockFile: lockPath, Locked: true, tempDir_: filepath.Join(testRootDir, "clones")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "new-app")
+	require.Contains(t, err.Error(), "missing from lock file")
+}
+
+func TestAppRun_Integration_SparseCheckout(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	clonesDir := filepath.Join(testRootDir, "clones")
+
+	fakeRepo := createFakeGitRepoWithFiles(t, map[string]string{
+		"stable/svc-a/.helm/Chart.yaml": "apiVersion: v2\nname: svc-a\nversion: 1.0.0",
+		"stable/svc-b/.helm/Chart.yaml": "apiVersion: v2\nname: svc-b\nversion: 1.0.0",
+		"stable/common/values.yaml":     "replicas: 1",
+		"README.md":                     "monorepo",
+	})
+
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc-a
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/svc-a"
+spec:
+  source:
+    targetRevision: master
+    plugin:
+      env:
+        - name: WERF_VALUES_0
+          value: ../common/values.yaml
+`, fakeRepo))
+
+	require.NoError(t, Run(context.Background(), Config{ChartPath: appOfAppsDir, OutputDir: outputDir, Sparse: true, tempDir_: clonesDir}))
+	require.FileExists(t, filepath.Join(outputDir, "svc-a.yaml"))
+
+	clone := filepath.Join(clonesDir, "clone-1")
+	require.FileExists(t, filepath.Join(clone, "stable", "svc-a", ".helm", "Chart.yaml"))
+	require.FileExists(t, filepath.Join(clone, "stable", "common", "values.yaml"))
+	require.NoDirExists(t, filepath.Join(clone, "stable", "svc-b"))
+	require.NoFileExists(t, filepath.Join(clone, "README.md"))
+}
+
+// serveGitRepos раздает репозитории из root по HTTPS через git http-backend
+// и направляет туда все https-клоны go-git, на каком бы хосте ни был URL.
+func serveGitRepos(t *testing.T, root string) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git CLI is required to serve repositories over HTTPS")
+	}
+	server := httptest.NewTLSServer(&cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	t.Cleanup(server.Close)
+
+	httpClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	client.InstallProtocol("https", githttp.NewClient(httpClient))
+	t.Cleanup(func() { client.InstallProtocol("https", githttp.DefaultClient) })
+}
+
+func TestAppRun_Integration_SparseCheckoutMixedURLs(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	clonesDir := filepath.Join(testRootDir, "clones")
+	reposDir := filepath.Join(testRootDir, "repos")
+
+	fakeRepo := createFakeGitRepoWithFiles(t, map[string]string{
+		"stable/svc-a/.helm/Chart.yaml": "apiVersion: v2\nname: svc-a\nversion: 1.0.0",
+		"stable/svc-b/.helm/Chart.yaml": "apiVersion: v2\nname: svc-b\nversion: 1.0.0",
+		"README.md":                     "monorepo",
+	})
+	require.NoError(t, os.MkdirAll(filepath.Join(reposDir, "org"), 0755))
+	require.NoError(t, os.Symlink(fakeRepo, filepath.Join(reposDir, "org", "mono.git")))
+	serveGitRepos(t, reposDir)
+
+	// Один репозиторий в https- и git@-форме: клон общий и содержит каталоги обоих приложений
+	writeAppOfAppsChart(t, appOfAppsDir, `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc-a
+  annotations:
+    rawRepository: "https://git.example.com/org/mono.git"
+    rawPath: "stable/svc-a"
+spec:
+  source:
+    targetRevision: master
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc-b
+  annotations:
+    rawRepository: "git@git.example.com:org/mono.git"
+    rawPath: "stable/svc-b"
+spec:
+  source:
+    targetRevision: master
+`)
+
+	reportPath := filepath.Join(testRootDir, "report.json")
+	cfg := Config{ChartPath: appOfAppsDir, OutputDir: outputDir, ReportFile: reportPath, Sparse: true, tempDir_: clonesDir}
+	cfg.Git.Transport = "https"
+	require.NoError(t, Run(context.Background(), cfg))
+
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	var report Report
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Equal(t, RunSucceeded, report.Status)
+	require.FileExists(t, filepath.Join(outputDir, "svc-a.yaml"))
+	require.FileExists(t, filepath.Join(outputDir, "svc-b.yaml"))
+
+	clone := filepath.Join(clonesDir, "clone-1")
+	require.FileExists(t, filepath.Join(clone, "stable", "svc-a", ".helm", "Chart.yaml"))
+	require.FileExists(t, filepath.Join(clone, "stable", "svc-b", ".helm", "Chart.yaml"))
+	require.NoFileExists(t, filepath.Join(clone, "README.md"))
+	require.NoDirExists(t, filepath.Join(clonesDir, "clone-2"))
+}
+
+// runGit выполняет команду git CLI в директории dir.
+func runGit(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", append([]string{"-c", "protocol.file.allow=always", "-c", "user.name=Test", "-c", "user.email=test@test.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func TestAppRun_Integration_Submodules(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git CLI is required to create submodules")
+	}
+	cmdLogPath, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	clonesDir := filepath.Join(testRootDir, "clones")
+	reposDir := filepath.Join(testRootDir, "repos")
+
+	// Библиотека чартов в отдельном репозитории
+	libDir := filepath.Join(reposDir, "chart-lib")
+	require.NoError(t, os.MkdirAll(libDir, 0755))
+	runGit(t, libDir, "init", "-b", "master")
+	require.NoError(t, os.WriteFile(filepath.Join(libDir, "_helpers.tpl"), []byte("{{- define \"lib\" }}{{- end }}"), 0644))
+	runGit(t, libDir, "add", ".")
+	runGit(t, libDir, "commit", "-m", "lib")
+
+	// Репозиторий сервиса подключает библиотеку по относительному URL
+	productDir := filepath.Join(reposDir, "product")
+	require.NoError(t, os.MkdirAll(filepath.Join(productDir, "stable", "svc", ".helm"), 0755))
+	runGit(t, productDir, "init", "-b", "master")
+	require.NoError(t, os.WriteFile(filepath.Join(productDir, "stable", "svc", ".helm", "Chart.yaml"), []byte("apiVersion: v2\nname: svc\nversion: 1.0.0"), 0644))
+	runGit(t, productDir, "submodule", "add", "../chart-lib", "stable/svc/.helm/charts/lib")
+	runGit(t, productDir, "commit", "-am", "service with lib submodule")
+
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/svc"
+spec:
+  source:
+    targetRevision: master
+`, productDir))
+
+	require.NoError(t, Run(context.Background(), Config{ChartPath: appOfAppsDir, OutputDir: outputDir, Submodules: true, tempDir_: clonesDir}))
+	require.FileExists(t, filepath.Join(clonesDir, "clone-1", "stable", "svc", ".helm", "charts", "lib", "_helpers.tpl"))
+
+	cmdLogContent, err := os.ReadFile(cmdLogPath)
+	require.NoError(t, err)
+	require.Contains(t, string(cmdLogContent), "helm template svc")
+}
+
+func TestAppRun_Integration_Report(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	reportPath := filepath.Join(testRootDir, "report.json")
+
+	fakeRepo := createFakeGitRepoWithFiles(t, map[string]string{
+		"stable/svc-a/.helm/Chart.yaml": "apiVersion: v2\nname: svc-a\nversion: 1.0.0",
+	})
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc-a
+  labels:
+    env: dev
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/svc-a"
+spec:
+  source:
+    targetRevision: master
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc-missing
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/svc-a"
+spec:
+  source:
+    targetRevision: no-such-branch
+`, fakeRepo, fakeRepo))
+
+	cfg := Config{ChartPath: appOfAppsDir, OutputDir: outputDir, ReportFile: reportPath, tempDir_: filepath.Join(testRootDir, "clones")}
+	require.NoError(t, Run(context.Background(), cfg))
+
+	var report Report
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Equal(t, RunCompletedWithError, report.Status)
+	require.Len(t, report.Applications, 2)
+	require.Equal(t, AppRendered, report.Applications[0].Status)
+	require.Equal(t, filepath.Join(outputDir, "dev", "svc-a.yaml"), report.Applications[0].OutputFile)
+	require.Equal(t, AppFailed, report.Applications[1].Status)
+	require.Contains(t, report.Applications[1].Error, "failed to clone repo")
+
+	// Прерванный запуск все равно пишет отчет, а приложения помечаются отмененными
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cfg.OutputDir = filepath.Join(testRootDir, "interrupted")
+	err = Run(ctx, cfg)
+	require.ErrorIs(t, err, context.Canceled)
+
+	data, err = os.ReadFile(reportPath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Equal(t, RunInterrupted, report.Status)
+	require.NoFileExists(t, filepath.Join(cfg.OutputDir, "dev", "svc-a.yaml"))
+}
+
+func TestAppRun_Integration_Validate(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	reportPath := filepath.Join(testRootDir, "report.json")
+	schemaDir := filepath.Join(testRootDir, "schemas")
+	require.NoError(t, os.MkdirAll(filepath.Join(schemaDir, "v1.29.0-standalone-strict"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(schemaDir, "v1.29.0-standalone-strict", "configmap-v1.json"), []byte(`{
+  "type": "object",
+  "properties": {
+    "apiVersion": {"type": "string"},
+    "kind": {"type": "string"},
+    "metadata": {"type": "object"},
+    "data": {"type": "object", "additionalProperties": {"type": "string"}}
+  },
+  "additionalProperties": false
+}`), 0644))
+
+	fakeRepo := createFakeGitRepoWithFiles(t, map[string]string{
+		"stable/crds/.helm/Chart.yaml": "apiVersion: v2\nname: crds\nversion: 1.0.0",
+		"stable/crds/.helm/templates/crd.yaml": `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: backups.example.com
+spec:
+  group: example.com
+  names: {kind: Backup}
+  versions:
+    - name: v1
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec: {type: object, properties: {schedule: {type: string}}}
+`,
+		"stable/svc/.helm/Chart.yaml": "apiVersion: v2\nname: svc\nversion: 1.0.0",
+		"stable/svc/.helm/templates/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: svc
+daat:
+  key: value
+`,
+		"stable/svc/.helm/templates/backup.yaml": `apiVersion: example.com/v1
+kind: Backup
+metadata:
+  name: nightly
+spec:
+  schedule: 5
+`,
+	})
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc
+  annotations:
+    rawRepository: "%[1]s"
+    rawPath: "stable/svc"
+spec:
+  source:
+    targetRevision: master
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: crds
+  annotations:
+    rawRepository: "%[1]s"
+    rawPath: "stable/crds"
+spec:
+  source:
+    targetRevision: master
+`, fakeRepo))
+
+	err := Run(context.Background(), Config{
+		ChartPath:   appOfAppsDir,
+		OutputDir:   outputDir,
+		ReportFile:  reportPath,
+		Validate:    true,
+		KubeVersion: "1.29.0",
+		SchemaDir:   schemaDir,
+		tempDir_:    filepath.Join(testRootDir, "clones"),
+	})
+	require.ErrorContains(t, err, "schema validation failed for 1 applications")
+	// Манифесты записываются и при ошибках валидации
+	require.FileExists(t, filepath.Join(outputDir, "svc.yaml"))
+
+	var report Report
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Equal(t, RunFailed, report.Status)
+	require.Equal(t, AppInvalid, report.Applications[0].Status)
+	require.Equal(t, []ResourceIssues{
+		{Resource: "Backup/nightly", Source: ".helm/templates/backup.yaml", Errors: []string{"spec.schedule: expected string, got integer"}},
+		{Resource: "ConfigMap/svc", Source: ".helm/templates/configmap.yaml", Errors: []string{"daat: unknown field"}},
+	}, report.Applications[0].Validation)
+	require.Equal(t, AppRendered, report.Applications[1].Status)
+}
+
+func TestAppRun_Integration_CheckDeprecations(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	reportPath := filepath.Join(testRootDir, "report.json")
+
+	fakeRepo := createFakeGitRepoWithFiles(t, map[string]string{
+		"stable/svc/.helm/Chart.yaml": "apiVersion: v2\nname: svc\nversion: 1.0.0",
+		"stable/svc/.helm/templates/pdb.yaml": `apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: svc
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: svc
+`,
+	})
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/svc"
+spec:
+  source:
+    targetRevision: master
+`, fakeRepo))
+
+	require.NoError(t, Run(context.Background(), Config{
+		ChartPath:         appOfAppsDir,
+		OutputDir:         filepath.Join(testRootDir, "output"),
+		ReportFile:        reportPath,
+		CheckDeprecations: true,
+		KubeVersion:       "1.25.0",
+		tempDir_:          filepath.Join(testRootDir, "clones"),
+	}))
+
+	var report Report
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Equal(t, RunSucceeded, report.Status)
+	require.Equal(t, []DeprecatedResource{{
+		Resource:     "PodDisruptionBudget/svc",
+		Source:       ".helm/templates/pdb.yaml",
+		APIVersion:   "policy/v1beta1",
+		Status:       "removed",
+		DeprecatedIn: "1.21",
+		RemovedIn:    "1.25",
+		Replacement:  "policy/v1",
+	}}, report.Applications[0].Deprecations)
+}
+
+func TestAppRun_Integration_Policy(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	reportPath := filepath.Join(testRootDir, "report.json")
+	policyPath := filepath.Join(testRootDir, "policy.yaml")
+	require.NoError(t, os.WriteFile(policyPath, []byte(`rules:
+  - name: no-latest-tag
+    severity: error
+    match: {kinds: [Deployment]}
+    assert:
+      path: spec.template.spec.containers[*].image
+      notMatches: ":latest$"
+  - name: resource-limits
+    severity: warning
+    match: {kinds: [Deployment]}
+    assert:
+      path: spec.template.spec.containers[*].resources.limits
+      exists: true
+`), 0644))
+
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:latest
+`
+	fakeRepo := createFakeGitRepoWithFiles(t, map[string]string{
+		"stable/svc-a/.helm/Chart.yaml":                "apiVersion: v2\nname: svc-a\nversion: 1.0.0",
+		"stable/svc-a/.helm/templates/deployment.yaml": deployment,
+		"stable/svc-b/.helm/Chart.yaml":                "apiVersion: v2\nname: svc-b\nversion: 1.0.0",
+		"stable/svc-b/.helm/templates/deployment.yaml": deployment,
+	})
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc-a
+  annotations:
+    rawRepository: "%[1]s"
+    rawPath: "stable/svc-a"
+spec:
+  source:
+    targetRevision: master
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc-b
+  annotations:
+    rawRepository: "%[1]s"
+    rawPath: "stable/svc-b"
+    policyExemptions: no-latest-tag
+spec:
+  source:
+    targetRevision: master
+`, fakeRepo))
+
+	err := Run(context.Background(), Config{
+		ChartPath:   appOfAppsDir,
+		OutputDir:   filepath.Join(testRootDir, "output"),
+		ReportFile:  reportPath,
+		PolicyFiles: []string{policyPath},
+		tempDir_:    filepath.Join(testRootDir, "clones"),
+	})
+	require.EqualError(t, err, "policy check failed for 1 applications")
+
+	var report Report
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &report))
+
+	require.Equal(t, AppPolicyViolation, report.Applications[0].Status)
+	require.Len(t, report.Applications[0].Policy, 2)
+	require.Equal(t, "no-latest-tag", report.Applications[0].Policy[0].Rule)
+	require.False(t, report.Applications[0].Policy[0].Exempt)
+
+	// svc-b освобождено от no-latest-tag, а предупреждения не валят запуск
+	require.Equal(t, AppRendered, report.Applications[1].Status)
+	require.True(t, report.Applications[1].Policy[0].Exempt)
+	require.Equal(t, "warning", report.Applications[1].Policy[1].Severity)
+}
+
+func TestImages_Integration(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	outputDir := filepath.Join(testRootDir, "output")
+
+	fakeRepo := createFakeGitRepoWithFiles(t, map[string]string{
+		"stable/svc/.helm/Chart.yaml": "apiVersion: v2\nname: svc\nversion: 1.0.0",
+		"stable/svc/.helm/templates/workloads.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers: [{name: migrate, image: "registry.example.com/svc:1.0"}]
+      containers:
+        - {name: web, image: "registry.example.com/svc:1.0"}
+        - {name: proxy, image: "envoy@sha256:0123"}
+`,
+	})
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc
+  labels: {env: prod, instance: eu}
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/svc"
+spec:
+  source:
+    targetRevision: master
+`, fakeRepo))
+
+	expected := []ApplicationImages{{
+		Env:         "prod",
+		Instance:    "eu",
+		Application: "svc",
+		Images: []ImageEntry{
+			{
+				Reference: images.Reference{Image: "envoy@sha256:0123", Repository: "envoy", Digest: "sha256:0123"},
+				Pinned:    true,
+				Usages:    []images.Usage{{Resource: "Deployment/web", Container: "proxy", Type: images.ContainerRegular}},
+			},
+			{
+				Reference: images.Reference{Image: "registry.example.com/svc:1.0", Repository: "registry.example.com/svc", Tag: "1.0"},
+				Usages: []images.Usage{
+					{Resource: "Deployment/web", Container: "migrate", Type: images.ContainerInit},
+					{Resource: "Deployment/web", Container: "web", Type: images.ContainerRegular},
+				},
+			},
+		},
+	}}
+
+	result, err := Images(context.Background(), Config{ChartPath: appOfAppsDir, OutputDir: outputDir, tempDir_: filepath.Join(testRootDir, "clones")})
+	require.NoError(t, err)
+	require.Equal(t, expected, result)
+
+	// Повторное использование уже отрендеренных манифестов
+	result, err = ImagesFromDir(outputDir)
+	require.NoError(t, err)
+	require.Equal(t, expected, result)
+}
+
+func TestList_Integration(t *testing.T) {
+	cmdLogPath, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	appOfAppsDir := filepath.Join(t.TempDir(), "app-of-apps-chart")
+	writeAppOfAppsChart(t, appOfAppsDir, `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc-a
+  labels: {env: dev}
+  annotations:
+    rawRepository: "https://git.example.com/svc-a.git"
+    rawPath: "stable/svc-a"
+spec:
+  source:
+    targetRevision: master
+    plugin:
+      env:
+        - {name: WERF_SET_REPLICAS, value: "replicas=2"}
+        - {name: WERF_VALUES_0, value: values-dev.yaml}
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc-b
+  labels: {env: prod}
+  annotations:
+    rawRepository: "https://git.example.com/svc-b.git"
+spec:
+  source:
+    targetRevision: master
+`)
+
+	result, err := List(context.Background(), Config{ChartPath: appOfAppsDir, Filters: []string{"metadata.labels.env==dev"}})
+	require.NoError(t, err)
+	require.Equal(t, &ListResult{
+		Applications: []ListedApplication{{
+			Name:           "svc-a",
+			Env:            "dev",
+			RepoURL:        "https://git.example.com/svc-a.git",
+			Path:           "stable/svc-a",
+			TargetRevision: "master",
+			SetterCount:    1,
+			ValuesFiles:    []string{"values-dev.yaml"},
+			Source:         "document 1",
+		}},
+		Skipped: []argo.SkippedApplication{{Name: "svc-b", Filter: "metadata.labels.env==dev", Value: "prod", Found: true, Source: "document 2"}},
+	}, result)
+
+	// Рендерится только app-of-apps
+	logContent, err := os.ReadFile(cmdLogPath)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(logContent), "helm template"))
+}
+
+func TestExplain_Integration(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	repoPath := createFakeGitRepoWithFiles(t, map[string]string{
+		"stable/team/svc/werf.yaml":          "project: svc\nconfigVersion: 1\ndeploy:\n  helmRelease: svc-[[ env ]]\n",
+		"stable/team/svc/.helm/Chart.yaml":   "apiVersion: v2\nname: svc\nversion: 1.0.0",
+		"stable/team/svc/values/common.yaml": "replicas: 1\n",
+	})
+	appOfAppsDir := filepath.Join(t.TempDir(), "app-of-apps-chart")
+	writeAppOfAppsChart(t, appOfAppsDir, `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc
+  labels: {env: dev}
+  annotations:
+    rawRepository: "https://git.nvfn.ru/deploy/team/svc.git"
+spec:
+  source:
+    targetRevision: master
+    plugin:
+      env:
+        - {name: WERF_SET_INSTANCE, value: "global.instance=eu"}
+        - {name: WERF_VALUES_0, value: values/common.yaml}
+`)
+
+	cfg := Config{
+		ChartPath:     appOfAppsDir,
+		Mirror:        true,
+		Filters:       []string{"metadata.labels.env==prod"},
+		RepoOverrides: map[string]string{"https://git.uis.dev/deploy/product.git": repoPath},
+	}
+	explanations, err := Explain(context.Background(), cfg, "svc")
+	require.NoError(t, err)
+	require.Len(t, explanations, 1)
+	explanation := explanations[0]
+
+	require.Equal(t, "dev/eu/svc", explanation.OutputPath)
+	require.Contains(t, explanation.Manifest, "name: svc")
+	require.Equal(t, &argo.SkippedApplication{Name: "svc", Filter: "metadata.labels.env==prod", Value: "dev", Found: true, Source: "document 1"}, explanation.Skipped)
+	require.Equal(t, argo.SourceEnvLabel, explanation.Env.Source)
+	require.Equal(t, argo.SourceInstancePlugin, explanation.Instance.Source)
+	require.Equal(t, argo.SourceRawRepository, explanation.RepoURL.Source)
+	require.Equal(t, argo.SourceDefault, explanation.Path.Source)
+	require.Equal(t, &MirrorRewrite{
+		FromRepoURL: "https://git.nvfn.ru/deploy/team/svc.git",
+		FromPath:    ".",
+		ToRepoURL:   "https://git.uis.dev/deploy/product.git",
+		ToPath:      filepath.Join("stable", "team", "svc"),
+	}, explanation.Mirror)
+
+	// Репозиторий подменен локальной копией, коммит берется из нее
+	require.Equal(t, repoPath, explanation.Override)
+	require.Equal(t, CommitFromOverride, explanation.CommitSource)
+	require.Len(t, explanation.Commit, 40)
+
+	servicePath := filepath.Join(repoPath, "stable", "team", "svc")
+	require.Equal(t, []string{
+		"helm", "template", "svc-dev", filepath.Join(servicePath, ".helm"),
+		"--values", filepath.Join(servicePath, "values", "common.yaml"),
+		"--set", "global.env=dev",
+		"--set", "global.instance=eu",
+	}, explanation.HelmCommand)
+
+	_, err = Explain(context.Background(), cfg, "missing")
+	require.ErrorContains(t, err, "application 'missing' not found")
+
+	// Приложения с тем же именем показываются все, а не только первое
+	writeAppOfAppsChart(t, appOfAppsDir, `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc
+  labels: {env: dev}
+spec:
+  source:
+    repoURL: https://git.uis.dev/deploy/product.git
+    path: stable/team/svc
+    targetRevision: master
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc
+  labels: {env: prod}
+spec:
+  source:
+    repoURL: https://git.uis.dev/deploy/product.git
+    path: stable/team/svc
+    targetRevision: master
+`)
+	cfg.Filters = nil
+	explanations, err = Explain(context.Background(), cfg, "svc")
+	require.NoError(t, err)
+	require.Len(t, explanations, 2)
+	require.Equal(t, "dev/svc", explanations[0].OutputPath)
+	require.Equal(t, "prod/svc", explanations[1].OutputPath)
+	for _, explanation := range explanations {
+		require.NotEmpty(t, explanation.HelmCommand)
+	}
+}
+
+func TestAppRun_Integration_AppFiles(t *testing.T) {
+	cmdLogPath, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	fakeRepoPath := createFakeGitRepo(t)
+
+	// Один файл - Application, другой - вывод "kubectl get applications -o yaml"
+	appFile := filepath.Join(testRootDir, "app.yaml")
+	require.NoError(t, os.WriteFile(appFile, []byte(fmt.Sprintf(`apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: from-file
+  labels: {env: dev}
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/my-service"
+spec:
+  source:
+    targetRevision: master
+`, fakeRepoPath)), 0644))
+	listFile := filepath.Join(testRootDir, "apps.yaml")
+	require.NoError(t, os.WriteFile(listFile, []byte(fmt.Sprintf(`apiVersion: v1
+kind: List
+items:
+  - apiVersion: argoproj.io/v1alpha1
+    kind: Application
+    metadata:
+      name: from-list
+      labels: {env: prod}
+      annotations:
+        rawRepository: "%s"
+        rawPath: "stable/my-service"
+    spec:
+      source:
+        targetRevision: master
+`, fakeRepoPath)), 0644))
+
+	cfg := Config{AppFiles: []string{appFile, listFile}, OutputDir: outputDir}
+	require.NoError(t, Run(context.Background(), cfg))
+	require.FileExists(t, filepath.Join(outputDir, "dev", "from-file.yaml"))
+	require.FileExists(t, filepath.Join(outputDir, "prod", "from-list.yaml"))
+
+	// app-of-apps не рендерится
+	cmdLogContent, err := os.ReadFile(cmdLogPath)
+	require.NoError(t, err)
+	require.NotContains(t, string(cmdLogContent), "helm template app-of-apps")
+	require.Equal(t, 2, strings.Count(string(cmdLogContent), "helm template"))
+}
+
+func TestAppRun_Integration_DuplicateNames(t *testing.T) {
+	cmdLogPath, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	fakeRepoPath := createFakeGitRepo(t)
+
+	// Три Application с одним именем из разных файлов: два в dev, одно в prod
+	appFiles := make(map[string]string)
+	for name, env := range map[string]string{"a.yaml": "dev", "b.yaml": "dev", "c.yaml": "prod"} {
+		appFile := filepath.Join(testRootDir, name)
+		require.NoError(t, os.WriteFile(appFile, []byte(fmt.Sprintf(`# Source: app-of-apps/templates/%s
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+  labels: {env: %s}
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/my-service"
+spec:
+  source:
+    targetRevision: master
+`, name, env, fakeRepoPath)), 0644))
+		appFiles[name] = appFile
+	}
+
+	// Одинаковое имя в разных env пишется в разные файлы и ошибкой не считается
+	cfg := Config{AppFiles: []string{appFiles["a.yaml"], appFiles["c.yaml"]}, OutputDir: outputDir}
+	require.NoError(t, Run(context.Background(), cfg))
+	require.FileExists(t, filepath.Join(outputDir, "dev", "web.yaml"))
+	require.FileExists(t, filepath.Join(outputDir, "prod", "web.yaml"))
+
+	// По умолчанию совпадение пути вывода - ошибка с обоими источниками, ничего не рендерится
+	require.NoError(t, os.RemoveAll(outputDir))
+	cfg.AppFiles = []string{appFiles["a.yaml"], appFiles["b.yaml"], appFiles["c.yaml"]}
+	err := Run(context.Background(), cfg)
+	require.ErrorContains(t, err, "duplicate application 'web' with output path 'dev/web': defined in app-of-apps/templates/a.yaml (document 1) and app-of-apps/templates/b.yaml (document 1)")
+	require.NoFileExists(t, filepath.Join(outputDir, "dev", "web.yaml"))
+
+	// С суффиксом второе приложение пишется в отдельный файл, имя релиза не меняется
+	require.NoError(t, os.Truncate(cmdLogPath, 0))
+	cfg.OnDuplicate = argo.DuplicateSuffix
+	require.NoError(t, Run(context.Background(), cfg))
+	require.FileExists(t, filepath.Join(outputDir, "dev", "web.yaml"))
+	require.FileExists(t, filepath.Join(outputDir, "dev", "web-2.yaml"))
+	require.FileExists(t, filepath.Join(outputDir, "prod", "web.yaml"))
+	cmdLogContent, err := os.ReadFile(cmdLogPath)
+	require.NoError(t, err)
+	require.Equal(t, 3, strings.Count(string(cmdLogContent), "helm template web "))
+	require.NotContains(t, string(cmdLogContent), "web-2")
+}
+
+func TestAppRun_Integration_TarOutput(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	archivePath := filepath.Join(testRootDir, "rendered.tar")
+	reportPath := filepath.Join(testRootDir, "report.json")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	fakeRepoPath := createFakeGitRepo(t)
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: my-service
+  labels: {env: dev, instance: inf1}
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/my-service"
+spec:
+  source:
+    targetRevision: master
+`, fakeRepoPath))
+
+	cfg := Config{ChartPath: appOfAppsDir, OutputDir: archivePath, OutputFormat: output.FormatYAML, OutputArchive: true, ReportFile: reportPath}
+	require.NoError(t, Run(context.Background(), cfg))
+
+	file, err := os.Open(archivePath)
+	require.NoError(t, err)
+	defer file.Close()
+	tr := tar.NewReader(file)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+	}
+	require.Equal(t, []string{"dev/", "dev/inf1/", "dev/inf1/my-service.yaml"}, names)
+
+	// В отчете - путь внутри архива
+	var report Report
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Equal(t, "dev/inf1/my-service.yaml", report.Applications[0].OutputFile)
+}
+
+func TestAppRun_Integration_JSONOutput(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	fakeRepoPath := createFakeGitRepo(t)
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: my-service
+  labels: {env: dev}
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/my-service"
+spec:
+  source:
+    targetRevision: master
+`, fakeRepoPath))
+
+	cfg := Config{ChartPath: appOfAppsDir, OutputDir: outputDir, OutputFormat: output.FormatJSON}
+	require.NoError(t, Run(context.Background(), cfg))
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "dev", "my-service.json"))
+	require.NoError(t, err)
+	var resources []map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &resources))
+	require.Len(t, resources, 1)
+	require.Equal(t, "FakedHelmOutputForApp", resources[0]["kind"])
+}
+
+func TestGenerateCMP_Integration(t *testing.T) {
+	cmdLogPath, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	// Директория исходников приложения, как ее видит CMP-плагин
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".helm", "templates"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".helm", "Chart.yaml"), []byte("apiVersion: v2\nname: web\nversion: 1.0.0"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".helm", "templates", "cm.yaml"), []byte("kind: ConfigMap\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "values-dev.yaml"), []byte("replicas: 1\n"), 0644))
+
+	environ := []string{
+		"ARGOCD_APP_NAME=dev-web",
+		"ARGOCD_APP_NAMESPACE=web",
+		"ARGOCD_APP_SOURCE_REPO_URL=https://git.example.com/org/web.git",
+		"ARGOCD_APP_SOURCE_TARGET_REVISION=main",
+		"ARGOCD_ENV_WERF_SET_ENV=global.env=dev",
+		"ARGOCD_ENV_WERF_VALUES_0=values-dev.yaml",
+	}
+	var out strings.Builder
+	require.NoError(t, GenerateCMP(context.Background(), Config{}, dir, environ, &out))
+	require.Contains(t, out.String(), "# Source: .helm/templates/cm.yaml")
+	require.Contains(t, out.String(), "kind: ConfigMap")
+
+	cmdLogContent, err := os.ReadFile(cmdLogPath)
+	require.NoError(t, err)
+	require.Contains(t, string(cmdLogContent), fmt.Sprintf("helm template dev-web %s --namespace web --values %s --set global.env=dev",
+		filepath.Join(dir, ".helm"), filepath.Join(dir, "values-dev.yaml")))
+}
+
+func TestServer_Integration(t *testing.T) {
+	cmdLogPath, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	// Сервер клонирует только удаленные репозитории, поэтому раздаем его по HTTPS
+	reposDir := t.TempDir()
+	require.NoError(t, os.Symlink(createFakeGitRepo(t), filepath.Join(reposDir, "my-service.git")))
+	serveGitRepos(t, reposDir)
+	application := `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: dev-my-service
+  labels: {env: dev}
+  annotations:
+    rawRepository: "https://git.example.com/my-service.git"
+    rawPath: "stable/my-service"
+spec:
+  source:
+    targetRevision: master
+`
+	appOfAppsDir := filepath.Join(t.TempDir(), "app-of-apps-chart")
+	writeAppOfAppsChart(t, appOfAppsDir, application)
+
+	cfg := Config{ChartPath: appOfAppsDir}
+	cfg.Git.Transport = "https"
+	server, err := NewServer(cfg, ServeOptions{MaxConcurrent: 2, RequestTimeout: time.Minute, AllowedHosts: []string{"git.example.com"}})
+	require.NoError(t, err)
+	defer server.Close()
+	api := httptest.NewServer(server)
+	defer api.Close()
+
+	// Рендеринг Application из тела запроса
+	resp, err := http.Post(api.URL+"/render", "application/yaml", strings.NewReader(application))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	require.Equal(t, "application/yaml", resp.Header.Get("Content-Type"))
+	require.Contains(t, string(body), "# Application: dev-my-service")
+	require.Contains(t, string(body), "kind: FakedHelmOutputForApp")
+
+	// Локальные репозитории и хосты не из --allowed-host отклоняются
+	for _, repoURL := range []string{createFakeGitRepo(t), "https://other.example.com/my-service.git"} {
+		resp, err = http.Post(api.URL+"/render", "application/yaml", strings.NewReader(strings.Replace(application, "https://git.example.com/my-service.git", repoURL, 1)))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusForbidden, resp.StatusCode, repoURL)
+	}
+
+	// То же приложение из app-of-apps в JSON
+	resp, err = http.Get(api.URL + "/apps/dev-my-service/manifest?format=json")
+	require.NoError(t, err)
+	var rendered struct {
+		Application string                   `json:"application"`
+		Resources   []map[string]interface{} `json:"resources"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rendered))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "dev-my-service", rendered.Application)
+	require.Equal(t, "FakedHelmOutputForApp", rendered.Resources[0]["kind"])
+
+	// Репозиторий клонирован один раз на оба запроса
+	entries, err := os.ReadDir(server.tempDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	cmdLogContent, err := os.ReadFile(cmdLogPath)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(cmdLogContent), "helm template app-of-apps"))
+	require.Equal(t, 2, strings.Count(string(cmdLogContent), "helm template dev-my-service"))
+}
+
+func TestServer_Integration_CloneTTL(t *testing.T) {
+	_, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	fakeRepoPath := createFakeGitRepo(t)
+	appOfAppsDir := filepath.Join(t.TempDir(), "app-of-apps-chart")
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(`
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: dev-my-service
+  labels: {env: dev}
+  annotations:
+    rawRepository: "%s"
+    rawPath: "stable/my-service"
+spec:
+  source:
+    targetRevision: master
+`, fakeRepoPath))
+
+	server, err := NewServer(Config{ChartPath: appOfAppsDir}, ServeOptions{MaxConcurrent: 1, CloneTTL: 500 * time.Millisecond, MaxClones: 1})
+	require.NoError(t, err)
+	defer server.Close()
+	api := httptest.NewServer(server)
+	defer api.Close()
+
+	manifest := func() string {
+		t.Helper()
+		resp, err := http.Get(api.URL + "/apps/dev-my-service/manifest")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		return string(body)
+	}
+	require.Contains(t, manifest(), "kind: FakedHelmOutputForApp")
+
+	// Новый коммит в ветке: добавляем шаблон в чарт
+	templatesDir := filepath.Join(fakeRepoPath, "stable", "my-service", ".helm", "templates")
+	require.NoError(t, os.MkdirAll(templatesDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(templatesDir, "cm.yaml"), []byte("kind: ConfigMap\nmetadata: {name: my-service}\n"), 0644))
+	r, err := git.PlainOpen(fakeRepoPath)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	_, err = w.Add(".")
+	require.NoError(t, err)
+	_, err = w.Commit("Add ConfigMap", &git.CommitOptions{Author: &object.Signature{Name: "Test Author", Email: "test@example.com"}})
+	require.NoError(t, err)
+
+	// Пока клон не устарел, используется прежний коммит
+	require.Contains(t, manifest(), "kind: FakedHelmOutputForApp")
+
+	// После CloneTTL репозиторий клонируется заново, старый клон удаляется
+	time.Sleep(600 * time.Millisecond)
+	require.Contains(t, manifest(), "kind: ConfigMap")
+	entries, err := os.ReadDir(server.tempDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+// syncBuffer - буфер для вывода, который читается из теста во время работы Watch
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatch_Integration(t *testing.T) {
+	cmdLogPath, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+
+	// Две локальные рабочие копии; шаблоны первой меняются во время наблюдения
+	webDir := filepath.Join(testRootDir, "web")
+	apiDir := filepath.Join(testRootDir, "api")
+	for _, dir := range []string{webDir, apiDir} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, ".helm", "templates"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".helm", "Chart.yaml"), []byte("apiVersion: v2\nname: svc\nversion: 1.0.0"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".helm", "templates", "cm.yaml"), []byte("kind: ConfigMap\nmetadata: {name: cm}\ndata: {a: '1'}\n"), 0644))
+	}
+	appTemplate := `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: %[1]s
+  labels: {env: dev}
+  annotations:
+    rawRepository: "https://git.example.com/org/%[1]s.git"
+spec:
+  source:
+    targetRevision: master
+`
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(appTemplate, "web")+"---"+fmt.Sprintf(appTemplate, "api"))
+
+	cfg := Config{
+		ChartPath: appOfAppsDir,
+		OutputDir: outputDir,
+		RepoOverrides: map[string]string{
+			"https://git.example.com/org/web.git": webDir,
+			"https://git.example.com/org/api.git": apiDir,
+		},
+	}
+	var out syncBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(ctx, cfg, WatchOptions{PollInterval: 20 * time.Millisecond, Out: &out})
+	}()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+	require.Eventually(t, func() bool { return strings.Contains(out.String(), "Watching 2 applications") }, 5*time.Second, 10*time.Millisecond)
+	require.FileExists(t, filepath.Join(outputDir, "dev", "web.yaml"))
+
+	// Изменение чарта web перерендеривает только web
+	require.NoError(t, os.WriteFile(filepath.Join(webDir, ".helm", "templates", "cm.yaml"),
+		[]byte("kind: ConfigMap\nmetadata: {name: cm}\ndata: {a: '2'}\n---\nkind: Secret\nmetadata: {name: token}\n"), 0644))
+	require.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "~ web: +Secret/token ~ConfigMap/cm")
+	}, 5*time.Second, 10*time.Millisecond, out.String())
+	data, err := os.ReadFile(filepath.Join(outputDir, "dev", "web.yaml"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "kind: Secret")
+
+	cmdLogContent, err := os.ReadFile(cmdLogPath)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(cmdLogContent), "helm template web "))
+	require.Equal(t, 1, strings.Count(string(cmdLogContent), "helm template api "))
+
+	// Удаление приложения из app-of-apps
+	writeAppOfAppsChart(t, appOfAppsDir, fmt.Sprintf(appTemplate, "web"))
+	require.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "- api: application removed")
+	}, 5*time.Second, 10*time.Millisecond, out.String())
+}
+
+func TestAppRun_Integration_RenderCache(t *testing.T) {
+	cmdLogPath, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	outputDir := filepath.Join(testRootDir, "output")
+	reportPath := filepath.Join(testRootDir, "report.json")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	localDir := filepath.Join(testRootDir, "web")
+	require.NoError(t, os.MkdirAll(filepath.Join(localDir, ".helm", "templates"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, ".helm", "Chart.yaml"), []byte("apiVersion: v2\nname: web\nversion: 1.0.0\ndependencies:\n  - name: lib\n    version: 1.0.0\n    repository: file://../lib\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, ".helm", "templates", "cm.yaml"), []byte("kind: ConfigMap\nmetadata: {name: web}\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "values-dev.yaml"), []byte("replicas: 1\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(localDir, "lib", "templates"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "lib", "Chart.yaml"), []byte("apiVersion: v2\nname: lib\nversion: 1.0.0\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "lib", "templates", "_helpers.tpl"), []byte(`{{ define "lib.replicas" }}1{{ end }}`), 0644))
+	writeAppOfAppsChart(t, appOfAppsDir, `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+  labels: {env: dev}
+  annotations:
+    rawRepository: "https://git.example.com/org/web.git"
+spec:
+  source:
+    targetRevision: master
+    plugin:
+      env:
+        - {name: WERF_VALUES_0, value: values-dev.yaml}
+`)
+
+	cfg := Config{
+		ChartPath:     appOfAppsDir,
+		OutputDir:     outputDir,
+		OutputFormat:  output.FormatJSON,
+		ReportFile:    reportPath,
+		RepoOverrides: map[string]string{"https://git.example.com/org/web.git": localDir},
+	}
+	renders := func() int {
+		cmdLogContent, err := os.ReadFile(cmdLogPath)
+		require.NoError(t, err)
+		return strings.Count(string(cmdLogContent), "helm template web ")
+	}
+	readReport := func() Report {
+		data, err := os.ReadFile(reportPath)
+		require.NoError(t, err)
+		var report Report
+		require.NoError(t, json.Unmarshal(data, &report))
+		return report
+	}
+
+	require.NoError(t, Run(context.Background(), cfg))
+	require.Equal(t, 1, renders())
+	require.FileExists(t, filepath.Join(outputDir, renderCacheFile))
+	require.Equal(t, &CacheStats{Misses: 1}, readReport().Cache)
+
+	// Входы не изменились: helm не вызывается, манифест берется из вывода
+	require.NoError(t, Run(context.Background(), cfg))
+	require.Equal(t, 1, renders())
+	report := readReport()
+	require.Equal(t, &CacheStats{Hits: 1}, report.Cache)
+	require.True(t, report.Applications[0].Cached)
+	require.Equal(t, filepath.Join(outputDir, "dev", "web.json"), report.Applications[0].OutputFile)
+
+	// Изменение values-файла приводит к повторному рендерингу
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "values-dev.yaml"), []byte("replicas: 2\n"), 0644))
+	require.NoError(t, Run(context.Background(), cfg))
+	require.Equal(t, 2, renders())
+
+	// Как и изменение зависимости file://../lib вне директории чарта
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "lib", "templates", "_helpers.tpl"), []byte(`{{ define "lib.replicas" }}2{{ end }}`), 0644))
+	require.NoError(t, Run(context.Background(), cfg))
+	require.Equal(t, 3, renders())
+	require.Equal(t, &CacheStats{Misses: 1}, readReport().Cache)
+
+	// И появление werf.yaml в директории сервиса
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "werf.yaml"), []byte("project: web\nconfigVersion: 1\n"), 0644))
+	require.NoError(t, Run(context.Background(), cfg))
+	require.Equal(t, 4, renders())
+
+	// Обновление helm приводит к повторному рендерингу
+	t.Setenv("FAKE_HELM_VERSION", "v3.15.0+gc4e37b3")
+	require.NoError(t, Run(context.Background(), cfg))
+	require.Equal(t, 5, renders())
+	require.NoError(t, Run(context.Background(), cfg))
+	require.Equal(t, 5, renders())
+
+	// --force рендерит заново, даже если входы не изменились
+	cfg.Force = true
+	require.NoError(t, Run(context.Background(), cfg))
+	require.Equal(t, 6, renders())
+	require.Equal(t, &CacheStats{Misses: 1}, readReport().Cache)
+}
+
+func TestAppRun_Integration_MissingValuesFile(t *testing.T) {
+	cmdLogPath, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	testRootDir := t.TempDir()
+	reportPath := filepath.Join(testRootDir, "report.json")
+	appOfAppsDir := filepath.Join(testRootDir, "app-of-apps-chart")
+	localDir := filepath.Join(testRootDir, "web")
+	require.NoError(t, os.MkdirAll(filepath.Join(localDir, ".helm"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, ".helm", "Chart.yaml"), []byte("apiVersion: v2\nname: web\nversion: 1.0.0"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "values.yaml"), []byte("replicas: 1\n"), 0644))
+	writeAppOfAppsChart(t, appOfAppsDir, `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+  annotations:
+    rawRepository: "https://git.example.com/org/web.git"
+spec:
+  source:
+    targetRevision: master
+    plugin:
+      env:
+        - {name: WERF_VALUES_0, value: values.yaml}
+        - {name: WERF_VALUES_1, value: values-dve.yaml}
+`)
+	cfg := Config{
+		ChartPath:     appOfAppsDir,
+		OutputDir:     filepath.Join(testRootDir, "output"),
+		ReportFile:    reportPath,
+		RepoOverrides: map[string]string{"https://git.example.com/org/web.git": localDir},
+	}
+
+	// Отсутствующий файл: helm не вызывается, в отчете видно переменную
+	require.NoError(t, Run(context.Background(), cfg))
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	var report Report
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Equal(t, AppFailed, report.Applications[0].Status)
+	require.Equal(t, "document 1", report.Applications[0].Source)
+	require.Equal(t, []ValuesFileReport{
+		{Var: "WERF_VALUES_0", Path: "values.yaml"},
+		{Var: "WERF_VALUES_1", Path: "values-dve.yaml"},
+	}, report.Applications[0].ValuesFiles)
+	require.Contains(t, report.Applications[0].Error, "WERF_VALUES_1=values-dve.yaml")
+	cmdLogContent, err := os.ReadFile(cmdLogPath)
+	require.NoError(t, err)
+	require.NotContains(t, string(cmdLogContent), "helm template web ")
+
+	// С --ignore-missing-values файл пропускается
+	cfg.IgnoreMissingValues = true
+	require.NoError(t, Run(context.Background(), cfg))
+	cmdLogContent, err = os.ReadFile(cmdLogPath)
+	require.NoError(t, err)
+	require.Contains(t, string(cmdLogContent), fmt.Sprintf("helm template web %s --values %s\n",
+		filepath.Join(localDir, ".helm"), filepath.Join(localDir, "values.yaml")))
+}
@@ -1,8 +1,20 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/git"
+	"roar/internal/pkg/images"
+	"roar/internal/pkg/logger"
+	"roar/internal/pkg/output"
+
 	"github.com/stretchr/testify/require"
 )
 
@@ -127,3 +139,317 @@ func TestApplyMirrorTransform(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeRepoURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputURL string
+		wantURL  string
+	}{
+		{name: "https with .git", inputURL: "https://gitlab.com/org/repo.git", wantURL: "git@gitlab.com:org/repo"},
+		{name: "https without .git", inputURL: "https://gitlab.com/org/repo", wantURL: "git@gitlab.com:org/repo"},
+		{name: "ssh form", inputURL: "git@gitlab.com:org/repo.git", wantURL: "git@gitlab.com:org/repo"},
+		{name: "host case and trailing slash", inputURL: "https://GitLab.com/org/repo/", wantURL: "git@gitlab.com:org/repo"},
+		{name: "local path", inputURL: "/tmp/repo", wantURL: "/tmp/repo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.wantURL, normalizeRepoURL(tt.inputURL))
+		})
+	}
+}
+
+func TestParseRepoOverride(t *testing.T) {
+	repoURL, dir, err := ParseRepoOverride("https://gitlab.com/org/repo.git=../repo")
+	require.NoError(t, err)
+	require.Equal(t, "https://gitlab.com/org/repo.git", repoURL)
+	require.Equal(t, "../repo", dir)
+
+	for _, invalid := range []string{"https://gitlab.com/org/repo.git", "=../repo", "https://gitlab.com/org/repo.git="} {
+		_, _, err := ParseRepoOverride(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestConvertSSHtoHTTPS(t *testing.T) {
+	tests := []struct {
+		inputURL string
+		wantURL  string
+	}{
+		{inputURL: "git@gitlab.com:my-org/my-repo.git", wantURL: "https://gitlab.com/my-org/my-repo.git"},
+		{inputURL: "ssh://git@gitlab.com:2222/my-org/my-repo.git", wantURL: "https://gitlab.com/my-org/my-repo.git"},
+		{inputURL: "https://gitlab.com/my-org/my-repo.git", wantURL: "https://gitlab.com/my-org/my-repo.git"},
+		{inputURL: "/tmp/local-repo", wantURL: "/tmp/local-repo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.inputURL, func(t *testing.T) {
+			require.Equal(t, tt.wantURL, convertSSHtoHTTPS(tt.inputURL))
+		})
+	}
+}
+
+func TestRemoteFor(t *testing.T) {
+	t.Setenv(git.DefaultTokenEnv, "")
+	t.Setenv("NETRC", "")
+	t.Setenv("HOME", t.TempDir())
+
+	state := &appState{creds: &git.Credentials{
+		Hosts: map[string]git.HostCredentials{"git.example.com": {Transport: git.TransportHTTPS}},
+	}}
+
+	// По умолчанию https-адрес по-прежнему превращается в SSH
+	remote, err := state.remoteFor("https://gitlab.com/org/repo.git")
+	require.NoError(t, err)
+	require.Equal(t, "git@gitlab.com:org/repo.git", remote.URL)
+
+	// Для хоста с транспортом https адрес остается https, даже если задан как SSH
+	remote, err = state.remoteFor("git@git.example.com:org/repo.git")
+	require.NoError(t, err)
+	require.Equal(t, "https://git.example.com/org/repo.git", remote.URL)
+	require.Nil(t, remote.Auth)
+}
+
+func TestCollectSparseDirs(t *testing.T) {
+	applications := []argo.Application{
+		{Name: "a", RepoURL: "repo", TargetRevision: "master", Path: "stable/svc-a", ValuesFiles: []string{".helm/values.yaml", "../common/values.yaml"}},
+		{Name: "b", RepoURL: "repo", TargetRevision: "master", Path: "stable/svc-b/"},
+		{Name: "c", RepoURL: "repo", TargetRevision: "dev", Path: "stable/svc-c"},
+		{Name: "d", RepoURL: "repo", TargetRevision: "dev", Path: "."},
+		{Name: "e", RepoURL: "other", TargetRevision: "master", Path: "svc", ValuesFiles: []string{"../../outside.yaml"}},
+		{Name: "f", RepoURL: "https://git.example.com/org/mono.git", TargetRevision: "master", Path: "svc-f"},
+		{Name: "g", RepoURL: "git@git.example.com:org/mono.git", TargetRevision: "master", Path: "svc-g"},
+	}
+
+	dirs := collectSparseDirs(applications)
+	require.Equal(t, map[string][]string{
+		"repo@master":                         {"stable/common", "stable/svc-a", "stable/svc-a/.helm", "stable/svc-b"},
+		"git@git.example.com:org/mono@master": {"svc-f", "svc-g"},
+	}, dirs)
+}
+
+func TestReport_Finish(t *testing.T) {
+	tests := []struct {
+		name   string
+		apps   []ApplicationReport
+		err    error
+		status string
+	}{
+		{name: "all rendered", apps: []ApplicationReport{{Name: "a", Status: AppRendered}}, status: RunSucceeded},
+		{name: "render failed", apps: []ApplicationReport{{Name: "a", Status: AppRendered}, {Name: "b", Status: AppRenderFailed}}, status: RunCompletedWithError},
+		{name: "run failed", err: errors.New("boom"), status: RunFailed},
+		{name: "interrupted", apps: []ApplicationReport{{Name: "a", Status: AppCancelled}}, err: fmt.Errorf("run interrupted: %w", context.Canceled), status: RunInterrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newReport()
+			report.Applications = tt.apps
+			report.finish(tt.err)
+			require.Equal(t, tt.status, report.Status)
+			if tt.err != nil {
+				require.Equal(t, tt.err.Error(), report.Error)
+			}
+		})
+	}
+}
+
+func TestReadAppFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("kind: Application\nmetadata: {name: from-file}"), 0644))
+
+	data, err := readAppFiles([]string{file, "-"}, strings.NewReader("kind: Application\nmetadata: {name: from-stdin}\n"))
+	require.NoError(t, err)
+	require.Equal(t, "---\n# Source: "+file+"\nkind: Application\nmetadata: {name: from-file}\n---\n# Source: stdin\nkind: Application\nmetadata: {name: from-stdin}\n\n", string(data))
+
+	_, err = readAppFiles([]string{"-", "-"}, strings.NewReader(""))
+	require.ErrorContains(t, err, "only once")
+
+	_, err = readAppFiles([]string{filepath.Join(dir, "missing.yaml")}, nil)
+	require.ErrorContains(t, err, "failed to read application file")
+}
+
+func TestCheckValuesFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "common.yaml"), []byte("a: 1"), 0644))
+	app := argo.Application{
+		Name:           "web",
+		ValuesFiles:    []string{"common.yaml", "dev.yaml"},
+		ValuesFileVars: []string{"WERF_VALUES_0", "WERF_VALUES_3"},
+	}
+	paths := []string{filepath.Join(dir, "common.yaml"), filepath.Join(dir, "dev.yaml")}
+	logCtx := logger.Log.WithField("application", app.Name)
+
+	_, err := checkValuesFiles(app, paths, false, logCtx)
+	require.EqualError(t, err, fmt.Sprintf("missing values files: WERF_VALUES_3=dev.yaml (%s); use --ignore-missing-values to skip them", paths[1]))
+
+	existing, err := checkValuesFiles(app, paths, true, logCtx)
+	require.NoError(t, err)
+	require.Equal(t, paths[:1], existing)
+}
+
+func TestLoadFileConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "roar.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+repoOverrides:
+  https://git.example.com/org/web.git: ../web
+  https://git.example.com/org/api.git: /src/api
+git:
+  netrcFile: secrets/netrc
+  hosts:
+    git.example.com:
+      sshKeyFile: keys/id_ed25519
+      knownHostsFile: ~/.ssh/known_hosts
+`), 0644))
+
+	fileCfg, err := LoadFileConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"https://git.example.com/org/web.git": filepath.Join(dir, "../web"),
+		"https://git.example.com/org/api.git": "/src/api",
+	}, fileCfg.RepoOverrides)
+	require.Equal(t, filepath.Join(dir, "secrets/netrc"), fileCfg.Git.NetrcFile)
+	host := fileCfg.Git.Hosts["git.example.com"]
+	require.Equal(t, filepath.Join(dir, "keys/id_ed25519"), host.SSHKeyFile)
+	require.Equal(t, "~/.ssh/known_hosts", host.KnownHostsFile)
+}
+
+func TestParseManifests(t *testing.T) {
+	newResults := func() []ApplicationReport {
+		return []ApplicationReport{
+			{Name: "broken", Status: AppRendered, manifest: []byte("kind: [ConfigMap\n")},
+			{Name: "ok", Status: AppRendered, manifest: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata: {name: ok}\n")},
+		}
+	}
+
+	// Без --validate ошибка разбора только пишется в лог
+	results := newResults()
+	parsed := parseManifests(results, false)
+	require.Equal(t, AppRendered, results[0].Status)
+	require.Empty(t, results[0].Validation)
+	require.Nil(t, parsed[0])
+	require.Len(t, parsed[1], 1)
+
+	results = newResults()
+	parseManifests(results, true)
+	require.Equal(t, AppInvalid, results[0].Status)
+	require.Len(t, results[0].Validation, 1)
+	require.Equal(t, AppRendered, results[1].Status)
+}
+
+func TestLoadLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roar.lock")
+	require.NoError(t, os.WriteFile(path, []byte(`version: 1
+repositories:
+  - repository: https://git.example.com/org/web.git
+    revision: master
+    commit: abc123
+  - repository: git@git.example.com:org/api.git
+    revision: master
+    commit: def456
+`), 0644))
+
+	lockFile, err := loadLockFile(path, true)
+	require.NoError(t, err)
+
+	// Любое написание адреса находит одну и ту же запись, как и клон
+	for _, repoURL := range []string{"https://git.example.com/org/web.git", "git@git.example.com:org/web.git", "https://git.example.com/org/web"} {
+		commit, ok := lockFile.Get(normalizeRepoURL(repoURL), "master")
+		require.True(t, ok, repoURL)
+		require.Equal(t, "abc123", commit)
+	}
+	commit, ok := lockFile.Get(normalizeRepoURL("https://git.example.com/org/api.git"), "master")
+	require.True(t, ok)
+	require.Equal(t, "def456", commit)
+
+	// Записи при разрешении коммитов тоже нормализуются
+	lockFile.Set(normalizeRepoURL("git@git.example.com:org/web.git"), "master", "fff000")
+	require.Len(t, lockFile.Repositories, 2)
+}
+
+func TestImagesFromDir(t *testing.T) {
+	data := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: registry.example.com/web:1.0
+`)
+	expected := []ApplicationImages{{
+		Env:         "dev",
+		Instance:    "inf1",
+		Application: "web",
+		Images: []ImageEntry{{
+			Reference: images.Reference{Image: "registry.example.com/web:1.0", Repository: "registry.example.com/web", Tag: "1.0"},
+			Usages:    []images.Usage{{Resource: "Deployment/web", Container: "web", Type: images.ContainerRegular}},
+		}},
+	}}
+
+	for _, format := range output.Formats {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			w, err := output.New(dir, output.Options{Format: format}, nil)
+			require.NoError(t, err)
+			_, err = w.Write(output.Entry{Path: "dev/inf1/web", Application: "web", Env: "dev", Instance: "inf1", Data: data})
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+			// Кеш рендеринга лежит в той же директории и не является манифестом
+			require.NoError(t, os.WriteFile(filepath.Join(dir, renderCacheFile), []byte("{}"), 0644))
+
+			result, err := ImagesFromDir(dir)
+			require.NoError(t, err)
+			require.Equal(t, expected, result)
+		})
+	}
+}
+
+func TestRenderOptionsFor_Confined(t *testing.T) {
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.yaml"), []byte("token: x\n"), 0644))
+
+	repo := t.TempDir()
+	writeRepoFile := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(repo, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	writeRepoFile("svc/.helm/Chart.yaml", "apiVersion: v2\nname: svc\nversion: 1.0.0\n")
+	writeRepoFile("svc/values.yaml", "replicas: 1\n")
+	writeRepoFile("common/values.yaml", "replicas: 2\n")
+	writeRepoFile("env/werf.yaml", "project: {{ env \"ROAR_TEST_PROJECT\" }}\nconfigVersion: 1\n")
+	writeRepoFile("env/werf-giterminism.yaml", "config:\n  goTemplateRendering:\n    allowEnvVariables: [ROAR_TEST_PROJECT]\n")
+	writeRepoFile("linked/.helm/Chart.yaml", "apiVersion: v2\nname: linked\nversion: 1.0.0\n")
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret.yaml"), filepath.Join(repo, "linked", ".helm", "values.yaml")))
+	t.Setenv("ROAR_TEST_PROJECT", "svc")
+
+	tests := []struct {
+		name        string
+		app         argo.Application
+		expectedErr string
+	}{
+		{name: "inside repository", app: argo.Application{Name: "svc", Path: "svc", ValuesFiles: []string{"values.yaml", "../common/values.yaml"}}},
+		{name: "service path outside", app: argo.Application{Name: "svc", Path: "../" + filepath.Base(outside)}, expectedErr: "service path '../" + filepath.Base(outside) + "'"},
+		{name: "values file outside", app: argo.Application{Name: "svc", Path: "svc", ValuesFiles: []string{"../../" + filepath.Base(outside) + "/secret.yaml"}}, expectedErr: "is outside the repository"},
+		{name: "symlink in chart", app: argo.Application{Name: "linked", Path: "linked"}, expectedErr: "chart file:"},
+		{name: "werf env", app: argo.Application{Name: "env", Path: "env"}, expectedErr: "env is disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := renderOptionsFor(tt.app, repo, nil, true)
+			if tt.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.expectedErr)
+
+			// Вне serve те же приложения рендерятся без ограничений
+			_, err = renderOptionsFor(tt.app, repo, nil, false)
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// cloneCache keeps the clones made in a temporary directory by repository and
+// revision. It is safe for concurrent use: a caller asking for a clone that is
+// still in progress waits for it instead of cloning the repository again.
+//
+// A long-running process sets ttl and maxEntries: an expired clone is cloned
+// again on the next get, so a branch picks up new commits, and the least
+// recently used clones are dropped beyond maxEntries. A dropped clone is
+// removed from disk once every caller using it has released it.
+type cloneCache struct {
+	dir string
+	// ttl is how long a clone is reused; zero keeps clones until the cache
+	// directory is removed.
+	ttl time.Duration
+	// maxEntries limits the number of kept clones; zero means no limit.
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	clones  map[string]*cachedClone
+	counter int
+}
+
+type cachedClone struct {
+	done chan struct{}
+	path string
+	err  error
+
+	// The fields below are guarded by cloneCache.mu.
+	created  time.Time
+	lastUsed time.Time
+	users    int
+	dropped  bool
+}
+
+func newCloneCache(dir string) *cloneCache {
+	return &cloneCache{dir: dir, now: time.Now, clones: make(map[string]*cachedClone)}
+}
+
+// get returns the clone stored under key. On the first call for key it calls
+// fetch to clone into a new directory. A failed clone is not kept, so the next
+// call tries again. cached reports whether the clone was made by another call.
+// The caller must call release once it no longer uses the clone.
+func (c *cloneCache) get(ctx context.Context, key string, fetch func(path string) error) (path string, release func(), cached bool, err error) {
+	c.mu.Lock()
+	now := c.now()
+	entry, ok := c.clones[key]
+	if ok && c.expired(entry, now) {
+		c.drop(key, entry)
+		ok = false
+	}
+	if ok {
+		entry.users++
+		entry.lastUsed = now
+		c.mu.Unlock()
+		release = func() { c.release(entry) }
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			release()
+			return "", nil, false, ctx.Err()
+		}
+		if entry.err != nil {
+			release()
+			return "", nil, false, entry.err
+		}
+		return entry.path, release, true, nil
+	}
+	c.counter++
+	entry = &cachedClone{
+		done:     make(chan struct{}),
+		path:     filepath.Join(c.dir, fmt.Sprintf("clone-%d", c.counter)),
+		created:  now,
+		lastUsed: now,
+		users:    1,
+	}
+	c.clones[key] = entry
+	c.evict(entry)
+	c.mu.Unlock()
+	release = func() { c.release(entry) }
+
+	entry.err = fetch(entry.path)
+	if entry.err != nil {
+		c.mu.Lock()
+		if c.clones[key] == entry {
+			delete(c.clones, key)
+		}
+		c.mu.Unlock()
+		close(entry.done)
+		release()
+		return "", nil, false, entry.err
+	}
+	close(entry.done)
+	return entry.path, release, false, nil
+}
+
+// expired reports whether a finished clone is older than ttl. A clone still
+// in progress never expires.
+func (c *cloneCache) expired(entry *cachedClone, now time.Time) bool {
+	if c.ttl <= 0 {
+		return false
+	}
+	select {
+	case <-entry.done:
+		return now.Sub(entry.created) >= c.ttl
+	default:
+		return false
+	}
+}
+
+// evict drops the least recently used clones other than keep beyond
+// maxEntries. It is called with c.mu held.
+func (c *cloneCache) evict(keep *cachedClone) {
+	for c.maxEntries > 0 && len(c.clones) > c.maxEntries {
+		var oldestKey string
+		var oldest *cachedClone
+		for key, entry := range c.clones {
+			if entry == keep {
+				continue
+			}
+			if oldest == nil || entry.lastUsed.Before(oldest.lastUsed) {
+				oldestKey, oldest = key, entry
+			}
+		}
+		c.drop(oldestKey, oldest)
+	}
+}
+
+// drop forgets the clone under key and removes it from disk unless it is in
+// use. It is called with c.mu held.
+func (c *cloneCache) drop(key string, entry *cachedClone) {
+	delete(c.clones, key)
+	entry.dropped = true
+	if entry.users == 0 {
+		os.RemoveAll(entry.path)
+	}
+}
+
+// release marks one use of the clone as finished and removes a dropped clone
+// when it was the last one.
+func (c *cloneCache) release(entry *cachedClone) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.users--
+	if entry.dropped && entry.users == 0 {
+		os.RemoveAll(entry.path)
+	}
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/logger"
+)
+
+// GenerateCMP implements the 'generate' command of an Argo CD Config
+// Management Plugin. Argo CD runs it in the application source directory
+// with the Application described by ARGOCD_APP_* variables and its plugin
+// env passed as ARGOCD_ENV_*. The chart settings, values files and --set
+// values are resolved as in Run and the manifests are written to out.
+func GenerateCMP(ctx context.Context, cfg Config, dir string, environ []string, out io.Writer) error {
+	app, err := argo.ApplicationFromEnv(environ, cfg.StrictValues)
+	if err != nil {
+		return err
+	}
+	logCtx := logger.Log.WithField("application", app.Name)
+
+	opts, err := renderOptionsFor(app, dir, helmSetValues(app), false)
+	if err != nil {
+		return err
+	}
+	opts.ValuesFiles, err = checkValuesFiles(app, opts.ValuesFiles, cfg.IgnoreMissingValues, logCtx)
+	if err != nil {
+		return err
+	}
+	// Without a namespace in werf.yaml the release goes to the destination
+	// namespace of the Application, as with Argo CD's own Helm support.
+	if opts.Namespace == "" {
+		opts.Namespace = lookupEnv(environ, argo.EnvAppNamespace)
+	}
+	logCtx.Infof("Using chart directory '%s' and release name '%s'", opts.ChartPath, opts.ReleaseName)
+
+	rendered, err := renderWithTimeout(ctx, cfg.RenderTimeout, opts)
+	if err != nil {
+		return fmt.Errorf("failed to render chart: %w", err)
+	}
+	if _, err := out.Write(rendered); err != nil {
+		return fmt.Errorf("failed to write manifests: %w", err)
+	}
+	return nil
+}
+
+func lookupEnv(environ []string, key string) string {
+	for _, kv := range environ {
+		if value, ok := strings.CutPrefix(kv, key+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
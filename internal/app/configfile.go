@@ -0,0 +1,58 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"roar/internal/pkg/git"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig is the content of the optional config file passed with --config.
+// Command-line flags take precedence over values from the file.
+type FileConfig struct {
+	// RepoOverrides maps a repository URL to a local working copy.
+	// Relative directories are resolved against the config file location.
+	RepoOverrides map[string]string `yaml:"repoOverrides"`
+	// Git configures the transport and credentials per git host. Relative
+	// netrcFile, sshKeyFile and knownHostsFile paths are resolved against the
+	// config file location as well.
+	Git git.Credentials `yaml:"git"`
+}
+
+// LoadFileConfig reads and parses the YAML config file.
+func LoadFileConfig(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var fileCfg FileConfig
+	if err := yaml.Unmarshal(data, &fileCfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	baseDir := filepath.Dir(path)
+	for repoURL, dir := range fileCfg.RepoOverrides {
+		fileCfg.RepoOverrides[repoURL] = resolveConfigPath(baseDir, dir)
+	}
+	fileCfg.Git.NetrcFile = resolveConfigPath(baseDir, fileCfg.Git.NetrcFile)
+	for host, creds := range fileCfg.Git.Hosts {
+		creds.SSHKeyFile = resolveConfigPath(baseDir, creds.SSHKeyFile)
+		creds.KnownHostsFile = resolveConfigPath(baseDir, creds.KnownHostsFile)
+		fileCfg.Git.Hosts[host] = creds
+	}
+	return &fileCfg, nil
+}
+
+// resolveConfigPath resolves a relative path from the config file against
+// baseDir. Empty, absolute and home-relative ("~/...") paths are kept.
+func resolveConfigPath(baseDir, path string) string {
+	if path == "" || filepath.IsAbs(path) || path == "~" || strings.HasPrefix(path, "~/") {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"roar/internal/pkg/deprecation"
+	"roar/internal/pkg/logger"
+	"roar/internal/pkg/manifest"
+)
+
+// DeprecatedResource is a rendered resource that uses an API version which is
+// deprecated or removed in the target Kubernetes version.
+type DeprecatedResource struct {
+	Resource     string `json:"resource"`
+	Source       string `json:"source,omitempty"`
+	APIVersion   string `json:"apiVersion"`
+	Status       string `json:"status"`
+	DeprecatedIn string `json:"deprecatedIn,omitempty"`
+	RemovedIn    string `json:"removedIn,omitempty"`
+	Replacement  string `json:"replacement,omitempty"`
+}
+
+// checkDeprecations records resources with deprecated or removed API versions
+// in the report. It only reports them and does not change the application status.
+func checkDeprecations(checker *deprecation.Checker, results []ApplicationReport, parsed [][]manifest.Resource) {
+	for i, resources := range parsed {
+		logCtx := logger.Log.WithField("application", results[i].Name)
+		for _, res := range resources {
+			finding, found := checker.Check(res)
+			if !found {
+				continue
+			}
+
+			entry := DeprecatedResource{
+				Resource:     res.ID(),
+				Source:       res.Source,
+				APIVersion:   res.APIVersion,
+				Status:       finding.Status,
+				DeprecatedIn: finding.DeprecatedIn,
+				RemovedIn:    finding.RemovedIn,
+				Replacement:  finding.Replacement,
+			}
+			results[i].Deprecations = append(results[i].Deprecations, entry)
+
+			replacement := entry.Replacement
+			if replacement == "" {
+				replacement = "none"
+			}
+			logCtx.WithField("resource", entry.Resource).Warnf("%s %s is %s (deprecated in %s, removed in %s, replacement: %s)",
+				entry.APIVersion, res.Kind, entry.Status, entry.DeprecatedIn, entry.RemovedIn, replacement)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/git"
+	"roar/internal/pkg/helm"
+)
+
+// Sources of the commit an application is rendered from.
+const (
+	CommitFromLock     = "lock file"
+	CommitFromClone    = "clone"
+	CommitFromOverride = "local override"
+)
+
+// Explanation shows how roar resolves a single Application, from its
+// manifest in the app-of-apps output to the 'helm template' command.
+type Explanation struct {
+	Name string `json:"name"`
+	// Source is the template of the app-of-apps chart and the document in it
+	// the Application comes from.
+	Source string `json:"source,omitempty"`
+	// OutputPath is where a run writes the manifest, without the extension.
+	OutputPath string `json:"outputPath"`
+	Manifest   string `json:"manifest"`
+	// Skipped is set when the filters would leave the application out of a run.
+	Skipped  *argo.SkippedApplication `json:"skipped,omitempty"`
+	Env      argo.FieldResolution     `json:"env"`
+	Instance argo.FieldResolution     `json:"instance"`
+	RepoURL  argo.FieldResolution     `json:"repoURL"`
+	Path     argo.FieldResolution     `json:"path"`
+	// Mirror is set when the mirror transformation rewrote the source.
+	Mirror *MirrorRewrite `json:"mirror,omitempty"`
+	// Override is the local directory used instead of cloning the repository.
+	Override       string `json:"override,omitempty"`
+	Transport      string `json:"transport,omitempty"`
+	CloneURL       string `json:"cloneURL,omitempty"`
+	TargetRevision string `json:"targetRevision"`
+	Commit         string `json:"commit,omitempty"`
+	CommitSource   string `json:"commitSource,omitempty"`
+	// Helm holds the options of the application render; HelmCommand is the
+	// same as a command line.
+	Helm        helm.RenderOptions `json:"helm"`
+	HelmCommand []string           `json:"helmCommand"`
+}
+
+// MirrorRewrite is the source of an application before and after the mirror
+// transformation.
+type MirrorRewrite struct {
+	FromRepoURL string `json:"fromRepoURL"`
+	FromPath    string `json:"fromPath"`
+	ToRepoURL   string `json:"toRepoURL"`
+	ToPath      string `json:"toPath"`
+}
+
+// Explain resolves every application with the given name the same way Run
+// does, cloning its repository to read werf.yaml, but does not render it.
+// Applications are explained even when the filters skip them; ones sharing an
+// output path are handled according to cfg.OnDuplicate. Paths inside the
+// clone refer to a temporary directory that is removed before Explain
+// returns. On error the explanations made so far, the last one partial, are
+// returned with it.
+func Explain(ctx context.Context, cfg Config, name string) ([]*Explanation, error) {
+	overrides, err := normalizeRepoOverrides(cfg.RepoOverrides)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Git.Validate(); err != nil {
+		return nil, err
+	}
+	lockFile, err := loadLockFile(cfg.LockFile, cfg.Locked)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, err := applicationManifests(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("initialization failed: %w", err)
+	}
+	explained, err := argo.Explain(manifests, name, argo.ParseOptions{Filters: cfg.Filters, OnDuplicate: cfg.OnDuplicate, StrictValues: cfg.StrictValues})
+	if err != nil {
+		results := make([]*Explanation, len(explained))
+		for i, e := range explained {
+			results[i] = newExplanation(name, e)
+		}
+		return results, err
+	}
+
+	tempDir, err := os.MkdirTemp("", "argo-charts-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	state := &appState{
+		clones:     newCloneCache(tempDir),
+		overrides:  overrides,
+		lock:       lockFile,
+		locked:     cfg.Locked,
+		creds:      &cfg.Git,
+		submodules: cfg.Submodules,
+		retry:      retryPolicy(cfg),
+	}
+	var results []*Explanation
+	for _, e := range explained {
+		result := newExplanation(name, e)
+		results = append(results, result)
+		if err := explainSource(ctx, cfg, state, e.Application, result); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// newExplanation fills the parts of an explanation that come from the
+// app-of-apps output.
+func newExplanation(name string, explained *argo.Explanation) *Explanation {
+	app := explained.Application
+	return &Explanation{
+		Name:           name,
+		Source:         app.Origin(),
+		OutputPath:     app.OutputPath(),
+		Manifest:       explained.Manifest,
+		Skipped:        explained.Skipped,
+		Env:            explained.Resolution.Env,
+		Instance:       explained.Resolution.Instance,
+		RepoURL:        explained.Resolution.RepoURL,
+		Path:           explained.Resolution.Path,
+		TargetRevision: app.TargetRevision,
+	}
+}
+
+// explainSource adds the mirror transformation, the clone and the render
+// options of app to result.
+func explainSource(ctx context.Context, cfg Config, state *appState, app argo.Application, result *Explanation) error {
+	if cfg.Mirror {
+		if repoURL, path, transformed := applyMirrorTransform(app.RepoURL, app.Path); transformed {
+			result.Mirror = &MirrorRewrite{FromRepoURL: app.RepoURL, FromPath: app.Path, ToRepoURL: repoURL, ToPath: path}
+			app.RepoURL, app.Path = repoURL, path
+		}
+	}
+	logCtx := applicationLogger(app)
+
+	var repoPath string
+	if overrideDir, ok := state.findRepoOverride(app.RepoURL); ok {
+		result.Override = overrideDir
+		repoPath = overrideDir
+		if commit, err := git.HeadCommit(overrideDir); err == nil {
+			result.Commit, result.CommitSource = commit, CommitFromOverride
+		}
+	} else {
+		result.Transport = cfg.Git.TransportFor(git.HostOf(app.RepoURL))
+		remote, err := state.remoteFor(app.RepoURL)
+		if err != nil {
+			return err
+		}
+		result.CloneURL = remote.URL
+
+		var release func()
+		repoPath, release, err = state.cloneRepo(ctx, app, logCtx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		if cfg.Locked {
+			result.Commit, _ = state.lock.Get(normalizeRepoURL(app.RepoURL), app.TargetRevision)
+			result.CommitSource = CommitFromLock
+		} else if commit, err := git.HeadCommit(repoPath); err == nil {
+			result.Commit, result.CommitSource = commit, CommitFromClone
+		}
+	}
+
+	var err error
+	result.Helm, err = renderOptionsFor(app, repoPath, helmSetValues(app), false)
+	if err != nil {
+		return err
+	}
+	result.HelmCommand = append([]string{"helm"}, helm.Args(result.Helm)...)
+	return nil
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"roar/internal/pkg/images"
+	"roar/internal/pkg/logger"
+	"roar/internal/pkg/manifest"
+	"roar/internal/pkg/output"
+)
+
+// ApplicationImages lists the container images used by one application.
+type ApplicationImages struct {
+	Env         string       `json:"env,omitempty"`
+	Instance    string       `json:"instance,omitempty"`
+	Application string       `json:"application"`
+	Images      []ImageEntry `json:"images"`
+}
+
+// ImageEntry is a unique image reference within an application and the
+// containers that use it.
+type ImageEntry struct {
+	images.Reference
+	Pinned bool           `json:"pinned"`
+	Usages []images.Usage `json:"usages"`
+}
+
+// Images renders the selected applications and collects the images of their
+// containers, init containers and ephemeral containers. Applications that
+// failed to render are skipped with a warning. When cfg.OutputDir is empty
+// the manifests are rendered into a temporary directory.
+func Images(ctx context.Context, cfg Config) ([]ApplicationImages, error) {
+	if cfg.OutputDir == "" {
+		outputDir, err := os.MkdirTemp("", "roar-images-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp directory: %w", err)
+		}
+		defer os.RemoveAll(outputDir)
+		cfg.OutputDir = outputDir
+	}
+
+	report := newReport()
+	if err := render(ctx, cfg, report); err != nil {
+		return nil, err
+	}
+
+	var result []ApplicationImages
+	for _, app := range report.Applications {
+		if app.Status != AppRendered {
+			logger.Log.WithField("application", app.Name).Warnf("Application was not rendered (%s), its images are not listed", app.Status)
+			continue
+		}
+		appImages, err := collectImages(app.Env, app.Instance, app.Name, app.manifest)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, appImages)
+	}
+	sortApplicationImages(result)
+	return result, nil
+}
+
+// ImagesFromDir collects images from manifests rendered earlier into dir.
+// Env and instance are taken from the directory layout
+// <dir>/<env>/<instance>/<application>.<ext>; manifests written in any output
+// format (.yaml, .json, .ndjson) are read. Hidden files such as the render
+// cache are skipped.
+func ImagesFromDir(dir string) ([]ApplicationImages, error) {
+	var result []ApplicationImages
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		format, ok := output.FormatOf(path)
+		if !ok {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		name := strings.TrimSuffix(parts[len(parts)-1], filepath.Ext(path))
+		var env, instance string
+		if len(parts) > 1 {
+			env = parts[0]
+		}
+		if len(parts) > 2 {
+			instance = parts[1]
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read manifest %s: %w", path, err)
+		}
+		data, err = output.Decode(data, format)
+		if err != nil {
+			return fmt.Errorf("failed to read manifest %s: %w", path, err)
+		}
+		appImages, err := collectImages(env, instance, name, data)
+		if err != nil {
+			return err
+		}
+		result = append(result, appImages)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortApplicationImages(result)
+	return result, nil
+}
+
+// collectImages extracts the unique image references from a rendered manifest.
+func collectImages(env, instance, name string, data []byte) (ApplicationImages, error) {
+	appImages := ApplicationImages{Env: env, Instance: instance, Application: name, Images: []ImageEntry{}}
+	resources, err := manifest.Parse(data)
+	if err != nil {
+		return appImages, fmt.Errorf("application '%s': %w", name, err)
+	}
+
+	byImage := make(map[string]int)
+	for _, res := range resources {
+		for _, found := range images.Extract(res) {
+			i, ok := byImage[found.Image]
+			if !ok {
+				i = len(appImages.Images)
+				byImage[found.Image] = i
+				appImages.Images = append(appImages.Images, ImageEntry{Reference: found.Reference, Pinned: found.Pinned()})
+			}
+			appImages.Images[i].Usages = append(appImages.Images[i].Usages, found.Usage)
+		}
+	}
+	sort.Slice(appImages.Images, func(i, j int) bool {
+		return appImages.Images[i].Image < appImages.Images[j].Image
+	})
+	return appImages, nil
+}
+
+func sortApplicationImages(list []ApplicationImages) {
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Env != b.Env {
+			return a.Env < b.Env
+		}
+		if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return a.Application < b.Application
+	})
+}
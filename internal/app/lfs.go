@@ -0,0 +1,152 @@
+package app
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"roar/internal/pkg/git"
+	"roar/internal/pkg/helm"
+
+	"github.com/sirupsen/logrus"
+)
+
+// resolveLFSPointers looks for Git LFS pointer files in the chart directory and
+// values files of opts and replaces them with objects from the local LFS store.
+// The clone or local override is never modified, as it may be a working copy
+// or be read by concurrent renders: the chart and the values files with
+// pointers are copied to a temporary directory first. It returns the options
+// to render with and a function removing the copy.
+func resolveLFSPointers(opts helm.RenderOptions, lfsDir string, logCtx *logrus.Entry) (helm.RenderOptions, func(), error) {
+	noop := func() {}
+	var pointers []git.LFSPointer
+	for _, path := range append([]string{opts.ChartPath}, opts.ValuesFiles...) {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		found, err := git.FindLFSPointers(path)
+		if err != nil {
+			return opts, noop, err
+		}
+		pointers = append(pointers, found...)
+	}
+	if len(pointers) == 0 {
+		return opts, noop, nil
+	}
+	logCtx.Infof("Found %d Git LFS pointer files", len(pointers))
+	if lfsDir == "" {
+		return opts, noop, git.ResolveLFSPointers(pointers, "")
+	}
+
+	copyDir, err := os.MkdirTemp("", "roar-lfs-*")
+	if err != nil {
+		return opts, noop, fmt.Errorf("failed to create directory for LFS objects: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(copyDir) }
+	resolved, err := copyLFSInputs(opts, pointers, copyDir)
+	if err == nil {
+		err = git.ResolveLFSPointers(pointers, lfsDir)
+	}
+	if err != nil {
+		cleanup()
+		return opts, noop, err
+	}
+	logCtx.Infof("Rendering from a copy with LFS objects in %s", copyDir)
+	return resolved, cleanup, nil
+}
+
+// copyLFSInputs copies the chart directory and the values files outside it
+// that are LFS pointers to copyDir. The paths of pointers are changed to
+// their copies.
+func copyLFSInputs(opts helm.RenderOptions, pointers []git.LFSPointer, copyDir string) (helm.RenderOptions, error) {
+	chartCopy := filepath.Join(copyDir, "chart")
+	if err := copyTree(opts.ChartPath, chartCopy); err != nil {
+		return opts, fmt.Errorf("failed to copy chart %s: %w", opts.ChartPath, err)
+	}
+	copied := make(map[string]string)
+	inChart := func(path string) (string, bool) {
+		rel, err := filepath.Rel(opts.ChartPath, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+		return filepath.Join(chartCopy, rel), true
+	}
+
+	resolved := opts
+	resolved.ChartPath = chartCopy
+	resolved.ValuesFiles = make([]string, len(opts.ValuesFiles))
+	for i, file := range opts.ValuesFiles {
+		resolved.ValuesFiles[i] = file
+		if path, ok := inChart(file); ok {
+			resolved.ValuesFiles[i] = path
+		}
+	}
+
+	for i := range pointers {
+		if path, ok := inChart(pointers[i].Path); ok {
+			pointers[i].Path = path
+			continue
+		}
+		path, ok := copied[pointers[i].Path]
+		if !ok {
+			path = filepath.Join(copyDir, "values", fmt.Sprint(len(copied)), filepath.Base(pointers[i].Path))
+			if err := copyFile(pointers[i].Path, path); err != nil {
+				return opts, err
+			}
+			copied[pointers[i].Path] = path
+		}
+		for j, file := range opts.ValuesFiles {
+			if file == pointers[i].Path {
+				resolved.ValuesFiles[j] = path
+			}
+		}
+		pointers[i].Path = path
+	}
+	return resolved, nil
+}
+
+// copyTree copies the directory src to dst, skipping git metadata. Symbolic
+// links are recreated pointing to the absolute path of their target.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if !filepath.IsAbs(link) {
+				link = filepath.Join(filepath.Dir(path), link)
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target)
+		}
+	})
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
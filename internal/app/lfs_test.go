@@ -0,0 +1,70 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"roar/internal/pkg/helm"
+	"roar/internal/pkg/logger"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveLFSPointers(t *testing.T) {
+	content := []byte("large: values\n")
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+	pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content))
+
+	storeDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(storeDir, oid[0:2], oid[2:4]), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(storeDir, oid[0:2], oid[2:4], oid), content, 0644))
+
+	repoDir := t.TempDir()
+	chartDir := filepath.Join(repoDir, ".helm")
+	files := map[string]string{
+		".helm/Chart.yaml":       "apiVersion: v2\nname: web\nversion: 1.0.0",
+		".helm/files/large.yaml": pointer,
+		".helm/values.yaml":      "replicas: 1",
+		"values-prod.yaml":       pointer,
+		"values-dev.yaml":        "replicas: 2",
+	}
+	for name, data := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(repoDir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(repoDir, name), []byte(data), 0644))
+	}
+	opts := helm.RenderOptions{
+		ChartPath:   chartDir,
+		ValuesFiles: []string{filepath.Join(chartDir, "values.yaml"), filepath.Join(repoDir, "values-prod.yaml"), filepath.Join(repoDir, "values-dev.yaml")},
+	}
+	logCtx := logger.Log.WithField("application", "web")
+
+	_, cleanup, err := resolveLFSPointers(opts, "", logCtx)
+	require.ErrorContains(t, err, "Git LFS pointers")
+	cleanup()
+
+	resolved, cleanup, err := resolveLFSPointers(opts, storeDir, logCtx)
+	require.NoError(t, err)
+	require.NotEqual(t, chartDir, resolved.ChartPath)
+	require.Equal(t, filepath.Join(resolved.ChartPath, "values.yaml"), resolved.ValuesFiles[0])
+	require.Equal(t, opts.ValuesFiles[2], resolved.ValuesFiles[2])
+	for _, path := range []string{filepath.Join(resolved.ChartPath, "files", "large.yaml"), resolved.ValuesFiles[1]} {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, content, data)
+	}
+
+	// Рабочая копия не изменяется
+	for _, name := range []string{".helm/files/large.yaml", "values-prod.yaml"} {
+		data, err := os.ReadFile(filepath.Join(repoDir, name))
+		require.NoError(t, err)
+		require.Equal(t, pointer, string(data))
+	}
+
+	cleanup()
+	require.NoDirExists(t, resolved.ChartPath)
+}
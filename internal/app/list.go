@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"roar/internal/pkg/argo"
+)
+
+// ListedApplication is an Application as resolved from the app-of-apps chart.
+type ListedApplication struct {
+	Name           string   `json:"name"`
+	Env            string   `json:"env,omitempty"`
+	Instance       string   `json:"instance,omitempty"`
+	RepoURL        string   `json:"repoURL"`
+	Path           string   `json:"path"`
+	TargetRevision string   `json:"targetRevision"`
+	SetterCount    int      `json:"setterCount"`
+	ValuesFiles    []string `json:"valuesFiles"`
+	// Source is the template of the app-of-apps chart and the document in it
+	// the Application comes from.
+	Source string `json:"source,omitempty"`
+}
+
+// ListResult holds the selected Applications and the ones skipped by filters.
+type ListResult struct {
+	Applications []ListedApplication       `json:"applications"`
+	Skipped      []argo.SkippedApplication `json:"skipped"`
+}
+
+// List renders only the app-of-apps chart and returns the parsed
+// Applications without cloning or rendering them. The mirror transformation
+// is applied, so the listed repositories are the ones that would be cloned.
+func List(ctx context.Context, cfg Config) (*ListResult, error) {
+	parsed, err := parseApplications(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("initialization failed: %w", err)
+	}
+
+	result := &ListResult{Applications: []ListedApplication{}, Skipped: parsed.Skipped}
+	if result.Skipped == nil {
+		result.Skipped = []argo.SkippedApplication{}
+	}
+	for _, app := range parsed.Applications {
+		if cfg.Mirror {
+			applyMirror(&app, applicationLogger(app))
+		}
+		result.Applications = append(result.Applications, ListedApplication{
+			Name:           app.Name,
+			Env:            app.Env,
+			Instance:       app.Instance,
+			RepoURL:        app.RepoURL,
+			Path:           app.Path,
+			TargetRevision: app.TargetRevision,
+			SetterCount:    len(app.Setters),
+			ValuesFiles:    app.ValuesFiles,
+			Source:         app.Origin(),
+		})
+	}
+	return result, nil
+}
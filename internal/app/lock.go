@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"roar/internal/pkg/git"
+	"roar/internal/pkg/lock"
+	"roar/internal/pkg/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// errNotLocked is returned in locked mode for a repository and revision that
+// have no entry in the lock file.
+var errNotLocked = errors.New("repository revision is not in the lock file")
+
+// loadLockFile returns the lock file to record commits into or to clone from.
+// In locked mode the file must exist; otherwise a missing file starts empty.
+// Entries are keyed by normalized repository URL, like clones, so that every
+// spelling of a repository URL finds the same entry.
+func loadLockFile(path string, locked bool) (*lock.File, error) {
+	if path == "" {
+		if locked {
+			return nil, errors.New("locked mode requires a lock file")
+		}
+		return nil, nil
+	}
+	load := lock.LoadOrNew
+	if locked {
+		load = lock.Load
+	}
+	lockFile, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	entries := lockFile.Repositories
+	lockFile.Repositories = nil
+	for _, entry := range entries {
+		lockFile.Set(normalizeRepoURL(entry.Repository), entry.Revision, entry.Commit)
+	}
+	return lockFile, nil
+}
+
+// UpdateLock renders the app-of-apps chart, resolves every repository and
+// revision used by the selected applications to a commit and rewrites the
+// lock file from scratch.
+func UpdateLock(ctx context.Context, cfg Config) error {
+	if cfg.LockFile == "" {
+		return errors.New("lock file path is not set")
+	}
+
+	overrides, err := normalizeRepoOverrides(cfg.RepoOverrides)
+	if err != nil {
+		return err
+	}
+
+	applications, err := loadApplications(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("initialization failed: %w", err)
+	}
+
+	if err := cfg.Git.Validate(); err != nil {
+		return err
+	}
+
+	state := &appState{overrides: overrides, creds: &cfg.Git}
+	lockFile := lock.New()
+	for _, app := range applications {
+		logCtx := applicationLogger(app)
+		if cfg.Mirror {
+			applyMirror(&app, logCtx)
+		}
+		logCtx = logCtx.WithFields(logrus.Fields{"repo": app.RepoURL, "revision": app.TargetRevision})
+		if _, ok := state.findRepoOverride(app.RepoURL); ok {
+			logCtx.Infof("Repository %s is overridden locally, not locking it", app.RepoURL)
+			continue
+		}
+		if _, ok := lockFile.Get(normalizeRepoURL(app.RepoURL), app.TargetRevision); ok {
+			continue
+		}
+
+		remote, err := state.remoteFor(app.RepoURL)
+		if err != nil {
+			return fmt.Errorf("application '%s': %w", app.Name, err)
+		}
+		var commit string
+		err = git.Retry(ctx, retryPolicy(cfg), "ls-remote of "+remote.URL, func(ctx context.Context) error {
+			var err error
+			commit, err = git.ResolveRevision(ctx, remote, app.TargetRevision)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("application '%s': %w", app.Name, err)
+		}
+		logCtx.Infof("Locked %s@%s to commit %s", app.RepoURL, app.TargetRevision, commit)
+		lockFile.Set(normalizeRepoURL(app.RepoURL), app.TargetRevision, commit)
+	}
+
+	if err := lockFile.Save(cfg.LockFile); err != nil {
+		return err
+	}
+	logger.Log.Infof("Lock file %s updated with %d entries.", cfg.LockFile, len(lockFile.Repositories))
+	return nil
+}
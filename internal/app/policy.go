@@ -0,0 +1,72 @@
+package app
+
+import (
+	"slices"
+
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/logger"
+	"roar/internal/pkg/manifest"
+	"roar/internal/pkg/policy"
+)
+
+// PolicyViolation is a policy rule broken by a rendered resource.
+type PolicyViolation struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Resource string `json:"resource"`
+	Source   string `json:"source,omitempty"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+	// Exempt is set when the application is exempted from the rule; such
+	// violations are reported but never fail the run.
+	Exempt bool `json:"exempt,omitempty"`
+}
+
+// checkPolicies evaluates the policy rules against the parsed resources of
+// every application and records violations in the report. applications,
+// results and parsed are parallel. It returns the number of applications
+// with non-exempt violations of severity error.
+func checkPolicies(p *policy.Policy, applications []argo.Application, results []ApplicationReport, parsed [][]manifest.Resource) int {
+	failed := 0
+	for i, resources := range parsed {
+		logCtx := logger.Log.WithField("application", results[i].Name)
+		exemptions := applications[i].PolicyExemptions
+		hasErrors := false
+
+		for _, res := range resources {
+			for _, v := range p.Evaluate(res) {
+				entry := PolicyViolation{
+					Rule:     v.Rule,
+					Severity: v.Severity,
+					Resource: res.ID(),
+					Source:   res.Source,
+					Path:     v.Path,
+					Message:  v.Message,
+					Exempt:   slices.Contains(exemptions, v.Rule) || slices.Contains(exemptions, "*"),
+				}
+				results[i].Policy = append(results[i].Policy, entry)
+
+				entryLog := logCtx.WithField("resource", entry.Resource).WithField("rule", entry.Rule)
+				switch {
+				case entry.Exempt:
+					entryLog.Infof("Exempted policy violation: %s: %s", entry.Path, entry.Message)
+				case entry.Severity == policy.SeverityError:
+					hasErrors = true
+					entryLog.Errorf("Policy violation: %s: %s", entry.Path, entry.Message)
+				case entry.Severity == policy.SeverityWarning:
+					entryLog.Warnf("Policy violation: %s: %s", entry.Path, entry.Message)
+				default:
+					entryLog.Infof("Policy violation: %s: %s", entry.Path, entry.Message)
+				}
+			}
+		}
+
+		if hasErrors {
+			failed++
+			if results[i].Status == AppRendered {
+				results[i].Status = AppPolicyViolation
+			}
+		}
+	}
+	return failed
+}
@@ -0,0 +1,257 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"roar/internal/pkg/helm"
+	"roar/internal/pkg/werf"
+
+	"gopkg.in/yaml.v3"
+)
+
+// renderCacheFile is the render cache index in the output directory.
+const renderCacheFile = ".roar-render-cache.json"
+
+// renderCacheVersion changes whenever the hashed inputs change, so an index
+// written by another version is ignored instead of producing false hits.
+const renderCacheVersion = 3
+
+// renderCache maps the output path of every application to the hash of the
+// inputs its manifest was rendered from. The index lives next to the
+// manifests in the output directory, so a matching hash means the manifest
+// there is up to date and 'helm template' can be skipped.
+type renderCache struct {
+	path   string
+	format string
+	// helmVersion is the output of 'helm version --short', read once per run.
+	helmVersion string
+	entries     map[string]string
+	// force makes every lookup miss; the entries are still updated.
+	force  bool
+	hits   int
+	misses int
+}
+
+type renderCacheIndex struct {
+	Version int               `json:"version"`
+	Entries map[string]string `json:"entries"`
+}
+
+// loadRenderCache reads the index in outputDir. A missing or outdated index
+// gives an empty cache.
+func loadRenderCache(outputDir, format, helmVersion string) (*renderCache, error) {
+	c := &renderCache{path: filepath.Join(outputDir, renderCacheFile), format: format, helmVersion: helmVersion, entries: make(map[string]string)}
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read render cache %s: %w", c.path, err)
+	}
+	var index renderCacheIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse render cache %s: %w", c.path, err)
+	}
+	if index.Version == renderCacheVersion && index.Entries != nil {
+		c.entries = index.Entries
+	}
+	return c, nil
+}
+
+// lookup reports whether the manifest at outputPath was rendered from inputs
+// with the given hash.
+func (c *renderCache) lookup(outputPath, hash string) bool {
+	return !c.force && c.entries[outputPath] == hash
+}
+
+// store records the hash of the inputs of a freshly rendered manifest.
+func (c *renderCache) store(outputPath, hash string) {
+	c.entries[outputPath] = hash
+}
+
+// drop forgets the manifest at outputPath, e.g. after a failed render.
+func (c *renderCache) drop(outputPath string) {
+	delete(c.entries, outputPath)
+}
+
+// save writes the index. Entries of applications not rendered in this run
+// are kept, so runs with different filters share the cache.
+func (c *renderCache) save() error {
+	data, err := json.MarshalIndent(renderCacheIndex{Version: renderCacheVersion, Entries: c.entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode render cache: %w", err)
+	}
+	if err := os.WriteFile(c.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write render cache %s: %w", c.path, err)
+	}
+	return nil
+}
+
+// hash computes the hash of everything the render reads for opts: the files
+// of the chart directory and of its local (file://) dependencies, the werf
+// config of servicePath, the contents of the values files in order, the --set
+// values, the release name and namespace, the output format and the helm
+// version.
+// Absolute paths are not hashed, as clones land in a new directory every run.
+func (c *renderCache) hash(opts helm.RenderOptions, servicePath string) (string, error) {
+	h := sha256.New()
+	writeField(h, "format", []byte(c.format))
+	writeField(h, "helm", []byte(c.helmVersion))
+	writeField(h, "release", []byte(opts.ReleaseName))
+	writeField(h, "namespace", []byte(opts.Namespace))
+
+	if err := hashDir(h, "chart:", opts.ChartPath); err != nil {
+		return "", fmt.Errorf("failed to hash chart %s: %w", opts.ChartPath, err)
+	}
+	if err := hashDependencies(h, opts.ChartPath, opts.ChartPath, map[string]bool{filepath.Clean(opts.ChartPath): true}); err != nil {
+		return "", fmt.Errorf("failed to hash dependencies of chart %s: %w", opts.ChartPath, err)
+	}
+	for _, name := range werf.InputPaths() {
+		path := filepath.Join(servicePath, name)
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err == nil && info.IsDir() {
+			err = hashDir(h, "werf:"+name+"/", path)
+		} else if err == nil {
+			var data []byte
+			if data, err = os.ReadFile(path); err == nil {
+				writeField(h, "werf:"+name, data)
+			}
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to hash werf config %s: %w", path, err)
+		}
+	}
+
+	for i, file := range opts.ValuesFiles {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			writeField(h, fmt.Sprintf("values:%d:missing", i), nil)
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to hash values file %s: %w", file, err)
+		}
+		writeField(h, fmt.Sprintf("values:%d", i), data)
+	}
+
+	keys := make([]string, 0, len(opts.SetValues))
+	for key := range opts.SetValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeField(h, "set:"+key, []byte(opts.SetValues[key]))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashDir adds every file under dir to h, named prefix plus its path relative
+// to dir. Symlinks are hashed by their target; Git metadata is skipped.
+func hashDir(h hash.Hash, prefix, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		var data []byte
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			data = []byte("symlink:" + target)
+		} else if data, err = os.ReadFile(path); err != nil {
+			return err
+		}
+		writeField(h, prefix+filepath.ToSlash(rel), data)
+		return nil
+	})
+}
+
+// chartDependencies is the part of Chart.yaml and requirements.yaml that
+// lists the chart dependencies.
+type chartDependencies struct {
+	Dependencies []struct {
+		Repository string `yaml:"repository"`
+	} `yaml:"dependencies"`
+}
+
+// hashDependencies adds the charts that chartDir references as file://
+// dependencies in Chart.yaml or requirements.yaml, and their own local
+// dependencies, to h. They are named by their path relative to rootChart;
+// a missing dependency is hashed as missing. visited breaks cycles.
+func hashDependencies(h hash.Hash, rootChart, chartDir string, visited map[string]bool) error {
+	for _, name := range []string{"Chart.yaml", "requirements.yaml"} {
+		data, err := os.ReadFile(filepath.Join(chartDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var deps chartDependencies
+		if err := yaml.Unmarshal(data, &deps); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", filepath.Join(chartDir, name), err)
+		}
+		for _, dep := range deps.Dependencies {
+			repoPath, ok := strings.CutPrefix(dep.Repository, "file://")
+			if !ok {
+				continue
+			}
+			depDir := filepath.Join(chartDir, repoPath)
+			if filepath.IsAbs(repoPath) {
+				depDir = filepath.Clean(repoPath)
+			}
+			if visited[depDir] {
+				continue
+			}
+			visited[depDir] = true
+
+			rel, err := filepath.Rel(rootChart, depDir)
+			if err != nil {
+				return err
+			}
+			prefix := "dependency:" + filepath.ToSlash(rel) + "/"
+			if _, err := os.Stat(depDir); errors.Is(err, os.ErrNotExist) {
+				writeField(h, prefix+"missing", nil)
+				continue
+			}
+			if err := hashDir(h, prefix, depDir); err != nil {
+				return err
+			}
+			if err := hashDependencies(h, rootChart, depDir, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeField adds a named, length-prefixed value to h, so that adjacent
+// fields cannot run into each other.
+func writeField(h hash.Hash, name string, value []byte) {
+	fmt.Fprintf(h, "%s\x00%d\x00", name, len(value))
+	h.Write(value)
+}
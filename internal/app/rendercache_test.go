@@ -0,0 +1,78 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"roar/internal/pkg/helm"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderCacheHash(t *testing.T) {
+	// Две копии одного чарта в разных директориях, как клоны разных запусков
+	var opts []helm.RenderOptions
+	var dirs []string
+	for range 2 {
+		dir := t.TempDir()
+		dirs = append(dirs, dir)
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, ".helm", "templates"), 0755))
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "lib", "templates"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".helm", "Chart.yaml"), []byte("name: web\ndependencies:\n  - name: lib\n    repository: file://../lib\n"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "Chart.yaml"), []byte("name: lib\n# Цикл зависимостей не приводит к зацикливанию\ndependencies:\n  - name: web\n    repository: file://../.helm\n"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "templates", "_helpers.tpl"), []byte(`{{ define "lib.name" }}web{{ end }}`), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "werf.yaml"), []byte("project: web\nconfigVersion: 1\n"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".helm", "templates", "cm.yaml"), []byte("kind: ConfigMap"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("a: 1"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "b.yaml"), []byte("b: 1"), 0644))
+		opts = append(opts, helm.RenderOptions{
+			ReleaseName: "web",
+			ChartPath:   filepath.Join(dir, ".helm"),
+			ValuesFiles: []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")},
+			SetValues:   map[string]string{"global.env": "dev", "replicas": "2"},
+		})
+	}
+	cache := &renderCache{format: "yaml"}
+	hash := func(opts helm.RenderOptions) string {
+		t.Helper()
+		h, err := cache.hash(opts, filepath.Dir(opts.ChartPath))
+		require.NoError(t, err)
+		return h
+	}
+	base := hash(opts[0])
+
+	// Абсолютные пути не влияют на хеш
+	require.Equal(t, base, hash(opts[1]))
+
+	// werf.yaml лежит вне директории чарта, но входит в хеш
+	require.NoError(t, os.WriteFile(filepath.Join(dirs[1], "werf.yaml"), []byte("project: api\nconfigVersion: 1\n"), 0644))
+	require.NotEqual(t, base, hash(opts[1]))
+	require.NoError(t, os.WriteFile(filepath.Join(dirs[1], "werf.yaml"), []byte("project: web\nconfigVersion: 1\n"), 0644))
+	require.Equal(t, base, hash(opts[1]))
+
+	// Как и зависимость file://../lib
+	require.NoError(t, os.WriteFile(filepath.Join(dirs[1], "lib", "templates", "_helpers.tpl"), []byte(`{{ define "lib.name" }}api{{ end }}`), 0644))
+	require.NotEqual(t, base, hash(opts[1]))
+	require.NoError(t, os.RemoveAll(filepath.Join(dirs[1], "lib")))
+	require.NotEqual(t, base, hash(opts[1]))
+
+	// Порядок values-файлов влияет
+	reordered := opts[0]
+	reordered.ValuesFiles = []string{opts[0].ValuesFiles[1], opts[0].ValuesFiles[0]}
+	require.NotEqual(t, base, hash(reordered))
+
+	// Как и --set значения, namespace и содержимое шаблонов
+	changed := opts[0]
+	changed.SetValues = map[string]string{"global.env": "prod", "replicas": "2"}
+	require.NotEqual(t, base, hash(changed))
+	changed = opts[0]
+	changed.Namespace = "web"
+	require.NotEqual(t, base, hash(changed))
+	require.NoError(t, os.WriteFile(filepath.Join(opts[1].ChartPath, "templates", "cm.yaml"), []byte("kind: Secret"), 0644))
+	require.NotEqual(t, base, hash(opts[1]))
+
+	// Другая версия helm может отрендерить чарт иначе
+	cache.helmVersion = "v3.15.0+gc4e37b3"
+	require.NotEqual(t, base, hash(opts[0]))
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"roar/internal/pkg/argo"
+)
+
+// Overall run statuses written to the report.
+const (
+	RunSucceeded          = "succeeded"
+	RunCompletedWithError = "completed_with_errors"
+	RunFailed             = "failed"
+	RunInterrupted        = "interrupted"
+)
+
+// Per-application statuses written to the report.
+const (
+	AppRendered     = "rendered"
+	AppRenderFailed = "render_failed"
+	AppInvalid      = "invalid"
+	// AppPolicyViolation means the application broke a policy rule of severity error.
+	AppPolicyViolation = "policy_violation"
+	AppFailed          = "failed"
+	AppCancelled       = "cancelled"
+)
+
+// Report summarizes a run. It is written to Config.ReportFile even when the
+// run fails or is interrupted, so CI can tell which applications were rendered.
+type Report struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	Duration  string    `json:"duration"`
+	// Cache counts the applications rendered and reused from the render
+	// cache; it is omitted when the output is not a directory.
+	Cache        *CacheStats         `json:"cache,omitempty"`
+	Applications []ApplicationReport `json:"applications"`
+}
+
+// CacheStats are the render cache statistics of a run.
+type CacheStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// ApplicationReport is the outcome of rendering a single application.
+type ApplicationReport struct {
+	Name     string `json:"name"`
+	Env      string `json:"env,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Source is the template of the app-of-apps chart and the document in it
+	// the Application comes from, e.g. "app-of-apps/templates/web.yaml (document 1)".
+	Source string `json:"source,omitempty"`
+	// ValuesFiles are the values files of the application in the order they
+	// are passed to helm, with the WERF_VALUES_* variables they come from.
+	ValuesFiles []ValuesFileReport `json:"valuesFiles,omitempty"`
+	Status      string             `json:"status"`
+	Error       string             `json:"error,omitempty"`
+	OutputFile  string             `json:"outputFile,omitempty"`
+	Duration    string             `json:"duration,omitempty"`
+	// Cached means the inputs did not change since the manifest in the
+	// output was rendered, so 'helm template' was skipped.
+	Cached bool `json:"cached,omitempty"`
+	// Validation lists schema violations found with --validate.
+	Validation []ResourceIssues `json:"validation,omitempty"`
+	// Deprecations lists resources with deprecated or removed API versions
+	// found with --check-deprecations.
+	Deprecations []DeprecatedResource `json:"deprecations,omitempty"`
+	// Policy lists violations of the rules from --policy files.
+	Policy []PolicyViolation `json:"policy,omitempty"`
+
+	manifest []byte
+}
+
+// ValuesFileReport is a values file of an application as given in the
+// Application, relative to the application path.
+type ValuesFileReport struct {
+	// Var is the WERF_VALUES_* variable of the plugin env the file comes from.
+	Var  string `json:"var,omitempty"`
+	Path string `json:"path"`
+}
+
+// valuesFileReports pairs the values files of app with their variables.
+func valuesFileReports(app argo.Application) []ValuesFileReport {
+	var files []ValuesFileReport
+	for i, path := range app.ValuesFiles {
+		file := ValuesFileReport{Path: path}
+		if i < len(app.ValuesFileVars) {
+			file.Var = app.ValuesFileVars[i]
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+func newReport() *Report {
+	return &Report{StartedAt: time.Now(), Applications: []ApplicationReport{}}
+}
+
+// finish sets the overall status from the error returned by Run.
+func (r *Report) finish(err error) {
+	r.Duration = time.Since(r.StartedAt).Round(time.Millisecond).String()
+	switch {
+	case errors.Is(err, context.Canceled):
+		r.Status = RunInterrupted
+	case err != nil:
+		r.Status = RunFailed
+	default:
+		r.Status = RunSucceeded
+		for _, app := range r.Applications {
+			if app.Status != AppRendered {
+				r.Status = RunCompletedWithError
+				break
+			}
+		}
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Write saves the report as indented JSON.
+func (r *Report) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	return nil
+}
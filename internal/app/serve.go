@@ -0,0 +1,339 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/git"
+	"roar/internal/pkg/lock"
+	"roar/internal/pkg/logger"
+	"roar/internal/pkg/output"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxRenderBodySize limits the Application manifests accepted by POST /render.
+const maxRenderBodySize = 8 << 20
+
+// ServeOptions configures the HTTP API of 'roar serve'.
+type ServeOptions struct {
+	// RequestTimeout limits a single request, including the wait for a free
+	// render slot, clones and renders; zero means no limit.
+	RequestTimeout time.Duration
+	// MaxConcurrent is the number of requests served at the same time.
+	// Further requests wait for a free slot and fail with 503 when their
+	// timeout expires first.
+	MaxConcurrent int
+	// CloneTTL is how long a clone is reused before the repository is cloned
+	// again, so that branches pick up new commits; zero keeps clones until
+	// Close. Clones of locked commits never change and do not expire.
+	CloneTTL time.Duration
+	// MaxClones limits the number of clones kept on disk; the least recently
+	// used ones are removed first. Zero means no limit.
+	MaxClones int
+	// AllowedHosts are the git hosts POST /render may clone from; empty
+	// allows any remote host. Local paths and file:// URLs are always
+	// rejected there.
+	AllowedHosts []string
+}
+
+// Server exposes rendering over HTTP:
+//
+//	POST /render                  renders the Application manifests in the request body
+//	GET  /apps                    lists the Applications of the app-of-apps chart
+//	GET  /apps/{name}/manifest    renders a single Application of the app-of-apps chart
+//
+// The app-of-apps chart is rendered on every request, so changes to it are
+// picked up without a restart. Repositories are untrusted: werf.yaml may not
+// read the environment and charts and values files must stay inside the
+// clone. Clones are shared between requests for
+// ServeOptions.CloneTTL, after which a branch is resolved to a commit again.
+// Manifests are returned in the format of the 'format' query parameter, as
+// 'roar --output-dir -' prints them.
+type Server struct {
+	cfg     Config
+	tempDir string
+	state   *appState
+	timeout time.Duration
+	slots   chan struct{}
+	mux     *http.ServeMux
+	// allowedHosts is ServeOptions.AllowedHosts.
+	allowedHosts []string
+}
+
+// NewServer prepares a server for cfg. In locked mode the lock file is read
+// once; otherwise resolved commits are not recorded.
+func NewServer(cfg Config, opts ServeOptions) (*Server, error) {
+	if slices.Contains(cfg.AppFiles, "-") {
+		return nil, errors.New("stdin ('-') cannot be used as an application file of the server")
+	}
+	overrides, err := normalizeRepoOverrides(cfg.RepoOverrides)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Git.Validate(); err != nil {
+		return nil, err
+	}
+	var lockFile *lock.File
+	if cfg.Locked {
+		lockFile, err = loadLockFile(cfg.LockFile, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tempDir, err := os.MkdirTemp("", "argo-charts-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	logger.Log.Infof("Using temporary directory for clones: %s", tempDir)
+	clones := newCloneCache(tempDir)
+	clones.maxEntries = opts.MaxClones
+	if !cfg.Locked {
+		clones.ttl = opts.CloneTTL
+	}
+
+	s := &Server{
+		cfg:     cfg,
+		tempDir: tempDir,
+		state: &appState{
+			clones:     clones,
+			overrides:  overrides,
+			lock:       lockFile,
+			locked:     cfg.Locked,
+			creds:      &cfg.Git,
+			submodules: cfg.Submodules,
+			lfsDir:     cfg.LFSObjectsDir,
+			retry:      retryPolicy(cfg),
+			renderTime: cfg.RenderTimeout,
+
+			ignoreMissingValues: cfg.IgnoreMissingValues,
+			confined:            true,
+		},
+		timeout:      opts.RequestTimeout,
+		slots:        make(chan struct{}, max(opts.MaxConcurrent, 1)),
+		mux:          http.NewServeMux(),
+		allowedHosts: opts.AllowedHosts,
+	}
+	s.mux.Handle("POST /render", s.handle(s.render))
+	s.mux.Handle("GET /apps", s.handle(s.listApps))
+	s.mux.Handle("GET /apps/{name}/manifest", s.handle(s.appManifest))
+	return s, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close removes the clones of the server.
+func (s *Server) Close() error {
+	return os.RemoveAll(s.tempDir)
+}
+
+// response is the body of a successful request.
+type response struct {
+	contentType string
+	body        []byte
+}
+
+// httpError is an error with the HTTP status it is reported with.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+func (e *httpError) Unwrap() error { return e.err }
+
+func badRequest(format string, args ...any) error {
+	return &httpError{status: http.StatusBadRequest, err: fmt.Errorf(format, args...)}
+}
+
+// handle runs a request within the request timeout and a render slot and
+// writes its response or error.
+func (s *Server) handle(fn func(ctx context.Context, r *http.Request) (*response, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		ctx := r.Context()
+		if s.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.timeout)
+			defer cancel()
+		}
+
+		var resp *response
+		var err error
+		select {
+		case s.slots <- struct{}{}:
+			resp, err = fn(ctx, r)
+			<-s.slots
+		case <-ctx.Done():
+			err = &httpError{status: http.StatusServiceUnavailable, err: errors.New("server is busy, try again later")}
+		}
+
+		status := http.StatusOK
+		if err != nil {
+			var httpErr *httpError
+			switch {
+			case errors.As(err, &httpErr):
+				status = httpErr.status
+			case errors.Is(err, context.DeadlineExceeded):
+				status = http.StatusGatewayTimeout
+			default:
+				status = http.StatusInternalServerError
+			}
+			body, _ := json.Marshal(map[string]string{"error": err.Error()})
+			resp = &response{contentType: "application/json", body: append(body, '\n')}
+		}
+		w.Header().Set("Content-Type", resp.contentType)
+		w.WriteHeader(status)
+		w.Write(resp.body)
+
+		logCtx := logger.Log.WithFields(logrus.Fields{"method": r.Method, "path": r.URL.Path, "status": status, "duration": time.Since(started).Round(time.Millisecond).String()})
+		if err != nil {
+			logCtx.Warnf("Request failed: %v", err)
+		} else {
+			logCtx.Info("Request served")
+		}
+	})
+}
+
+// render handles POST /render.
+func (s *Server) render(ctx context.Context, r *http.Request) (*response, error) {
+	format, err := requestFormat(r)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRenderBodySize+1))
+	if err != nil {
+		return nil, badRequest("failed to read request body: %w", err)
+	}
+	if len(body) > maxRenderBodySize {
+		return nil, &httpError{status: http.StatusRequestEntityTooLarge, err: fmt.Errorf("request body exceeds %d bytes", maxRenderBodySize)}
+	}
+	parsed, err := argo.Parse(body, argo.ParseOptions{OnDuplicate: s.cfg.OnDuplicate, StrictValues: s.cfg.StrictValues})
+	if err != nil {
+		return nil, badRequest("%w", err)
+	}
+	if len(parsed.Applications) == 0 {
+		return nil, badRequest("no Argo CD Applications found in request body")
+	}
+	for _, app := range parsed.Applications {
+		if err := s.checkRepository(app.RepoURL); err != nil {
+			return nil, &httpError{status: http.StatusForbidden, err: fmt.Errorf("application '%s' from %s: %w", app.Name, app.Origin(), err)}
+		}
+	}
+	return s.renderApplications(ctx, parsed.Applications, format)
+}
+
+// checkRepository rejects a repository named in POST /render that is not a
+// remote git URL or whose host is not allowed, so a client cannot make the
+// server read its local files or send credentials to an arbitrary host.
+func (s *Server) checkRepository(repoURL string) error {
+	host := git.HostOf(repoURL)
+	if host == "" {
+		return fmt.Errorf("repository '%s' is not a remote git URL", repoURL)
+	}
+	if len(s.allowedHosts) > 0 && !slices.ContainsFunc(s.allowedHosts, func(allowed string) bool {
+		return strings.EqualFold(allowed, host)
+	}) {
+		return fmt.Errorf("host '%s' of repository '%s' is not allowed", host, repoURL)
+	}
+	return nil
+}
+
+// listApps handles GET /apps.
+func (s *Server) listApps(ctx context.Context, r *http.Request) (*response, error) {
+	result, err := List(ctx, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &response{contentType: "application/json", body: append(body, '\n')}, nil
+}
+
+// appManifest handles GET /apps/{name}/manifest.
+func (s *Server) appManifest(ctx context.Context, r *http.Request) (*response, error) {
+	format, err := requestFormat(r)
+	if err != nil {
+		return nil, err
+	}
+	name := r.PathValue("name")
+	applications, err := loadApplications(ctx, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range applications {
+		if app.Name == name {
+			return s.renderApplications(ctx, []argo.Application{app}, format)
+		}
+	}
+	return nil, &httpError{status: http.StatusNotFound, err: fmt.Errorf("application '%s' not found", name)}
+}
+
+// renderApplications clones and renders the applications into a single
+// manifest stream. A failed render fails the whole request.
+func (s *Server) renderApplications(ctx context.Context, applications []argo.Application, format string) (*response, error) {
+	var buf bytes.Buffer
+	writer, err := output.New(output.Stdout, output.Options{Format: format}, &buf)
+	if err != nil {
+		return nil, err
+	}
+	// Every request writes to its own output, the clones are shared.
+	state := *s.state
+	state.output = writer
+
+	for _, app := range applications {
+		if s.cfg.Mirror {
+			applyMirror(&app, applicationLogger(app))
+		}
+		result := ApplicationReport{Name: app.Name, Source: app.Origin()}
+		if _, err := processApplication(ctx, app, &state, &result); err != nil {
+			return nil, fmt.Errorf("application '%s' from %s: %w", app.Name, app.Origin(), err)
+		}
+		if result.Status == AppRenderFailed {
+			return nil, &httpError{status: http.StatusUnprocessableEntity, err: fmt.Errorf("application '%s' from %s: failed to render chart: %s", app.Name, app.Origin(), result.Error)}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return &response{contentType: contentType(format), body: buf.Bytes()}, nil
+}
+
+// requestFormat returns the manifest format from the 'format' query parameter.
+func requestFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return output.FormatYAML, nil
+	}
+	if !slices.Contains(output.Formats, format) {
+		return "", badRequest("unsupported format '%s' (supported: %s)", format, strings.Join(output.Formats, ", "))
+	}
+	return format, nil
+}
+
+func contentType(format string) string {
+	switch format {
+	case output.FormatJSON:
+		return "application/json"
+	case output.FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/yaml"
+	}
+}
@@ -0,0 +1,219 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const serveAppFile = `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: svc-a
+  labels: {env: dev}
+  annotations:
+    rawRepository: "https://git.example.com/svc-a.git"
+spec:
+  source:
+    targetRevision: master
+`
+
+// renderRequest - тело POST /render с одним приложением из repoURL
+func renderRequest(repoURL string) string {
+	return "apiVersion: argoproj.io/v1alpha1\nkind: Application\nmetadata: {name: svc}\nspec:\n  source:\n    repoURL: " + repoURL + "\n    path: svc\n    targetRevision: master\n"
+}
+
+func newTestServer(t *testing.T, opts ServeOptions) *Server {
+	t.Helper()
+	appFile := filepath.Join(t.TempDir(), "apps.yaml")
+	require.NoError(t, os.WriteFile(appFile, []byte(serveAppFile), 0644))
+
+	server, err := NewServer(Config{AppFiles: []string{appFile}}, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestServer_Requests(t *testing.T) {
+	server := newTestServer(t, ServeOptions{MaxConcurrent: 2})
+
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		body      string
+		status    int
+		wantError string
+	}{
+		{name: "unknown route", method: http.MethodGet, target: "/unknown", status: http.StatusNotFound},
+		{name: "wrong method", method: http.MethodGet, target: "/render", status: http.StatusMethodNotAllowed},
+		{name: "unknown application", method: http.MethodGet, target: "/apps/missing/manifest", status: http.StatusNotFound, wantError: "application 'missing' not found"},
+		{name: "unsupported format", method: http.MethodGet, target: "/apps/svc-a/manifest?format=zip", status: http.StatusBadRequest, wantError: "unsupported format 'zip'"},
+		{name: "invalid yaml", method: http.MethodPost, target: "/render", body: "kind: [", status: http.StatusBadRequest, wantError: "failed to decode yaml document"},
+		{name: "no applications", method: http.MethodPost, target: "/render", body: "kind: ConfigMap\n", status: http.StatusBadRequest, wantError: "no Argo CD Applications found"},
+		{name: "invalid application", method: http.MethodPost, target: "/render", body: "apiVersion: argoproj.io/v1alpha1\nkind: Application\nmetadata: {name: broken}\n", status: http.StatusBadRequest, wantError: "application 'broken' from document 1 is invalid"},
+		{name: "local repository", method: http.MethodPost, target: "/render", body: renderRequest("/srv/repos/secret"), status: http.StatusForbidden, wantError: "repository '/srv/repos/secret' is not a remote git URL"},
+		{name: "file repository", method: http.MethodPost, target: "/render", body: renderRequest("file:///srv/repos/secret"), status: http.StatusForbidden, wantError: "is not a remote git URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			require.Equal(t, tt.status, rec.Code)
+			if tt.wantError != "" {
+				var body map[string]string
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+				require.Contains(t, body["error"], tt.wantError)
+			}
+		})
+	}
+}
+
+func TestServer_CheckRepository(t *testing.T) {
+	server := newTestServer(t, ServeOptions{AllowedHosts: []string{"git.example.com"}})
+
+	require.NoError(t, server.checkRepository("https://git.example.com/org/svc.git"))
+	require.NoError(t, server.checkRepository("git@GIT.example.com:org/svc.git"))
+	require.EqualError(t, server.checkRepository("https://evil.example.com/org/svc.git"), "host 'evil.example.com' of repository 'https://evil.example.com/org/svc.git' is not allowed")
+	require.EqualError(t, server.checkRepository("../svc"), "repository '../svc' is not a remote git URL")
+
+	// Без --allowed-host разрешен любой удаленный хост
+	server = newTestServer(t, ServeOptions{})
+	require.NoError(t, server.checkRepository("https://evil.example.com/org/svc.git"))
+}
+
+func TestServer_ListApps(t *testing.T) {
+	server := newTestServer(t, ServeOptions{})
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/apps", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var result ListResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	require.Len(t, result.Applications, 1)
+	require.Equal(t, "svc-a", result.Applications[0].Name)
+	require.Equal(t, "dev", result.Applications[0].Env)
+}
+
+func TestServer_Busy(t *testing.T) {
+	server := newTestServer(t, ServeOptions{MaxConcurrent: 1, RequestTimeout: 50 * time.Millisecond})
+	// Единственный слот занят другим запросом
+	server.slots <- struct{}{}
+	defer func() { <-server.slots }()
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/apps", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), "server is busy")
+}
+
+func TestNewServer_Stdin(t *testing.T) {
+	_, err := NewServer(Config{AppFiles: []string{"-"}}, ServeOptions{})
+	require.ErrorContains(t, err, "stdin")
+}
+
+func TestCloneCache(t *testing.T) {
+	cache := newCloneCache(t.TempDir())
+
+	// Параллельные запросы одного репозитория ждут единственного клонирования
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	paths := make([]string, 3)
+	for i := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path, done, _, err := cache.get(context.Background(), "repo@master", func(path string) error {
+				fetches.Add(1)
+				<-release
+				return nil
+			})
+			require.NoError(t, err)
+			done()
+			paths[i] = path
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(1), fetches.Load())
+	require.Equal(t, paths[0], paths[1])
+	require.Equal(t, paths[0], paths[2])
+
+	// Неудачное клонирование не запоминается
+	_, _, _, err := cache.get(context.Background(), "repo@dev", func(string) error { return errors.New("boom") })
+	require.EqualError(t, err, "boom")
+	path, done, cached, err := cache.get(context.Background(), "repo@dev", func(string) error { return nil })
+	require.NoError(t, err)
+	done()
+	require.False(t, cached)
+	require.Equal(t, filepath.Join(cache.dir, "clone-3"), path)
+}
+
+func TestCloneCache_Expiry(t *testing.T) {
+	cache := newCloneCache(t.TempDir())
+	cache.ttl = time.Minute
+	cache.maxEntries = 2
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	get := func(key string) (string, func(), bool) {
+		t.Helper()
+		path, done, cached, err := cache.get(context.Background(), key, func(path string) error {
+			return os.MkdirAll(path, 0755)
+		})
+		require.NoError(t, err)
+		return path, done, cached
+	}
+
+	// В пределах ttl клон переиспользуется
+	first, done, _ := get("repo@master")
+	done()
+	now = now.Add(30 * time.Second)
+	path, done, cached := get("repo@master")
+	done()
+	require.True(t, cached)
+	require.Equal(t, first, path)
+
+	// После ttl репозиторий клонируется заново, старый клон удаляется
+	now = now.Add(time.Minute)
+	path, done, cached = get("repo@master")
+	require.False(t, cached)
+	require.NotEqual(t, first, path)
+	require.NoDirExists(t, first)
+
+	// Сверх maxEntries удаляется давно не использованный клон, но только
+	// после того, как с ним закончат работу
+	now = now.Add(time.Second)
+	dev, doneDev, _ := get("repo@dev")
+	doneDev()
+	now = now.Add(time.Second)
+	_, doneFeature, _ := get("repo@feature")
+	doneFeature()
+	require.Len(t, cache.clones, 2)
+	require.DirExists(t, path)
+	require.DirExists(t, dev)
+
+	now = now.Add(time.Second)
+	_, doneFix, _ := get("repo@fix")
+	doneFix()
+	require.NoDirExists(t, dev)
+	require.DirExists(t, path)
+	done()
+	require.NoDirExists(t, path)
+	require.Len(t, cache.clones, 2)
+}
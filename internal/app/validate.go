@@ -0,0 +1,80 @@
+package app
+
+import (
+	"errors"
+
+	"roar/internal/pkg/logger"
+	"roar/internal/pkg/manifest"
+	"roar/internal/pkg/validate"
+)
+
+// ResourceIssues lists problems found in a single rendered resource.
+type ResourceIssues struct {
+	Resource string   `json:"resource"`
+	Source   string   `json:"source,omitempty"`
+	Errors   []string `json:"errors"`
+}
+
+// parseManifests splits the rendered manifests into resources; the result is
+// parallel to results. With validating set, a manifest that is not valid YAML
+// marks its application invalid; otherwise it is only logged, as deprecation
+// and policy checks are not schema validation.
+func parseManifests(results []ApplicationReport, validating bool) [][]manifest.Resource {
+	parsed := make([][]manifest.Resource, len(results))
+	for i, result := range results {
+		data := result.manifest
+		if len(data) == 0 {
+			continue
+		}
+		resources, err := manifest.Parse(data)
+		if err != nil {
+			logCtx := logger.Log.WithField("application", results[i].Name)
+			if !validating {
+				logCtx.Warnf("Could not parse rendered manifest, skipping its checks: %v", err)
+				continue
+			}
+			logCtx.Errorf("Could not parse rendered manifest: %v", err)
+			results[i].Validation = append(results[i].Validation, ResourceIssues{Resource: "(manifest)", Errors: []string{err.Error()}})
+			results[i].Status = AppInvalid
+			continue
+		}
+		parsed[i] = resources
+	}
+	return parsed
+}
+
+// validateApplications checks the parsed resources against Kubernetes
+// schemas and records the problems in the report. CRDs rendered by any
+// application are registered first, so custom resources of other
+// applications are checked against them.
+func validateApplications(validator *validate.Validator, results []ApplicationReport, parsed [][]manifest.Resource) {
+	for i, resources := range parsed {
+		if err := validator.AddCRDs(resources); err != nil {
+			logger.Log.WithField("application", results[i].Name).Warnf("Could not use CRD schema: %v", err)
+		}
+	}
+
+	for i, resources := range parsed {
+		logCtx := logger.Log.WithField("application", results[i].Name)
+		for _, res := range resources {
+			errs, err := validator.Validate(res)
+			if errors.Is(err, validate.ErrSchemaNotFound) {
+				logCtx.Warnf("Skipping validation of %s: %v", res.ID(), err)
+				continue
+			}
+			if err != nil {
+				errs = []string{err.Error()}
+			}
+			if len(errs) == 0 {
+				continue
+			}
+			for _, e := range errs {
+				logCtx.WithField("resource", res.ID()).Errorf("Validation error: %s", e)
+			}
+			results[i].Validation = append(results[i].Validation, ResourceIssues{Resource: res.ID(), Source: res.Source, Errors: errs})
+		}
+		if len(results[i].Validation) > 0 {
+			results[i].Status = AppInvalid
+		}
+	}
+}
@@ -0,0 +1,585 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"roar/internal/pkg/argo"
+	"roar/internal/pkg/lock"
+	"roar/internal/pkg/logger"
+	"roar/internal/pkg/manifest"
+	"roar/internal/pkg/output"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// PollInterval is how often the watched paths are polled for changes
+	// when filesystem notifications are unavailable.
+	PollInterval time.Duration
+	// Out receives a summary of the changed manifests after every re-render.
+	Out io.Writer
+}
+
+// Watch renders all selected applications like Run and then watches the
+// app-of-apps chart, its values files, the application files and the locally
+// overridden repositories. After a change only the affected applications are
+// re-rendered: the ones whose Application changed in the app-of-apps output
+// and the ones using a changed overridden repository. Changes are detected
+// with filesystem notifications; where they are unavailable, e.g. when the
+// inotify watch limit is reached, Watch falls back to polling file sizes and
+// modification times every opts.PollInterval. Only the directories of
+// overridden repositories that the applications render from are watched.
+// Watch returns when ctx is canceled.
+func Watch(ctx context.Context, cfg Config, opts WatchOptions) (err error) {
+	if cfg.OutputArchive {
+		return errors.New("watch mode does not support archive output")
+	}
+	if slices.Contains(cfg.AppFiles, "-") {
+		return errors.New("stdin ('-') cannot be watched")
+	}
+	if cfg.Validate || cfg.CheckDeprecations || len(cfg.PolicyFiles) > 0 || cfg.ReportFile != "" {
+		logger.Log.Warn("Validation, deprecation and policy checks and the run report are skipped in watch mode")
+	}
+	overrides, err := normalizeRepoOverrides(cfg.RepoOverrides)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Git.Validate(); err != nil {
+		return err
+	}
+	var lockFile *lock.File
+	if cfg.Locked {
+		lockFile, err = loadLockFile(cfg.LockFile, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	tempDir, err := os.MkdirTemp("", "argo-charts-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+	logger.Log.Infof("Using temporary directory for clones: %s", tempDir)
+
+	writer, err := output.New(cfg.OutputDir, output.Options{Format: cfg.OutputFormat}, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := writer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	w := &watcher{
+		cfg: cfg,
+		out: opts.Out,
+		state: &appState{
+			clones:     newCloneCache(tempDir),
+			output:     writer,
+			mirror:     cfg.Mirror,
+			overrides:  overrides,
+			lock:       lockFile,
+			locked:     cfg.Locked,
+			creds:      &cfg.Git,
+			submodules: cfg.Submodules,
+			lfsDir:     cfg.LFSObjectsDir,
+			retry:      retryPolicy(cfg),
+			renderTime: cfg.RenderTimeout,
+
+			ignoreMissingValues: cfg.IgnoreMissingValues,
+		},
+		manifests: make(map[string][]byte),
+	}
+
+	detector := newChangeDetector(opts.PollInterval)
+	defer detector.close()
+
+	// The watched repository directories depend on the applications. Watch
+	// the chart before loading them and the repositories before the first
+	// render, so edits made meanwhile are not missed.
+	detector.watch(w.chartRoots())
+	applications, err := w.loadApplications(ctx)
+	if err != nil {
+		return fmt.Errorf("initialization failed: %w", err)
+	}
+	w.apps = applications
+	detector.watch(w.roots())
+	w.renderApplications(ctx, outputPaths(applications), false)
+	fmt.Fprintf(w.out, "Watching %d applications for changes...\n", len(w.apps))
+
+	for {
+		changed := detector.wait(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		logger.Log.Infof("Detected changes in %s", strings.Join(changed, ", "))
+		w.update(ctx, changed)
+		detector.watch(w.roots())
+	}
+}
+
+// watcher holds the state of Watch between re-renders.
+type watcher struct {
+	cfg   Config
+	out   io.Writer
+	state *appState
+	// apps are the selected applications in app-of-apps order and manifests
+	// their last successfully rendered manifests by output path, which, unlike
+	// the name, is unique.
+	apps      []argo.Application
+	manifests map[string][]byte
+}
+
+// roots returns the watched files and directories.
+func (w *watcher) roots() []string {
+	roots := append(w.chartRoots(), w.repoRoots()...)
+	sort.Strings(roots)
+	return slices.Compact(roots)
+}
+
+// repoRoots returns the watched directories of the overridden repositories.
+func (w *watcher) repoRoots() []string {
+	var roots []string
+	for _, app := range w.apps {
+		roots = append(roots, w.appRoots(app)...)
+	}
+	return roots
+}
+
+// appRoots returns the directories of the overridden repository of app that
+// its render reads: the service path and the directories of its values files,
+// as in a sparse checkout, or the whole repository when they are outside the
+// service path. Applications without an override have no roots.
+func (w *watcher) appRoots(app argo.Application) []string {
+	dir, ok := w.state.findRepoOverride(app.RepoURL)
+	if !ok {
+		return nil
+	}
+	dirs, sparse := collectSparseDirs([]argo.Application{app})[sourceKey(app)]
+	if !sparse {
+		return []string{dir}
+	}
+	roots := make([]string, len(dirs))
+	for i, rel := range dirs {
+		roots[i] = filepath.Join(dir, rel)
+	}
+	return roots
+}
+
+// chartRoots returns the paths the Application manifests are built from.
+func (w *watcher) chartRoots() []string {
+	if len(w.cfg.AppFiles) > 0 {
+		return slices.Clone(w.cfg.AppFiles)
+	}
+	return append([]string{w.cfg.ChartPath}, w.cfg.ValuesFiles...)
+}
+
+// loadApplications loads the selected applications with the mirror
+// transformation applied, as render does before cloning.
+func (w *watcher) loadApplications(ctx context.Context) ([]argo.Application, error) {
+	applications, err := loadApplications(ctx, w.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if w.state.mirror {
+		for i := range applications {
+			applyMirror(&applications[i], applicationLogger(applications[i]))
+		}
+	}
+	return applications, nil
+}
+
+// update re-renders the applications affected by changes in the changed roots.
+func (w *watcher) update(ctx context.Context, changed []string) {
+	affected := make(map[string]bool)
+	chartChanged := slices.ContainsFunc(w.chartRoots(), func(root string) bool {
+		return slices.Contains(changed, root)
+	})
+	if chartChanged {
+		if err := w.reload(ctx, affected); err != nil {
+			fmt.Fprintf(w.out, "! failed to reload applications: %v\n", err)
+		}
+	}
+	for _, app := range w.apps {
+		if slices.ContainsFunc(w.appRoots(app), func(root string) bool { return slices.Contains(changed, root) }) {
+			affected[app.OutputPath()] = true
+		}
+	}
+
+	var paths []string
+	for _, app := range w.apps {
+		if affected[app.OutputPath()] {
+			paths = append(paths, app.OutputPath())
+		}
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(w.out, "= no applications affected")
+		return
+	}
+	w.renderApplications(ctx, paths, true)
+}
+
+// reload loads the applications again, marking the new and changed ones as
+// affected and forgetting the removed ones. On error the previous
+// applications are kept.
+func (w *watcher) reload(ctx context.Context, affected map[string]bool) error {
+	applications, err := w.loadApplications(ctx)
+	if err != nil {
+		return err
+	}
+	previous := make(map[string]argo.Application, len(w.apps))
+	for _, app := range w.apps {
+		previous[app.OutputPath()] = app
+	}
+	for _, app := range applications {
+		if prev, ok := previous[app.OutputPath()]; !ok || !reflect.DeepEqual(prev, app) {
+			affected[app.OutputPath()] = true
+		}
+		delete(previous, app.OutputPath())
+	}
+	for _, outputPath := range slices.Sorted(maps.Keys(previous)) {
+		delete(w.manifests, outputPath)
+		fmt.Fprintf(w.out, "- %s: application removed\n", previous[outputPath].Name)
+	}
+	w.apps = applications
+	return nil
+}
+
+// renderApplications renders the applications with the given output paths,
+// printing what changed in their manifests when report is set.
+func (w *watcher) renderApplications(ctx context.Context, paths []string, report bool) {
+	for _, app := range w.apps {
+		if !slices.Contains(paths, app.OutputPath()) || ctx.Err() != nil {
+			continue
+		}
+		result := ApplicationReport{Name: app.Name, Source: app.Origin()}
+		rendered, err := processApplication(ctx, app, w.state, &result)
+		if err == nil && result.Status == AppRenderFailed {
+			err = errors.New(result.Error)
+		}
+		if err != nil {
+			applicationLogger(app).Errorf("Could not process application: %v", err)
+			if report {
+				fmt.Fprintf(w.out, "! %s: %v\n", app.Name, err)
+			}
+			continue
+		}
+
+		previous, existed := w.manifests[app.OutputPath()]
+		w.manifests[app.OutputPath()] = rendered
+		if report {
+			fmt.Fprintln(w.out, describeChanges(app.Name, previous, existed, rendered))
+		}
+	}
+}
+
+// describeChanges summarizes the difference between two manifests of an
+// application in a single line.
+func describeChanges(name string, before []byte, existed bool, after []byte) string {
+	if !existed {
+		return fmt.Sprintf("+ %s: new application", name)
+	}
+	changes, err := manifest.Diff(before, after)
+	if err != nil {
+		if string(before) == string(after) {
+			return fmt.Sprintf("= %s: no changes", name)
+		}
+		return fmt.Sprintf("~ %s: manifest changed", name)
+	}
+	if changes.Empty() {
+		return fmt.Sprintf("= %s: no changes", name)
+	}
+	var parts []string
+	for _, id := range changes.Added {
+		parts = append(parts, "+"+id)
+	}
+	for _, id := range changes.Changed {
+		parts = append(parts, "~"+id)
+	}
+	for _, id := range changes.Removed {
+		parts = append(parts, "-"+id)
+	}
+	return fmt.Sprintf("~ %s: %s", name, strings.Join(parts, " "))
+}
+
+// fileState is what polling compares to detect a changed file.
+type fileState struct {
+	size    int64
+	modTime int64
+	mode    fs.FileMode
+}
+
+// takeSnapshot records the state of every file under each root. Git metadata
+// is skipped; a missing root has no files.
+func takeSnapshot(roots []string) map[string]map[string]fileState {
+	snapshot := make(map[string]map[string]fileState, len(roots))
+	for _, root := range roots {
+		files := make(map[string]fileState)
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			files[path] = fileState{size: info.Size(), modTime: info.ModTime().UnixNano(), mode: info.Mode()}
+			return nil
+		})
+		snapshot[root] = files
+	}
+	return snapshot
+}
+
+// changedRoots returns the roots whose files differ between two snapshots.
+// Roots missing from before have just started to be watched, after the
+// applications using them were rendered, and are not reported.
+func changedRoots(before, after map[string]map[string]fileState) []string {
+	var changed []string
+	for root, files := range after {
+		if previous, ok := before[root]; ok && !maps.Equal(previous, files) {
+			changed = append(changed, root)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// notifyDelay is how long the change detector collects further notifications
+// after the first one, so that a save touching several files, or an editor
+// writing a temporary file and renaming it, causes a single re-render.
+const notifyDelay = 100 * time.Millisecond
+
+// changeDetector reports which of the watched roots changed. It uses
+// filesystem notifications (inotify, kqueue, FSEvents, ReadDirectoryChangesW)
+// and falls back to polling every interval when they are unavailable or a
+// directory cannot be watched.
+type changeDetector struct {
+	interval time.Duration
+	roots    []string
+
+	// notify watches every directory under the directory roots and the parent
+	// directory of the other roots; nil when polling.
+	notify  *fsnotify.Watcher
+	watched map[string]bool
+	// snapshot is the last polled state of the roots.
+	snapshot map[string]map[string]fileState
+}
+
+func newChangeDetector(interval time.Duration) *changeDetector {
+	d := &changeDetector{interval: interval, watched: make(map[string]bool)}
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		d.fallback(err)
+	} else {
+		d.notify = notify
+	}
+	return d
+}
+
+// fallback switches the detector to polling.
+func (d *changeDetector) fallback(err error) {
+	logger.Log.Warnf("Filesystem notifications are unavailable, polling for changes every %s: %v", d.interval, err)
+	if d.notify != nil {
+		d.notify.Close()
+		d.notify = nil
+	}
+	d.snapshot = takeSnapshot(d.roots)
+}
+
+// watch replaces the watched roots. Roots that were not watched before are
+// only compared with their state from now on.
+func (d *changeDetector) watch(roots []string) {
+	d.roots = roots
+	if d.notify != nil {
+		if err := d.watchDirs(); err != nil {
+			d.fallback(err)
+		}
+		return
+	}
+	next := takeSnapshot(roots)
+	for root, files := range d.snapshot {
+		if _, ok := next[root]; ok {
+			next[root] = files
+		}
+	}
+	d.snapshot = next
+}
+
+// watchDirs adds the directories of the roots to the notification watcher and
+// removes the ones no longer needed. A file is watched through its parent
+// directory, so that a file replaced by an editor or created later is noticed.
+func (d *changeDetector) watchDirs() error {
+	needed := make(map[string]bool)
+	for _, root := range d.roots {
+		if info, err := os.Stat(root); err == nil && info.IsDir() {
+			addDirs(root, needed)
+		} else if parent := filepath.Dir(root); isDir(parent) {
+			needed[parent] = true
+		}
+	}
+	for dir := range needed {
+		if !d.watched[dir] {
+			if err := d.notify.Add(dir); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", dir, err)
+			}
+			d.watched[dir] = true
+		}
+	}
+	for dir := range d.watched {
+		if !needed[dir] {
+			// The watch of a removed directory is already gone.
+			d.notify.Remove(dir)
+			delete(d.watched, dir)
+		}
+	}
+	return nil
+}
+
+// wait blocks until some roots changed and returns them. It returns nil when
+// ctx is canceled.
+func (d *changeDetector) wait(ctx context.Context) []string {
+	if d.notify == nil {
+		return d.poll(ctx)
+	}
+	changed := make(map[string]bool)
+	var delay <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-delay:
+			return slices.Sorted(maps.Keys(changed))
+		case event, ok := <-d.notify.Events:
+			if !ok {
+				return d.poll(ctx)
+			}
+			for _, root := range d.handle(event) {
+				changed[root] = true
+			}
+			if d.notify == nil {
+				// Switched to polling while handling the event.
+				return slices.Sorted(maps.Keys(changed))
+			}
+			if len(changed) > 0 && delay == nil {
+				delay = time.After(notifyDelay)
+			}
+		case err, ok := <-d.notify.Errors:
+			if !ok {
+				return d.poll(ctx)
+			}
+			// Events were lost, e.g. the kernel queue overflowed: treat
+			// every root as changed and let the renders sort it out.
+			logger.Log.Warnf("Filesystem notification error: %v", err)
+			for _, root := range d.roots {
+				changed[root] = true
+			}
+			if delay == nil {
+				delay = time.After(notifyDelay)
+			}
+		}
+	}
+}
+
+// handle returns the roots an event belongs to. Directories created under a
+// watched directory are watched as well; Git metadata and attribute-only
+// changes are ignored.
+func (d *changeDetector) handle(event fsnotify.Event) []string {
+	if event.Op == fsnotify.Chmod || filepath.Base(event.Name) == ".git" {
+		return nil
+	}
+	name := filepath.Clean(event.Name)
+	var changed []string
+	for _, root := range d.roots {
+		clean := filepath.Clean(root)
+		if name == clean || strings.HasPrefix(name, clean+string(filepath.Separator)) {
+			changed = append(changed, root)
+		}
+	}
+	if event.Has(fsnotify.Create) && len(changed) > 0 && isDir(name) {
+		dirs := make(map[string]bool)
+		addDirs(name, dirs)
+		for dir := range dirs {
+			if d.watched[dir] {
+				continue
+			}
+			if err := d.notify.Add(dir); err != nil {
+				d.fallback(fmt.Errorf("failed to watch %s: %w", dir, err))
+				return changed
+			}
+			d.watched[dir] = true
+		}
+	}
+	return changed
+}
+
+// poll compares the roots with their last snapshot every interval until some
+// of them changed.
+func (d *changeDetector) poll(ctx context.Context) []string {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		next := takeSnapshot(d.roots)
+		changed := changedRoots(d.snapshot, next)
+		d.snapshot = next
+		if len(changed) > 0 {
+			return changed
+		}
+	}
+}
+
+func (d *changeDetector) close() {
+	if d.notify != nil {
+		d.notify.Close()
+	}
+}
+
+// addDirs adds root and every directory under it except Git metadata to dirs.
+func addDirs(root string, dirs map[string]bool) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		dirs[filepath.Clean(path)] = true
+		return nil
+	})
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func outputPaths(applications []argo.Application) []string {
+	paths := make([]string, len(applications))
+	for i, app := range applications {
+		paths[i] = app.OutputPath()
+	}
+	return paths
+}
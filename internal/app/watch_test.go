@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"roar/internal/pkg/argo"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedRoots(t *testing.T) {
+	chart := t.TempDir()
+	repo := t.TempDir()
+	values := filepath.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("name: app-of-apps"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, ".git"), 0755))
+	roots := []string{chart, repo, values}
+
+	before := takeSnapshot(roots)
+	require.Empty(t, changedRoots(before, takeSnapshot(roots)))
+
+	// Изменения в .git не отслеживаются
+	require.NoError(t, os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/master"), 0644))
+	require.Empty(t, changedRoots(before, takeSnapshot(roots)))
+
+	// Появление отсутствовавшего файла и изменение файла в директории
+	require.NoError(t, os.WriteFile(values, []byte("env: dev"), 0644))
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(filepath.Join(chart, "Chart.yaml"), later, later))
+	want := []string{chart, values}
+	sort.Strings(want)
+	require.Equal(t, want, changedRoots(before, takeSnapshot(roots)))
+
+	// Только что добавленный корень не считается измененным
+	extra := t.TempDir()
+	require.Equal(t, want, changedRoots(before, takeSnapshot(append(roots, extra))))
+}
+
+// waitChanges ждет изменений не дольше timeout; nil - изменений не было
+func waitChanges(t *testing.T, d *changeDetector, timeout time.Duration) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.wait(ctx)
+}
+
+func TestChangeDetector(t *testing.T) {
+	tests := []struct {
+		name     string
+		detector func(t *testing.T) *changeDetector
+	}{
+		{name: "notifications", detector: func(t *testing.T) *changeDetector {
+			d := newChangeDetector(time.Hour)
+			if d.notify == nil {
+				t.Skip("filesystem notifications are unavailable")
+			}
+			return d
+		}},
+		{name: "polling", detector: func(t *testing.T) *changeDetector {
+			return &changeDetector{interval: 10 * time.Millisecond, watched: make(map[string]bool)}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chart := t.TempDir()
+			repo := t.TempDir()
+			values := filepath.Join(t.TempDir(), "values.yaml")
+			require.NoError(t, os.MkdirAll(filepath.Join(repo, ".git"), 0755))
+
+			d := tt.detector(t)
+			defer d.close()
+			d.watch([]string{chart, repo, values})
+
+			require.NoError(t, os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("name: app-of-apps"), 0644))
+			require.Equal(t, []string{chart}, waitChanges(t, d, 5*time.Second))
+
+			// Появление отсутствовавшего файла
+			require.NoError(t, os.WriteFile(values, []byte("env: dev"), 0644))
+			require.Equal(t, []string{values}, waitChanges(t, d, 5*time.Second))
+
+			// Файлы в новой директории тоже отслеживаются
+			require.NoError(t, os.Mkdir(filepath.Join(repo, "svc"), 0755))
+			require.Equal(t, []string{repo}, waitChanges(t, d, 5*time.Second))
+			require.NoError(t, os.WriteFile(filepath.Join(repo, "svc", "values.yaml"), []byte("replicas: 1"), 0644))
+			require.Equal(t, []string{repo}, waitChanges(t, d, 5*time.Second))
+
+			// Изменения в .git не отслеживаются
+			require.NoError(t, os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/master"), 0644))
+			require.Nil(t, waitChanges(t, d, 300*time.Millisecond))
+		})
+	}
+}
+
+func TestWatcherAppRoots(t *testing.T) {
+	repo := t.TempDir()
+	w := &watcher{state: &appState{overrides: map[string]string{normalizeRepoURL("https://git.example.com/org/mono.git"): repo}}}
+	app := func(path string, valuesFiles ...string) argo.Application {
+		return argo.Application{Name: "web", RepoURL: "https://git.example.com/org/mono.git", Path: path, TargetRevision: "master", ValuesFiles: valuesFiles}
+	}
+
+	// Опрашиваются только директория сервиса и директории values-файлов
+	require.Equal(t, []string{filepath.Join(repo, "envs"), filepath.Join(repo, "services/web")},
+		w.appRoots(app("services/web", "values.yaml", "../../envs/dev.yaml")))
+	// Сервис в корне или values-файлы вне репозитория - весь репозиторий
+	require.Equal(t, []string{repo}, w.appRoots(app(".")))
+	require.Equal(t, []string{repo}, w.appRoots(app("services/web", "../../../dev.yaml")))
+	// Без override опрашивать нечего
+	require.Empty(t, w.appRoots(argo.Application{RepoURL: "https://git.example.com/org/other.git", Path: "web"}))
+}
+
+func TestDescribeChanges(t *testing.T) {
+	before := []byte("kind: Deployment\nmetadata: {name: web}\nspec: {replicas: 1}\n---\nkind: Secret\nmetadata: {name: old}\n")
+	after := []byte("kind: Deployment\nmetadata: {name: web}\nspec: {replicas: 2}\n---\nkind: ConfigMap\nmetadata: {name: web}\n")
+
+	tests := []struct {
+		name    string
+		before  []byte
+		existed bool
+		after   []byte
+		want    string
+	}{
+		{name: "new application", after: after, want: "+ web: new application"},
+		{name: "changed resources", before: before, existed: true, after: after, want: "~ web: +ConfigMap/web ~Deployment/web -Secret/old"},
+		{name: "no changes", before: after, existed: true, after: after, want: "= web: no changes"},
+		{name: "unparsable manifest", before: []byte("a: ["), existed: true, after: []byte("b: ["), want: "~ web: manifest changed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, describeChanges("web", tt.before, tt.existed, tt.after))
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package argo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"roar/internal/pkg/logger"
+)
+
+// Переменные окружения, которые Argo CD передает Config Management Plugin
+const (
+	EnvAppName           = "ARGOCD_APP_NAME"
+	EnvAppNamespace      = "ARGOCD_APP_NAMESPACE"
+	EnvAppSourceRepoURL  = "ARGOCD_APP_SOURCE_REPO_URL"
+	EnvAppSourcePath     = "ARGOCD_APP_SOURCE_PATH"
+	EnvAppSourceRevision = "ARGOCD_APP_SOURCE_TARGET_REVISION"
+	// PluginEnvPrefix - префикс, с которым Argo CD передает spec.source.plugin.env
+	PluginEnvPrefix = "ARGOCD_ENV_"
+)
+
+// ApplicationFromEnv собирает Application из окружения CMP-плагина: имя,
+// репозиторий и ревизию из ARGOCD_APP_*, а WERF_SET_* и WERF_VALUES_* - из
+// ARGOCD_ENV_WERF_*. Манифесты рендерятся в текущей директории, поэтому Path
+// всегда ".". Меток Application плагин не получает, env и instance берутся
+// только из WERF_SET_ENV и WERF_SET_INSTANCE. strictValues - как в ParseOptions.
+func ApplicationFromEnv(environ []string, strictValues bool) (Application, error) {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if key, value, found := strings.Cut(kv, "="); found {
+			env[key] = value
+		}
+	}
+
+	var raw rawApplication
+	raw.ApiVersion = "argoproj.io/v1alpha1"
+	raw.Kind = "Application"
+	raw.Metadata.Name = env[EnvAppName]
+	if raw.Metadata.Name == "" {
+		return Application{}, fmt.Errorf("%s is not set, roar cmp must be run by Argo CD", EnvAppName)
+	}
+	raw.Metadata.Annotations = map[string]string{"rawRepository": env[EnvAppSourceRepoURL], "rawPath": "."}
+	raw.Spec.Source.RepoURL = env[EnvAppSourceRepoURL]
+	raw.Spec.Source.Path = env[EnvAppSourcePath]
+	raw.Spec.Source.TargetRevision = env[EnvAppSourceRevision]
+
+	var pluginEnv []EnvVar
+	for key, value := range env {
+		if name, ok := strings.CutPrefix(key, PluginEnvPrefix); ok && strings.HasPrefix(name, "WERF_") {
+			pluginEnv = append(pluginEnv, EnvVar{Name: name, Value: value})
+		}
+	}
+	// Порядок переменных окружения не определен; сортируем, чтобы разбор был воспроизводимым
+	sort.Slice(pluginEnv, func(i, j int) bool { return pluginEnv[i].Name < pluginEnv[j].Name })
+	raw.Spec.Source.Plugin = &struct {
+		Env []EnvVar `yaml:"env"`
+	}{Env: pluginEnv}
+
+	app, err := newApplicationFromRaw(raw, strictValues, logger.Log.WithField("application", raw.Metadata.Name))
+	if err != nil {
+		return Application{}, fmt.Errorf("application '%s' is invalid: %w", raw.Metadata.Name, err)
+	}
+	return app, nil
+}
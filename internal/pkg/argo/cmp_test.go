@@ -0,0 +1,61 @@
+package argo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplicationFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		environ       []string
+		expectedApp   Application
+		errorContains string
+	}{
+		{
+			name: "werf variables from plugin env",
+			environ: []string{
+				"PATH=/usr/bin",
+				"ARGOCD_APP_NAME=dev-web",
+				"ARGOCD_APP_NAMESPACE=web",
+				"ARGOCD_APP_SOURCE_REPO_URL=https://git.example.com/org/web.git",
+				"ARGOCD_APP_SOURCE_PATH=stable/web",
+				"ARGOCD_APP_SOURCE_TARGET_REVISION=main",
+				"ARGOCD_ENV_WERF_SET_ENV=global.env=dev",
+				"ARGOCD_ENV_WERF_SET_INSTANCE=global.instance=eu",
+				"ARGOCD_ENV_WERF_SET_IMAGE=image.tag=1.2=3",
+				"ARGOCD_ENV_WERF_VALUES_1=values/dev.yaml",
+				"ARGOCD_ENV_WERF_VALUES_0=values/common.yaml",
+				"ARGOCD_ENV_OTHER=ignored",
+			},
+			expectedApp: Application{
+				Name:           "dev-web",
+				Env:            "dev",
+				Instance:       "eu",
+				RepoURL:        "https://git.example.com/org/web.git",
+				Path:           ".",
+				TargetRevision: "main",
+				Setters:        map[string]string{"global.env": "dev", "global.instance": "eu", "image.tag": "1.2=3"},
+				ValuesFiles:    []string{"values/common.yaml", "values/dev.yaml"},
+				ValuesFileVars: []string{"WERF_VALUES_0", "WERF_VALUES_1"},
+			},
+		},
+		{
+			name:          "not run by argo cd",
+			environ:       []string{"PATH=/usr/bin"},
+			errorContains: "ARGOCD_APP_NAME is not set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := ApplicationFromEnv(tt.environ, false)
+			if tt.errorContains != "" {
+				require.ErrorContains(t, err, tt.errorContains)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedApp, app)
+		})
+	}
+}
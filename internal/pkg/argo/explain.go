@@ -0,0 +1,144 @@
+package argo
+
+import (
+	"bytes"
+	"fmt"
+
+	"roar/internal/pkg/logger"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Источники значений полей Application
+const (
+	SourceEnvLabel       = "metadata.labels.env"
+	SourceEnvPlugin      = "spec.source.plugin.env WERF_SET_ENV"
+	SourceInstanceLabel  = "metadata.labels.instance"
+	SourceInstancePlugin = "spec.source.plugin.env WERF_SET_INSTANCE"
+	SourceRawRepository  = "metadata.annotations.rawRepository"
+	SourceSpecRepoURL    = "spec.source.repoURL"
+	SourceRawPath        = "metadata.annotations.rawPath"
+	SourceSpecPath       = "spec.source.path"
+	SourceDefault        = "default"
+)
+
+// Candidate - возможный источник значения поля
+type Candidate struct {
+	Source  string `json:"source"`
+	Value   string `json:"value,omitempty"`
+	Present bool   `json:"present"`
+}
+
+// FieldResolution - кандидаты значения поля в порядке приоритета и выбранный из них
+type FieldResolution struct {
+	Candidates []Candidate `json:"candidates"`
+	// Source - выбранный источник; пусто, если значение не задано ни в одном
+	Source string `json:"source,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+func (f *FieldResolution) add(source, value string, present bool) {
+	f.Candidates = append(f.Candidates, Candidate{Source: source, Value: value, Present: present})
+}
+
+func (f *FieldResolution) choose(source, value string) string {
+	if value != "" {
+		f.Source, f.Value = source, value
+	}
+	return value
+}
+
+// Resolution описывает, как из манифеста получены поля Application
+type Resolution struct {
+	Env      FieldResolution `json:"env"`
+	Instance FieldResolution `json:"instance"`
+	RepoURL  FieldResolution `json:"repoURL"`
+	Path     FieldResolution `json:"path"`
+}
+
+// Explanation - приложение вместе с исходным манифестом и разбором его полей
+type Explanation struct {
+	Application Application
+	Resolution  Resolution
+	// Manifest - документ Application из вывода app-of-apps
+	Manifest string
+	// Skipped задан, если приложение отброшено фильтрами
+	Skipped *SkippedApplication
+}
+
+// Explain находит в манифестах app-of-apps все приложения с именем name и разбирает их
+// так же, как Parse. Фильтры не отбрасывают приложения, а только отмечаются в Skipped.
+// Приложения с одинаковым путем вывода обрабатываются по opts.OnDuplicate; при ошибке
+// разобранные приложения возвращаются вместе с ней.
+func Explain(yamlData []byte, name string, opts ParseOptions) ([]*Explanation, error) {
+	filters, err := ParseFilters(opts.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse filters: %w", err)
+	}
+
+	docs, err := decodeDocuments(yamlData)
+	if err != nil {
+		return nil, err
+	}
+	var explanations []*Explanation
+	for _, doc := range docs {
+		node := doc.node
+		kind, _ := getNodeValueByPath(node, "kind")
+		apiVersion, _ := getNodeValueByPath(node, "apiVersion")
+		nodeName, _ := getNodeValueByPath(node, "metadata.name")
+		if kind != "Application" || apiVersion != "argoproj.io/v1alpha1" || nodeName != name {
+			continue
+		}
+
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(node); err != nil {
+			return explanations, fmt.Errorf("failed to encode application '%s': %w", name, err)
+		}
+		explanation := &Explanation{Manifest: buf.String()}
+		explanations = append(explanations, explanation)
+
+		if passed, failedFilter := filters.MatchAll(node); !passed {
+			skipped := newSkippedApplication(node, name, doc.origin(), failedFilter)
+			explanation.Skipped = &skipped
+		}
+
+		var rawApp rawApplication
+		if err := node.Decode(&rawApp); err != nil {
+			return explanations, fmt.Errorf("failed to decode node into struct: %w", err)
+		}
+		app, resolution, err := resolveApplication(rawApp, opts.StrictValues, logger.Log.WithFields(logrus.Fields{"application": name, "source": doc.origin()}))
+		app.Source, app.Document = doc.source, doc.index
+		explanation.Application = app
+		explanation.Resolution = resolution
+		if err != nil {
+			return explanations, fmt.Errorf("application '%s' from %s is invalid: %w", name, doc.origin(), err)
+		}
+	}
+	if len(explanations) == 0 {
+		return nil, fmt.Errorf("application '%s' not found", name)
+	}
+
+	apps := make([]Application, len(explanations))
+	for i, explanation := range explanations {
+		apps[i] = explanation.Application
+	}
+	err = resolveDuplicates(apps, opts.OnDuplicate)
+	for i, explanation := range explanations {
+		explanation.Application = apps[i]
+	}
+	return explanations, err
+}
+
+func newSkippedApplication(node *yaml.Node, name, origin string, failedFilter *FilterCriteria) SkippedApplication {
+	value, found := getNodeValueByPath(node, failedFilter.Path)
+	return SkippedApplication{
+		Name:   name,
+		Filter: failedFilter.Path + failedFilter.Operator + failedFilter.Value,
+		Value:  value,
+		Found:  found,
+		Source: origin,
+	}
+}
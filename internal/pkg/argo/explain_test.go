@@ -0,0 +1,89 @@
+package argo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	yamlInput := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+  labels: {env: prod}
+spec:
+  source:
+    repoURL: https://git.example.com/org/web.git
+    targetRevision: main
+    plugin:
+      env:
+        - {name: WERF_SET_INSTANCE, value: global.instance=eu}
+        - {name: WERF_SET_ENV, value: global.env=prod}
+`
+
+	t.Run("resolution", func(t *testing.T) {
+		explanations, err := Explain([]byte(yamlInput), "web", ParseOptions{})
+		require.NoError(t, err)
+		require.Len(t, explanations, 1)
+		explanation := explanations[0]
+		require.Nil(t, explanation.Skipped)
+		require.Contains(t, explanation.Manifest, "kind: Application")
+		require.Equal(t, "prod", explanation.Application.Env)
+		require.Equal(t, "eu", explanation.Application.Instance)
+		require.Equal(t, "document 2", explanation.Application.Origin())
+
+		res := explanation.Resolution
+		require.Equal(t, SourceEnvLabel, res.Env.Source)
+		require.Equal(t, []Candidate{
+			{Source: SourceEnvLabel, Value: "prod", Present: true},
+			{Source: SourceEnvPlugin, Value: "prod", Present: true},
+		}, res.Env.Candidates)
+		require.Equal(t, SourceInstancePlugin, res.Instance.Source)
+		require.Equal(t, SourceSpecRepoURL, res.RepoURL.Source)
+		require.Equal(t, "https://git.example.com/org/web.git", res.RepoURL.Value)
+		require.Equal(t, SourceDefault, res.Path.Source)
+		require.Equal(t, ".", res.Path.Value)
+	})
+
+	t.Run("skipped by filter", func(t *testing.T) {
+		explanations, err := Explain([]byte(yamlInput), "web", ParseOptions{Filters: []string{"metadata.labels.env==dev"}})
+		require.NoError(t, err)
+		require.Equal(t, &SkippedApplication{Name: "web", Filter: "metadata.labels.env==dev", Value: "prod", Found: true, Source: "document 2"}, explanations[0].Skipped)
+	})
+
+	t.Run("every matching application", func(t *testing.T) {
+		// Приложение с тем же именем в другом env и точный дубликат
+		input := yamlInput + "---\n" + strings.ReplaceAll(yamlInput[strings.Index(yamlInput, "apiVersion: argoproj.io"):], "prod", "dev") + "---\n" + yamlInput[strings.Index(yamlInput, "apiVersion: argoproj.io"):]
+
+		explanations, err := Explain([]byte(input), "web", ParseOptions{OnDuplicate: DuplicateWarn})
+		require.NoError(t, err)
+		var origins, outputPaths []string
+		for _, explanation := range explanations {
+			origins = append(origins, explanation.Application.Origin())
+			outputPaths = append(outputPaths, explanation.Application.OutputPath())
+		}
+		require.Equal(t, []string{"document 2", "document 3", "document 4"}, origins)
+		require.Equal(t, []string{"prod/eu/web", "dev/eu/web", "prod/eu/web"}, outputPaths)
+
+		explanations, err = Explain([]byte(input), "web", ParseOptions{OnDuplicate: DuplicateSuffix})
+		require.NoError(t, err)
+		require.Equal(t, "prod/eu/web-2", explanations[2].Application.OutputPath())
+
+		explanations, err = Explain([]byte(input), "web", ParseOptions{OnDuplicate: DuplicateError})
+		require.EqualError(t, err, "duplicate application 'web' with output path 'prod/eu/web': defined in document 2 and document 4; use --on-duplicate to warn or add a suffix instead")
+		require.Len(t, explanations, 3)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := Explain([]byte(yamlInput), "api", ParseOptions{})
+		require.ErrorContains(t, err, "application 'api' not found")
+	})
+}
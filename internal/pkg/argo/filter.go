@@ -100,9 +100,18 @@ func (fs Filters) MatchAll(node *yaml.Node) (bool, *FilterCriteria) {
 
 // getNodeValueByPath ищет строковое значение в yaml.Node по dot-notation пути
 func getNodeValueByPath(node *yaml.Node, path string) (string, bool) {
-	if node == nil {
+	found := getNodeByPath(node, path)
+	if found == nil {
 		return "", false
 	}
+	return found.Value, true
+}
+
+// getNodeByPath ищет узел по dot-notation пути; nil, если его нет
+func getNodeByPath(node *yaml.Node, path string) *yaml.Node {
+	if node == nil {
+		return nil
+	}
 
 	parts := strings.Split(path, ".")
 	current := node
@@ -110,14 +119,14 @@ func getNodeValueByPath(node *yaml.Node, path string) (string, bool) {
 	// Если это DocumentNode, переходим к его контенту (обычно MappingNode)
 	if current.Kind == yaml.DocumentNode {
 		if len(current.Content) == 0 {
-			return "", false
+			return nil
 		}
 		current = current.Content[0]
 	}
 
 	for _, part := range parts {
 		if current.Kind != yaml.MappingNode {
-			return "", false
+			return nil
 		}
 
 		found := false
@@ -139,9 +148,9 @@ func getNodeValueByPath(node *yaml.Node, path string) (string, bool) {
 		}
 
 		if !found {
-			return "", false
+			return nil
 		}
 	}
 
-	return current.Value, true
+	return current
 }
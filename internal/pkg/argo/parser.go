@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"path"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,8 +24,50 @@ type Application struct {
 	TargetRevision string
 	Setters        map[string]string
 	ValuesFiles    []string
+	// ValuesFileVars - имена переменных WERF_VALUES_*, из которых взяты
+	// ValuesFiles, в том же порядке
+	ValuesFileVars []string
+	// PolicyExemptions - правила политик, которые не применяются к приложению
+	// (аннотация policyExemptions, через запятую; "*" - все правила)
+	PolicyExemptions []string
+	// Source - шаблон app-of-apps, из которого получен манифест (комментарий
+	// "# Source:" в выводе helm); пусто, если комментария нет
+	Source string
+	// Document - номер документа (с 1) среди документов шаблона Source,
+	// а если шаблон неизвестен - во всем потоке; 0 - приложение создано не Parse
+	Document int
+	// OutputName - имя манифеста приложения в раскладке вывода; пусто - Name.
+	// Отличается от Name, только если --on-duplicate suffix развел приложения
+	// с одинаковым путем вывода
+	OutputName string
 }
 
+// OutputPath - путь манифеста приложения в раскладке вывода без расширения:
+// env/instance/имя, пустые env и instance пропускаются
+func (a Application) OutputPath() string {
+	name := a.OutputName
+	if name == "" {
+		name = a.Name
+	}
+	return path.Join(a.Env, a.Instance, name)
+}
+
+// Origin описывает, откуда взят манифест приложения, для логов, ошибок и
+// отчетов: "app-of-apps/templates/web.yaml (document 2)"
+func (a Application) Origin() string {
+	switch {
+	case a.Document == 0:
+		return a.Source
+	case a.Source == "":
+		return fmt.Sprintf("document %d", a.Document)
+	default:
+		return fmt.Sprintf("%s (document %d)", a.Source, a.Document)
+	}
+}
+
+// PolicyExemptionsAnnotation - аннотация Application со списком исключений из политик
+const PolicyExemptionsAnnotation = "policyExemptions"
+
 type EnvVar struct {
 	Name  string `yaml:"name"`
 	Value string `yaml:"value"`
@@ -50,15 +93,72 @@ type rawApplication struct {
 	} `yaml:"spec"`
 }
 
+// ParseOptions - параметры разбора манифестов app-of-apps
+type ParseOptions struct {
+	// Filters - условия выборки вида "path==value" или "path!=value"
+	Filters []string
+	// OnDuplicate - что делать с приложениями с одинаковым путем вывода
+	// (env/instance/имя): DuplicateError (по умолчанию), DuplicateWarn или
+	// DuplicateSuffix
+	OnDuplicate string
+	// StrictValues включает строгую проверку переменных WERF_VALUES_*,
+	// см. extractAndSortValuesFiles
+	StrictValues bool
+}
+
+// Действия при повторяющихся путях вывода приложений
+const (
+	// DuplicateError - разбор завершается ошибкой
+	DuplicateError = "error"
+	// DuplicateWarn - в лог пишется предупреждение, приложения остаются как есть
+	DuplicateWarn = "warn"
+	// DuplicateSuffix - к имени манифеста повторяющегося приложения
+	// (OutputName) добавляется суффикс -2, -3, ...; имя приложения и релиза
+	// не меняется
+	DuplicateSuffix = "suffix"
+)
+
+// SkippedApplication - приложение, отброшенное фильтром
+type SkippedApplication struct {
+	Name string `json:"name"`
+	// Filter - первый фильтр, которому приложение не удовлетворило
+	Filter string `json:"filter"`
+	// Value - фактическое значение поля (пусто, если поля нет)
+	Value string `json:"value,omitempty"`
+	Found bool   `json:"found"`
+	// Source - откуда взят манифест, см. Application.Origin
+	Source string `json:"source,omitempty"`
+}
+
+// ParseResult - выбранные и отброшенные фильтрами приложения
+type ParseResult struct {
+	Applications []Application
+	Skipped      []SkippedApplication
+}
+
 // ParseApplications теперь принимает слайс строк фильтров
 func ParseApplications(yamlData []byte, filterStrs []string) ([]Application, error) {
-	var finalApps []Application
-	decoder := yaml.NewDecoder(bytes.NewReader(yamlData))
+	result, err := Parse(yamlData, ParseOptions{Filters: filterStrs})
+	if err != nil {
+		return nil, err
+	}
+	return result.Applications, nil
+}
+
+// Parse разбирает манифесты app-of-apps и возвращает выбранные приложения,
+// а также приложения, отброшенные фильтрами, с причиной
+func Parse(yamlData []byte, opts ParseOptions) (*ParseResult, error) {
+	result := &ParseResult{}
 
-	filters, err := ParseFilters(filterStrs)
+	filters, err := ParseFilters(opts.Filters)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse filters: %w", err)
 	}
+	switch opts.OnDuplicate {
+	case "", DuplicateError, DuplicateWarn, DuplicateSuffix:
+	default:
+		return nil, fmt.Errorf("unknown duplicate handling '%s' (expected %s, %s or %s)", opts.OnDuplicate, DuplicateError, DuplicateWarn, DuplicateSuffix)
+	}
 
 	if len(filters) > 0 {
 		for _, f := range filters {
@@ -66,34 +166,32 @@ func ParseApplications(yamlData []byte, filterStrs []string) ([]Application, err
 		}
 	}
 
-	for {
-		var node yaml.Node
-		err := decoder.Decode(&node)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode yaml document: %w", err)
-		}
-
+	docs, err := decodeDocuments(yamlData)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		node := doc.node
 		// Быстрая проверка типа ресурса
-		kind, _ := getNodeValueByPath(&node, "kind")
-		apiVersion, _ := getNodeValueByPath(&node, "apiVersion")
+		kind, _ := getNodeValueByPath(node, "kind")
+		apiVersion, _ := getNodeValueByPath(node, "apiVersion")
 
 		if kind != "Application" || apiVersion != "argoproj.io/v1alpha1" {
 			continue
 		}
 
-		name, _ := getNodeValueByPath(&node, "metadata.name")
+		name, _ := getNodeValueByPath(node, "metadata.name")
+		origin := doc.origin()
 
 		// Применяем все фильтры
 		if len(filters) > 0 {
 			// Для отладки логируем значения всех полей, участвующих в фильтрах
 			logFields := logrus.Fields{
-				"app": name,
+				"app":    name,
+				"source": origin,
 			}
 			for i, f := range filters {
-				val, found := getNodeValueByPath(&node, f.Path)
+				val, found := getNodeValueByPath(node, f.Path)
 				logFields[fmt.Sprintf("filter_%d_path", i)] = f.Path
 				logFields[fmt.Sprintf("filter_%d_found", i)] = val
 				logFields[fmt.Sprintf("filter_%d_exists", i)] = found
@@ -101,9 +199,10 @@ func ParseApplications(yamlData []byte, filterStrs []string) ([]Application, err
 			logger.Log.WithFields(logFields).Info("Checking filters")
 
 			// Проверяем совпадение
-			passed, failedFilter := filters.MatchAll(&node)
+			passed, failedFilter := filters.MatchAll(node)
 			if !passed {
-				logger.Log.WithField("application", name).Infof("Skipped by filter (%s %s '%s')", failedFilter.Path, failedFilter.Operator, failedFilter.Value)
+				logger.Log.WithFields(logrus.Fields{"application": name, "source": origin}).Infof("Skipped by filter (%s %s '%s')", failedFilter.Path, failedFilter.Operator, failedFilter.Value)
+				result.Skipped = append(result.Skipped, newSkippedApplication(node, name, origin, failedFilter))
 				continue
 			}
 		}
@@ -113,18 +212,149 @@ func ParseApplications(yamlData []byte, filterStrs []string) ([]Application, err
 			return nil, fmt.Errorf("failed to decode node into struct: %w", err)
 		}
 
-		logCtx := logger.Log.WithField("application", rawApp.Metadata.Name)
-		cleanApp, err := newApplicationFromRaw(rawApp, logCtx)
+		logCtx := logger.Log.WithFields(logrus.Fields{"application": rawApp.Metadata.Name, "source": origin})
+		cleanApp, err := newApplicationFromRaw(rawApp, opts.StrictValues, logCtx)
 		if err != nil {
-			return nil, fmt.Errorf("application '%s' is invalid: %w", rawApp.Metadata.Name, err)
+			return nil, fmt.Errorf("application '%s' from %s is invalid: %w", rawApp.Metadata.Name, origin, err)
+		}
+		cleanApp.Source, cleanApp.Document = doc.source, doc.index
+		result.Applications = append(result.Applications, cleanApp)
+	}
+
+	if err := resolveDuplicates(result.Applications, opts.OnDuplicate); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// resolveDuplicates находит приложения, которые записали бы манифест в один
+// и тот же путь вывода, и поступает с ними согласно mode. Приложения
+// с одинаковым именем, но разными env или instance не конфликтуют. Суффикс
+// добавляется к имени манифеста второго и следующих приложений так, чтобы
+// новый путь не совпадал ни с одним другим
+func resolveDuplicates(apps []Application, mode string) error {
+	paths := make(map[string]bool, len(apps))
+	for _, app := range apps {
+		paths[app.OutputPath()] = true
+	}
+	first := make(map[string]Application, len(apps))
+	counts := make(map[string]int, len(apps))
+	var duplicates []string
+	for i := range apps {
+		outputPath := apps[i].OutputPath()
+		counts[outputPath]++
+		prev, ok := first[outputPath]
+		if !ok {
+			first[outputPath] = apps[i]
+			continue
 		}
-		finalApps = append(finalApps, cleanApp)
+		name := apps[i].Name
+		message := fmt.Sprintf("duplicate application '%s' with output path '%s': defined in %s and %s", name, outputPath, prev.Origin(), apps[i].Origin())
+		switch mode {
+		case DuplicateWarn:
+			logger.Log.WithField("application", name).Warn(message)
+		case DuplicateSuffix:
+			apps[i].OutputName = fmt.Sprintf("%s-%d", name, counts[outputPath])
+			for n := counts[outputPath] + 1; paths[apps[i].OutputPath()]; n++ {
+				apps[i].OutputName = fmt.Sprintf("%s-%d", name, n)
+			}
+			paths[apps[i].OutputPath()] = true
+			logger.Log.WithField("application", name).Warnf("%s; writing the latter to '%s'", message, apps[i].OutputPath())
+		default:
+			duplicates = append(duplicates, message)
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("%s; use --on-duplicate to warn or add a suffix instead", strings.Join(duplicates, "; "))
 	}
+	return nil
+}
+
+// document - YAML-документ, шаблон, из которого он получен, и его номер
+type document struct {
+	node   *yaml.Node
+	source string
+	index  int
+}
 
-	return finalApps, nil
+func (d document) origin() string {
+	return Application{Source: d.source, Document: d.index}.Origin()
 }
 
-func newApplicationFromRaw(raw rawApplication, logCtx *logrus.Entry) (Application, error) {
+// decodeDocuments разбирает все YAML-документы. Элементы списков kind: List
+// (например, вывод "kubectl get applications -o yaml") возвращаются как отдельные
+// документы с номером списка. Пустые документы пропускаются и не нумеруются;
+// документ без комментария "# Source:" относится к шаблону предыдущего.
+func decodeDocuments(yamlData []byte) ([]document, error) {
+	var docs []document
+	source := ""
+	counts := make(map[string]int)
+	decoder := yaml.NewDecoder(bytes.NewReader(yamlData))
+	for {
+		node := &yaml.Node{}
+		err := decoder.Decode(node)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode yaml document: %w", err)
+		}
+
+		if len(node.Content) == 0 || node.Content[0].Tag == "!!null" {
+			continue
+		}
+		if s := sourceComment(node); s != "" {
+			source = s
+		}
+		counts[source]++
+		index := counts[source]
+
+		if kind, _ := getNodeValueByPath(node, "kind"); kind == "List" {
+			if items := getNodeByPath(node, "items"); items != nil && items.Kind == yaml.SequenceNode {
+				for _, item := range items.Content {
+					docs = append(docs, document{node: item, source: source, index: index})
+				}
+			}
+			continue
+		}
+		docs = append(docs, document{node: node, source: source, index: index})
+	}
+	return docs, nil
+}
+
+// sourceComment возвращает путь шаблона из комментария "# Source: ...",
+// которым helm template предваряет каждый документ. yaml.v3 относит этот
+// комментарий к документу, корневому узлу или первому ключу. Если таких
+// комментариев несколько, берется последний, ближайший к документу
+func sourceComment(node *yaml.Node) string {
+	comments := []string{node.HeadComment}
+	if len(node.Content) > 0 {
+		root := node.Content[0]
+		comments = append(comments, root.HeadComment)
+		if root.Kind == yaml.MappingNode && len(root.Content) > 0 {
+			comments = append(comments, root.Content[0].HeadComment)
+		}
+	}
+	source := ""
+	for _, comment := range comments {
+		for _, line := range strings.Split(comment, "\n") {
+			if s, ok := strings.CutPrefix(strings.TrimSpace(line), "# Source:"); ok {
+				source = strings.TrimSpace(s)
+			}
+		}
+	}
+	return source
+}
+
+func newApplicationFromRaw(raw rawApplication, strictValues bool, logCtx *logrus.Entry) (Application, error) {
+	app, _, err := resolveApplication(raw, strictValues, logCtx)
+	return app, err
+}
+
+// resolveApplication строит Application из манифеста и записывает, из каких
+// источников взяты env, instance, репозиторий и путь
+func resolveApplication(raw rawApplication, strictValues bool, logCtx *logrus.Entry) (Application, Resolution, error) {
+	var res Resolution
 	app := Application{
 		Name:           raw.Metadata.Name,
 		TargetRevision: raw.Spec.Source.TargetRevision,
@@ -132,19 +362,19 @@ func newApplicationFromRaw(raw rawApplication, logCtx *logrus.Entry) (Applicatio
 		ValuesFiles:    []string{},
 	}
 
-	var instanceFromLabel, envFromLabel string
-	if raw.Metadata.Labels != nil {
-		if val, ok := raw.Metadata.Labels["instance"]; ok {
-			instanceFromLabel = val
-		}
-		if val, ok := raw.Metadata.Labels["env"]; ok {
-			envFromLabel = val
-		}
-	}
+	instanceLabel, instanceLabelOK := raw.Metadata.Labels["instance"]
+	envLabel, envLabelOK := raw.Metadata.Labels["env"]
+	res.Instance.add(SourceInstanceLabel, instanceLabel, instanceLabelOK)
+	res.Env.add(SourceEnvLabel, envLabel, envLabelOK)
 
 	var instanceFromPlugin, envFromPlugin string
+	var instancePluginOK, envPluginOK bool
 	if raw.Spec.Source.Plugin != nil {
-		app.ValuesFiles = extractAndSortValuesFiles(raw.Spec.Source.Plugin.Env, logCtx)
+		var err error
+		app.ValuesFiles, app.ValuesFileVars, err = extractAndSortValuesFiles(raw.Spec.Source.Plugin.Env, strictValues, logCtx)
+		if err != nil {
+			return Application{}, res, err
+		}
 
 		for _, envVar := range raw.Spec.Source.Plugin.Env {
 			if strings.HasPrefix(envVar.Name, "WERF_SET_") {
@@ -152,10 +382,10 @@ func newApplicationFromRaw(raw rawApplication, logCtx *logrus.Entry) (Applicatio
 				if key != "" {
 					app.Setters[key] = value
 					if envVar.Name == "WERF_SET_INSTANCE" {
-						instanceFromPlugin = value
+						instanceFromPlugin, instancePluginOK = value, true
 					}
 					if envVar.Name == "WERF_SET_ENV" {
-						envFromPlugin = value
+						envFromPlugin, envPluginOK = value, true
 					}
 				} else {
 					logCtx.Warnf("Skipping invalid WERF_SET variable '%s' with value '%s'", envVar.Name, envVar.Value)
@@ -163,78 +393,141 @@ func newApplicationFromRaw(raw rawApplication, logCtx *logrus.Entry) (Applicatio
 			}
 		}
 	}
+	res.Instance.add(SourceInstancePlugin, instanceFromPlugin, instancePluginOK)
+	res.Env.add(SourceEnvPlugin, envFromPlugin, envPluginOK)
 
-	if instanceFromLabel != "" && instanceFromPlugin != "" && instanceFromLabel != instanceFromPlugin {
-		return Application{}, fmt.Errorf("conflicting values for 'instance': label is '%s', plugin.env is '%s'", instanceFromLabel, instanceFromPlugin)
+	if instanceLabel != "" && instanceFromPlugin != "" && instanceLabel != instanceFromPlugin {
+		return Application{}, res, fmt.Errorf("conflicting values for 'instance': label is '%s', plugin.env is '%s'", instanceLabel, instanceFromPlugin)
 	}
-	if instanceFromLabel != "" {
-		app.Instance = instanceFromLabel
+	if instanceLabel != "" {
+		app.Instance = res.Instance.choose(SourceInstanceLabel, instanceLabel)
 	} else {
-		app.Instance = instanceFromPlugin
+		app.Instance = res.Instance.choose(SourceInstancePlugin, instanceFromPlugin)
 	}
 
-	if envFromLabel != "" && envFromPlugin != "" && envFromLabel != envFromPlugin {
-		return Application{}, fmt.Errorf("conflicting values for 'env': label is '%s', plugin.env is '%s'", envFromLabel, envFromPlugin)
+	if envLabel != "" && envFromPlugin != "" && envLabel != envFromPlugin {
+		return Application{}, res, fmt.Errorf("conflicting values for 'env': label is '%s', plugin.env is '%s'", envLabel, envFromPlugin)
 	}
-	if envFromLabel != "" {
-		app.Env = envFromLabel
+	if envLabel != "" {
+		app.Env = res.Env.choose(SourceEnvLabel, envLabel)
 	} else {
-		app.Env = envFromPlugin
+		app.Env = res.Env.choose(SourceEnvPlugin, envFromPlugin)
 	}
 
 	repoURL, ok := raw.Metadata.Annotations["rawRepository"]
+	res.RepoURL.add(SourceRawRepository, repoURL, ok)
+	res.RepoURL.add(SourceSpecRepoURL, raw.Spec.Source.RepoURL, raw.Spec.Source.RepoURL != "")
 	if !ok || repoURL == "" {
 		logCtx.Warnf("missing 'rawRepository' annotation. Falling back to spec.source.repoURL='%s'", raw.Spec.Source.RepoURL)
 		repoURL = raw.Spec.Source.RepoURL
 		if repoURL == "" {
-			return Application{}, fmt.Errorf("both 'rawRepository' annotation and 'spec.source.repoURL' are empty")
+			return Application{}, res, fmt.Errorf("both 'rawRepository' annotation and 'spec.source.repoURL' are empty")
 		}
+		app.RepoURL = res.RepoURL.choose(SourceSpecRepoURL, repoURL)
+	} else {
+		app.RepoURL = res.RepoURL.choose(SourceRawRepository, repoURL)
 	}
-	app.RepoURL = repoURL
 
 	path, ok := raw.Metadata.Annotations["rawPath"]
+	res.Path.add(SourceRawPath, path, ok)
+	res.Path.add(SourceSpecPath, raw.Spec.Source.Path, raw.Spec.Source.Path != "")
 	if !ok {
 		logCtx.Warnf("missing 'rawPath' annotation. Falling back to spec.source.path='%s'", raw.Spec.Source.Path)
 		path = raw.Spec.Source.Path
 		if path == "" {
 			logCtx.Warn("both 'rawPath' annotation and 'spec.source.path' are empty. Falling back to '.'")
-			path = "."
+			app.Path = res.Path.choose(SourceDefault, ".")
+		} else {
+			app.Path = res.Path.choose(SourceSpecPath, path)
 		}
+	} else {
+		app.Path = res.Path.choose(SourceRawPath, path)
 	}
-	app.Path = path
 
-	return app, nil
+	if exemptions, ok := raw.Metadata.Annotations[PolicyExemptionsAnnotation]; ok {
+		for _, rule := range strings.Split(exemptions, ",") {
+			if rule = strings.TrimSpace(rule); rule != "" {
+				app.PolicyExemptions = append(app.PolicyExemptions, rule)
+			}
+		}
+	}
+
+	return app, res, nil
 }
 
-func extractAndSortValuesFiles(envVars []EnvVar, logCtx *logrus.Entry) []string {
+// valuesFilesPrefix - префикс переменных plugin.env с values-файлами
+const valuesFilesPrefix = "WERF_VALUES_"
+
+// extractAndSortValuesFiles возвращает values-файлы из WERF_VALUES_* в порядке
+// индексов и имена переменных, из которых они взяты. Переменные с одинаковым
+// индексом идут в порядке манифеста, переменные без числового индекса
+// пропускаются.
+//
+// В строгом режиме повторяющиеся индексы (WERF_VALUES_1 и WERF_VALUES_01)
+// и имена - ошибка, о пропусках в нумерации пишется предупреждение, а
+// переменные с суффиксом-словом, как в werf (WERF_VALUES_PROD), идут после
+// нумерованных в алфавитном порядке.
+func extractAndSortValuesFiles(envVars []EnvVar, strict bool, logCtx *logrus.Entry) ([]string, []string, error) {
 	type indexedValueFile struct {
 		index int
 		path  string
+		name  string
 	}
-	var indexedValues []indexedValueFile
+	var indexedValues, namedValues []indexedValueFile
+	seen := make(map[string]string)
 
 	for _, envVar := range envVars {
-		if strings.HasPrefix(envVar.Name, "WERF_VALUES_") {
-			indexStr := strings.TrimPrefix(envVar.Name, "WERF_VALUES_")
-			index, err := strconv.Atoi(indexStr)
-			if err != nil {
+		suffix, ok := strings.CutPrefix(envVar.Name, valuesFilesPrefix)
+		if !ok {
+			continue
+		}
+		index, err := strconv.Atoi(suffix)
+		if err != nil || index < 0 {
+			if !strict || suffix == "" {
 				logCtx.Warnf("Could not parse index from '%s'. Skipping.", envVar.Name)
 				continue
 			}
-			indexedValues = append(indexedValues, indexedValueFile{index: index, path: envVar.Value})
+			if prev, ok := seen[suffix]; ok {
+				return nil, nil, fmt.Errorf("duplicate values file variable %s: '%s' and '%s'", envVar.Name, prev, envVar.Value)
+			}
+			seen[suffix] = envVar.Value
+			namedValues = append(namedValues, indexedValueFile{path: envVar.Value, name: envVar.Name})
+			continue
 		}
+		if strict {
+			for _, iv := range indexedValues {
+				if iv.index == index {
+					return nil, nil, fmt.Errorf("duplicate values file index %d: %s='%s' and %s='%s'", index, iv.name, iv.path, envVar.Name, envVar.Value)
+				}
+			}
+		}
+		indexedValues = append(indexedValues, indexedValueFile{index: index, path: envVar.Value, name: envVar.Name})
 	}
 
-	sort.Slice(indexedValues, func(i, j int) bool {
+	sort.SliceStable(indexedValues, func(i, j int) bool {
 		return indexedValues[i].index < indexedValues[j].index
 	})
+	if strict {
+		for i := 1; i < len(indexedValues); i++ {
+			prev, next := indexedValues[i-1].index, indexedValues[i].index
+			if next > prev+1 {
+				logCtx.Warnf("Values file indices skip from %s to %s", indexedValues[i-1].name, indexedValues[i].name)
+			}
+		}
+		sort.Slice(namedValues, func(i, j int) bool {
+			return namedValues[i].name < namedValues[j].name
+		})
+		indexedValues = append(indexedValues, namedValues...)
+	}
 
 	sortedValuesFiles := make([]string, len(indexedValues))
+	var names []string
 	for i, iv := range indexedValues {
 		sortedValuesFiles[i] = iv.path
+		names = append(names, iv.name)
 	}
 
-	return sortedValuesFiles
+	return sortedValuesFiles, names, nil
 }
 
 func extractKeyValueFromWerfSet(s string) (string, string) {
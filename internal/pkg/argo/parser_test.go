@@ -140,6 +140,253 @@ spec:
 	require.Contains(t, logOutput, "spec.source.targetRevision == 'master'")
 }
 
+func TestParse_Skipped(t *testing.T) {
+	yamlInput := `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: app-to-keep
+  labels: {env: prod}
+  annotations: {rawRepository: "repo"}
+spec:
+  source:
+    targetRevision: master
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: wrong-revision
+  labels: {env: prod}
+  annotations: {rawRepository: "repo"}
+spec:
+  source:
+    targetRevision: dev
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: no-env
+  annotations: {rawRepository: "repo"}
+spec:
+  source:
+    targetRevision: master
+`
+
+	result, err := Parse([]byte(yamlInput), ParseOptions{Filters: []string{"metadata.labels.env==prod", "spec.source.targetRevision==master"}})
+	require.NoError(t, err)
+	require.Len(t, result.Applications, 1)
+	require.Equal(t, "app-to-keep", result.Applications[0].Name)
+	require.Equal(t, []SkippedApplication{
+		{Name: "wrong-revision", Filter: "spec.source.targetRevision==master", Value: "dev", Found: true, Source: "document 2"},
+		{Name: "no-env", Filter: "metadata.labels.env==prod", Found: false, Source: "document 3"},
+	}, result.Skipped)
+}
+
+// Вывод "kubectl get applications -o yaml" - список kind: List
+func TestParse_List(t *testing.T) {
+	yamlInput := `
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: argoproj.io/v1alpha1
+    kind: Application
+    metadata:
+      name: first
+      annotations: {rawRepository: "repo"}
+    spec:
+      source: {targetRevision: master}
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: not-an-app
+  - apiVersion: argoproj.io/v1alpha1
+    kind: Application
+    metadata:
+      name: second
+      labels: {env: dev}
+      annotations: {rawRepository: "repo"}
+    spec:
+      source: {targetRevision: master}
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: third
+  annotations: {rawRepository: "repo"}
+spec:
+  source: {targetRevision: master}
+`
+
+	result, err := Parse([]byte(yamlInput), ParseOptions{Filters: []string{"metadata.labels.env!=dev"}})
+	require.NoError(t, err)
+	var names []string
+	for _, app := range result.Applications {
+		names = append(names, app.Name)
+	}
+	require.Equal(t, []string{"first", "third"}, names)
+	require.Equal(t, []SkippedApplication{{Name: "second", Filter: "metadata.labels.env!=dev", Value: "dev", Found: true, Source: "document 1"}}, result.Skipped)
+}
+
+func TestParse_Duplicates(t *testing.T) {
+	yamlInput := `
+---
+# Source: app-of-apps/templates/web.yaml
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+  labels: {env: dev}
+  annotations: {rawRepository: "repo"}
+spec:
+  source: {targetRevision: master}
+---
+# Source: app-of-apps/templates/legacy.yaml
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+  labels: {env: dev}
+  annotations: {rawRepository: "repo"}
+spec:
+  source: {targetRevision: legacy}
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web-2
+  labels: {env: dev}
+  annotations: {rawRepository: "repo"}
+spec:
+  source: {targetRevision: master}
+---
+# Source: app-of-apps/templates/prod.yaml
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+  labels: {env: prod}
+  annotations: {rawRepository: "repo"}
+spec:
+  source: {targetRevision: master}
+`
+
+	tests := []struct {
+		name          string
+		onDuplicate   string
+		expectedPaths []string
+		expectedErr   string
+	}{
+		{
+			name:        "error by default",
+			expectedErr: "duplicate application 'web' with output path 'dev/web': defined in app-of-apps/templates/web.yaml (document 1) and app-of-apps/templates/legacy.yaml (document 1); use --on-duplicate to warn or add a suffix instead",
+		},
+		{
+			name:          "warn keeps both",
+			onDuplicate:   DuplicateWarn,
+			expectedPaths: []string{"dev/web", "dev/web", "dev/web-2", "prod/web"},
+		},
+		{
+			name:          "suffix skips taken paths",
+			onDuplicate:   DuplicateSuffix,
+			expectedPaths: []string{"dev/web", "dev/web-3", "dev/web-2", "prod/web"},
+		},
+		{
+			name:        "unknown mode",
+			onDuplicate: "ignore",
+			expectedErr: "unknown duplicate handling 'ignore' (expected error, warn or suffix)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Parse([]byte(yamlInput), ParseOptions{OnDuplicate: tt.onDuplicate})
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			var names, paths, origins []string
+			for _, app := range result.Applications {
+				names = append(names, app.Name)
+				paths = append(paths, app.OutputPath())
+				origins = append(origins, app.Origin())
+			}
+			// Суффикс меняет только путь вывода, имя приложения и релиза остается
+			require.Equal(t, []string{"web", "web", "web-2", "web"}, names)
+			require.Equal(t, tt.expectedPaths, paths)
+			// Документ без "# Source:" относится к предыдущему шаблону
+			require.Equal(t, []string{
+				"app-of-apps/templates/web.yaml (document 1)",
+				"app-of-apps/templates/legacy.yaml (document 1)",
+				"app-of-apps/templates/legacy.yaml (document 2)",
+				"app-of-apps/templates/prod.yaml (document 1)",
+			}, origins)
+		})
+	}
+}
+
+func TestParse_SameNameInDifferentEnvs(t *testing.T) {
+	yamlInput := `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+  labels: {env: dev, instance: inf1}
+  annotations: {rawRepository: "repo"}
+spec:
+  source: {targetRevision: master}
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+  labels: {env: dev, instance: inf2}
+  annotations: {rawRepository: "repo"}
+spec:
+  source: {targetRevision: master}
+`
+	// Разные instance - разные файлы вывода, это не повтор
+	result, err := Parse([]byte(yamlInput), ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, result.Applications, 2)
+	require.Equal(t, "dev/inf1/web", result.Applications[0].OutputPath())
+	require.Equal(t, "dev/inf2/web", result.Applications[1].OutputPath())
+}
+
+func TestParse_Origin(t *testing.T) {
+	app := func(name string) string {
+		return "apiVersion: argoproj.io/v1alpha1\nkind: Application\nmetadata: {name: " + name + ", annotations: {rawRepository: repo}}\n"
+	}
+	yamlInput := "---\n# Source: root/templates/apps.yaml\n" + app("first") +
+		"---\n# Source: root/templates/apps.yaml\n" + app("second") +
+		// Пустой документ не нумеруется
+		"---\n---\n# Source: root/templates/other.yaml\n" + app("third") +
+		// Документ без "# Source:" относится к предыдущему шаблону
+		"---\n" + app("fourth") +
+		// Последний комментарий ближе к документу
+		"---\n# Source: apps.yaml\n# Source: root/templates/list.yaml\napiVersion: v1\nkind: List\nitems:\n" +
+		"  - {apiVersion: argoproj.io/v1alpha1, kind: Application, metadata: {name: fifth, annotations: {rawRepository: repo}}}\n"
+
+	result, err := Parse([]byte(yamlInput), ParseOptions{})
+	require.NoError(t, err)
+	var origins []string
+	for _, app := range result.Applications {
+		origins = append(origins, app.Name+": "+app.Origin())
+	}
+	require.Equal(t, []string{
+		"first: root/templates/apps.yaml (document 1)",
+		"second: root/templates/apps.yaml (document 2)",
+		"third: root/templates/other.yaml (document 1)",
+		"fourth: root/templates/other.yaml (document 2)",
+		"fifth: root/templates/list.yaml (document 1)",
+	}, origins)
+
+	_, err = Parse([]byte(app("broken")+"---\n"+"apiVersion: argoproj.io/v1alpha1\nkind: Application\nmetadata: {name: broken}\n"), ParseOptions{})
+	require.ErrorContains(t, err, "application 'broken' from document 2 is invalid")
+
+	require.Equal(t, "", Application{Name: "from-env"}.Origin())
+}
+
 // TestParseApplications проверяет высокоуровневую логику парсинга
 func TestParseApplications(t *testing.T) {
 	testCases := []struct {
@@ -443,6 +690,7 @@ func TestNewApplicationFromRaw(t *testing.T) {
 				Path:           ".",
 				TargetRevision: "main",
 				ValuesFiles:    []string{"values/common.yaml", "values/overlay.yaml", "values/prod.yaml"},
+				ValuesFileVars: []string{"WERF_VALUES_0", "WERF_VALUES_1", "WERF_VALUES_2"},
 				Setters:        map[string]string{},
 			},
 		},
@@ -473,6 +721,23 @@ func TestNewApplicationFromRaw(t *testing.T) {
 				ValuesFiles: []string{},
 			},
 		},
+		{
+			name: "policy exemptions from annotation",
+			inputRawApp: func() rawApplication {
+				app := baseRawApp()
+				app.Metadata.Annotations[PolicyExemptionsAnnotation] = "no-latest-tag, resource-limits,"
+				return app
+			}(),
+			expectedApp: Application{
+				Name:             "test-app",
+				RepoURL:          "https://default.repo",
+				Path:             ".",
+				TargetRevision:   "main",
+				Setters:          map[string]string{},
+				ValuesFiles:      []string{},
+				PolicyExemptions: []string{"no-latest-tag", "resource-limits"},
+			},
+		},
 	}
 
 	testLogger := logrus.New()
@@ -481,7 +746,7 @@ func TestNewApplicationFromRaw(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			cleanApp, err := newApplicationFromRaw(tc.inputRawApp, logCtx)
+			cleanApp, err := newApplicationFromRaw(tc.inputRawApp, false, logCtx)
 
 			if tc.expectError {
 				require.Error(t, err)
@@ -509,7 +774,8 @@ func TestExtractAndSortValuesFiles(t *testing.T) {
 		{Name: "IRRELEVANT_VAR", Value: "foo"},
 	}
 
-	sorted := extractAndSortValuesFiles(envVars, logCtx)
+	sorted, names, err := extractAndSortValuesFiles(envVars, false, logCtx)
+	require.NoError(t, err)
 
 	expected := []string{
 		"val-0.yaml",
@@ -519,4 +785,101 @@ func TestExtractAndSortValuesFiles(t *testing.T) {
 	}
 
 	require.Equal(t, expected, sorted, "Values files should be sorted numerically by index")
+	require.Equal(t, []string{"WERF_VALUES_0", "WERF_VALUES_1", "WERF_VALUES_2", "WERF_VALUES_10"}, names)
+}
+
+func TestExtractAndSortValuesFiles_Strict(t *testing.T) {
+	tests := []struct {
+		name          string
+		strict        bool
+		envVars       []EnvVar
+		expectedFiles []string
+		expectedNames []string
+		expectedErr   string
+		expectedLog   string
+	}{
+		{
+			name: "duplicate indices keep manifest order",
+			envVars: []EnvVar{
+				{Name: "WERF_VALUES_1", Value: "b.yaml"},
+				{Name: "WERF_VALUES_01", Value: "a.yaml"},
+				{Name: "WERF_VALUES_PROD", Value: "prod.yaml"},
+			},
+			expectedFiles: []string{"b.yaml", "a.yaml"},
+			expectedNames: []string{"WERF_VALUES_1", "WERF_VALUES_01"},
+			expectedLog:   "Could not parse index from 'WERF_VALUES_PROD'",
+		},
+		{
+			name:   "strict rejects duplicate indices",
+			strict: true,
+			envVars: []EnvVar{
+				{Name: "WERF_VALUES_1", Value: "b.yaml"},
+				{Name: "WERF_VALUES_01", Value: "a.yaml"},
+			},
+			expectedErr: "duplicate values file index 1: WERF_VALUES_1='b.yaml' and WERF_VALUES_01='a.yaml'",
+		},
+		{
+			name:   "strict rejects duplicate named suffixes",
+			strict: true,
+			envVars: []EnvVar{
+				{Name: "WERF_VALUES_PROD", Value: "prod.yaml"},
+				{Name: "WERF_VALUES_PROD", Value: "prod-eu.yaml"},
+			},
+			expectedErr: "duplicate values file variable WERF_VALUES_PROD: 'prod.yaml' and 'prod-eu.yaml'",
+		},
+		{
+			name:   "strict warns on gaps and puts named suffixes last",
+			strict: true,
+			envVars: []EnvVar{
+				{Name: "WERF_VALUES_SECRETS", Value: "secrets.yaml"},
+				{Name: "WERF_VALUES_3", Value: "dev.yaml"},
+				{Name: "WERF_VALUES_PROD", Value: "prod.yaml"},
+				{Name: "WERF_VALUES_0", Value: "common.yaml"},
+			},
+			expectedFiles: []string{"common.yaml", "dev.yaml", "prod.yaml", "secrets.yaml"},
+			expectedNames: []string{"WERF_VALUES_0", "WERF_VALUES_3", "WERF_VALUES_PROD", "WERF_VALUES_SECRETS"},
+			expectedLog:   "Values file indices skip from WERF_VALUES_0 to WERF_VALUES_3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logBuffer bytes.Buffer
+			testLogger := logrus.New()
+			testLogger.SetOutput(&logBuffer)
+
+			files, names, err := extractAndSortValuesFiles(tt.envVars, tt.strict, logrus.NewEntry(testLogger))
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedFiles, files)
+			require.Equal(t, tt.expectedNames, names)
+			require.Contains(t, logBuffer.String(), tt.expectedLog)
+		})
+	}
+}
+
+func TestParse_StrictValues(t *testing.T) {
+	yamlInput := `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+  annotations: {rawRepository: "repo"}
+spec:
+  source:
+    plugin:
+      env:
+        - {name: WERF_VALUES_0, value: values.yaml}
+        - {name: WERF_VALUES_00, value: values-dev.yaml}
+`
+
+	_, err := Parse([]byte(yamlInput), ParseOptions{StrictValues: true})
+	require.EqualError(t, err, "application 'web' from document 1 is invalid: duplicate values file index 0: WERF_VALUES_0='values.yaml' and WERF_VALUES_00='values-dev.yaml'")
+
+	result, err := Parse([]byte(yamlInput), ParseOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"values.yaml", "values-dev.yaml"}, result.Applications[0].ValuesFiles)
 }
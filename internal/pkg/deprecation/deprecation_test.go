@@ -0,0 +1,44 @@
+package deprecation
+
+import (
+	"testing"
+
+	"roar/internal/pkg/manifest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_Check(t *testing.T) {
+	pdb := manifest.Resource{APIVersion: "policy/v1beta1", Kind: "PodDisruptionBudget", Name: "web"}
+	ingress := manifest.Resource{APIVersion: "extensions/v1beta1", Kind: "Ingress", Name: "web"}
+	current := manifest.Resource{APIVersion: "apps/v1", Kind: "Deployment", Name: "web"}
+
+	tests := []struct {
+		name    string
+		version string
+		res     manifest.Resource
+		status  string
+	}{
+		{name: "before deprecation", version: "1.20", res: pdb},
+		{name: "deprecated", version: "1.21.5", res: pdb, status: StatusDeprecated},
+		{name: "removed", version: "v1.25.0", res: pdb, status: StatusRemoved},
+		{name: "removed long ago", version: "1.29", res: ingress, status: StatusRemoved},
+		{name: "latest", version: Latest, res: pdb, status: StatusRemoved},
+		{name: "current api", version: Latest, res: current},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, err := NewChecker(tt.version)
+			require.NoError(t, err)
+
+			finding, found := checker.Check(tt.res)
+			require.Equal(t, tt.status != "", found)
+			require.Equal(t, tt.status, finding.Status)
+		})
+	}
+}
+
+func TestNewChecker_InvalidVersion(t *testing.T) {
+	_, err := NewChecker("latest")
+	require.ErrorContains(t, err, "invalid Kubernetes version")
+}
@@ -0,0 +1,319 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+const (
+	// TransportSSH - клонирование по SSH (git@host:path)
+	TransportSSH = "ssh"
+	// TransportHTTPS - клонирование по HTTPS с токеном или логином/паролем
+	TransportHTTPS = "https"
+
+	// DefaultUsernameEnv и DefaultTokenEnv - переменные окружения с учетными данными HTTPS,
+	// которые используются, если для хоста они не заданы явно
+	DefaultUsernameEnv = "ROAR_GIT_USERNAME"
+	DefaultTokenEnv    = "ROAR_GIT_TOKEN"
+	// DefaultTokenHostsEnv - переменная окружения со списком хостов через запятую,
+	// которым кроме TokenHosts и Hosts можно отправлять DefaultTokenEnv
+	DefaultTokenHostsEnv = "ROAR_GIT_TOKEN_HOSTS"
+
+	defaultHTTPSUsername = "git"
+)
+
+// Credentials описывает выбор транспорта и учетных данных для git-хостов
+type Credentials struct {
+	// Transport - транспорт по умолчанию для всех хостов (ssh или https)
+	Transport string `yaml:"transport"`
+	// NetrcFile - путь к netrc-файлу с логинами и паролями для HTTPS
+	NetrcFile string `yaml:"netrcFile"`
+	// TokenHosts - хосты, которым отправляется токен из DefaultTokenEnv. Кроме них
+	// токен получают только хосты из Hosts, остальные клонируются без него.
+	TokenHosts []string `yaml:"tokenHosts"`
+	// Hosts - настройки для отдельных хостов, ключ - имя хоста
+	Hosts map[string]HostCredentials `yaml:"hosts"`
+}
+
+// HostCredentials - настройки транспорта и аутентификации для одного хоста
+type HostCredentials struct {
+	Transport string `yaml:"transport"`
+
+	// HTTPS
+	Username    string `yaml:"username"`
+	UsernameEnv string `yaml:"usernameEnv"`
+	TokenEnv    string `yaml:"tokenEnv"`
+
+	// SSH
+	SSHUser             string `yaml:"sshUser"`
+	SSHKeyFile          string `yaml:"sshKeyFile"`
+	SSHKeyPassphraseEnv string `yaml:"sshKeyPassphraseEnv"`
+	KnownHostsFile      string `yaml:"knownHostsFile"`
+}
+
+// TransportFor возвращает транспорт для хоста. По умолчанию используется SSH.
+func (c *Credentials) TransportFor(host string) string {
+	if c == nil {
+		return TransportSSH
+	}
+	if h, ok := c.Hosts[host]; ok && h.Transport != "" {
+		return h.Transport
+	}
+	if c.Transport != "" {
+		return c.Transport
+	}
+	return TransportSSH
+}
+
+// Validate проверяет значения транспорта
+func (c *Credentials) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if err := validateTransport(c.Transport); err != nil {
+		return err
+	}
+	for host, h := range c.Hosts {
+		if err := validateTransport(h.Transport); err != nil {
+			return fmt.Errorf("host %s: %w", host, err)
+		}
+	}
+	return nil
+}
+
+func validateTransport(t string) error {
+	switch t {
+	case "", TransportSSH, TransportHTTPS:
+		return nil
+	default:
+		return fmt.Errorf("unsupported git transport '%s' (supported: %s, %s)", t, TransportSSH, TransportHTTPS)
+	}
+}
+
+// Auth подбирает метод аутентификации для URL, уже приведенного к нужному транспорту.
+// nil означает поведение go-git по умолчанию (ssh-agent для SSH, анонимный доступ для HTTPS).
+func (c *Credentials) Auth(repoURL string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse URL %s: %w", repoURL, err)
+	}
+
+	var host HostCredentials
+	if c != nil {
+		host = c.Hosts[endpoint.Host]
+	}
+
+	switch endpoint.Protocol {
+	case "ssh":
+		return sshAuth(endpoint.User, host)
+	case "http":
+		// Учетные данные по http ушли бы открытым текстом
+		if host.TokenEnv != "" || host.Username != "" || host.UsernameEnv != "" {
+			return nil, fmt.Errorf("refusing to send credentials for %s over plain http, use https", endpoint.Host)
+		}
+		return nil, nil
+	case "https":
+		return c.httpsAuth(endpoint.Host, host)
+	default:
+		return nil, nil
+	}
+}
+
+func sshAuth(endpointUser string, host HostCredentials) (transport.AuthMethod, error) {
+	if host.SSHKeyFile == "" && host.KnownHostsFile == "" {
+		return nil, nil
+	}
+
+	user := host.SSHUser
+	if user == "" {
+		user = endpointUser
+	}
+	if user == "" {
+		user = ssh.DefaultUsername
+	}
+
+	var auth transport.AuthMethod
+	var helper *ssh.HostKeyCallbackHelper
+	if host.SSHKeyFile != "" {
+		publicKeys, err := ssh.NewPublicKeysFromFile(user, expandHome(host.SSHKeyFile), os.Getenv(host.SSHKeyPassphraseEnv))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SSH key %s: %w", host.SSHKeyFile, err)
+		}
+		auth, helper = publicKeys, &publicKeys.HostKeyCallbackHelper
+	} else {
+		agentAuth, err := ssh.NewSSHAgentAuth(user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+		}
+		auth, helper = agentAuth, &agentAuth.HostKeyCallbackHelper
+	}
+
+	if host.KnownHostsFile != "" {
+		callback, err := ssh.NewKnownHostsCallback(expandHome(host.KnownHostsFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts %s: %w", host.KnownHostsFile, err)
+		}
+		helper.HostKeyCallback = callback
+	}
+	return auth, nil
+}
+
+func (c *Credentials) httpsAuth(hostname string, host HostCredentials) (transport.AuthMethod, error) {
+	username := host.Username
+	if host.UsernameEnv != "" {
+		username = os.Getenv(host.UsernameEnv)
+	}
+
+	var token string
+	if host.TokenEnv != "" {
+		token = os.Getenv(host.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("environment variable %s with the token for %s is empty", host.TokenEnv, hostname)
+		}
+	} else if token = os.Getenv(DefaultTokenEnv); token != "" && c.tokenAllowed(hostname) {
+		if username == "" {
+			username = os.Getenv(DefaultUsernameEnv)
+		}
+	} else {
+		login, password, found, err := c.lookupNetrc(hostname)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, nil
+		}
+		if username == "" {
+			username = login
+		}
+		token = password
+	}
+
+	if username == "" {
+		username = defaultHTTPSUsername
+	}
+	return &http.BasicAuth{Username: username, Password: token}, nil
+}
+
+// tokenAllowed сообщает, можно ли отправить хосту токен из DefaultTokenEnv:
+// хост должен быть указан в Hosts, TokenHosts или DefaultTokenHostsEnv.
+func (c *Credentials) tokenAllowed(hostname string) bool {
+	for _, host := range strings.Split(os.Getenv(DefaultTokenHostsEnv), ",") {
+		if strings.EqualFold(strings.TrimSpace(host), hostname) {
+			return true
+		}
+	}
+	if c == nil {
+		return false
+	}
+	if _, ok := c.Hosts[hostname]; ok {
+		return true
+	}
+	return slices.ContainsFunc(c.TokenHosts, func(host string) bool {
+		return strings.EqualFold(host, hostname)
+	})
+}
+
+// lookupNetrc ищет учетные данные хоста в netrc-файле: явно заданном,
+// указанном в $NETRC или в ~/.netrc.
+func (c *Credentials) lookupNetrc(hostname string) (string, string, bool, error) {
+	path := ""
+	if c != nil {
+		path = c.NetrcFile
+	}
+	explicit := path != ""
+	if path == "" {
+		path = os.Getenv("NETRC")
+		explicit = path != ""
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false, nil
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	f, err := os.Open(expandHome(path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !explicit {
+			return "", "", false, nil
+		}
+		return "", "", false, fmt.Errorf("failed to read netrc file: %w", err)
+	}
+	defer f.Close()
+
+	login, password, found := parseNetrc(f, hostname)
+	return login, password, found, nil
+}
+
+// parseNetrc возвращает login и password для machine hostname, а если его нет - для default
+func parseNetrc(r io.Reader, hostname string) (string, string, bool) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	var tokens []string
+	for scanner.Scan() {
+		tokens = append(tokens, scanner.Text())
+	}
+
+	type entry struct{ login, password string }
+	var current, match, fallback *entry
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			current = &entry{}
+			if i+1 < len(tokens) && tokens[i+1] == hostname && match == nil {
+				match = current
+			}
+			i++
+		case "default":
+			current = &entry{}
+			fallback = current
+		case "login", "password":
+			if current != nil && i+1 < len(tokens) {
+				if tokens[i] == "login" {
+					current.login = tokens[i+1]
+				} else {
+					current.password = tokens[i+1]
+				}
+			}
+			i++
+		}
+	}
+
+	if match == nil {
+		match = fallback
+	}
+	if match == nil {
+		return "", "", false
+	}
+	return match.login, match.password, true
+}
+
+// HostOf возвращает имя хоста из https-, ssh- или scp-подобного URL.
+// Для локальных путей возвращается пустая строка.
+func HostOf(repoURL string) string {
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil || endpoint.Protocol == "file" {
+		return ""
+	}
+	return endpoint.Host
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
@@ -0,0 +1,183 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetrc(t *testing.T) {
+	netrc := `
+machine git.example.com
+  login alice
+  password secret1
+machine other.example.com login bob password secret2
+default login anonymous password none
+`
+	tests := []struct {
+		name         string
+		host         string
+		wantLogin    string
+		wantPassword string
+	}{
+		{name: "multiline machine", host: "git.example.com", wantLogin: "alice", wantPassword: "secret1"},
+		{name: "single line machine", host: "other.example.com", wantLogin: "bob", wantPassword: "secret2"},
+		{name: "default entry", host: "unknown.example.com", wantLogin: "anonymous", wantPassword: "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login, password, found := parseNetrc(strings.NewReader(netrc), tt.host)
+			require.True(t, found)
+			require.Equal(t, tt.wantLogin, login)
+			require.Equal(t, tt.wantPassword, password)
+		})
+	}
+
+	_, _, found := parseNetrc(strings.NewReader("machine a login b password c"), "x")
+	require.False(t, found)
+}
+
+func TestCredentials_TransportFor(t *testing.T) {
+	var nilCreds *Credentials
+	require.Equal(t, TransportSSH, nilCreds.TransportFor("git.example.com"))
+
+	creds := &Credentials{
+		Transport: TransportHTTPS,
+		Hosts: map[string]HostCredentials{
+			"github.com": {Transport: TransportSSH},
+		},
+	}
+	require.Equal(t, TransportSSH, creds.TransportFor("github.com"))
+	require.Equal(t, TransportHTTPS, creds.TransportFor("git.example.com"))
+
+	require.Error(t, (&Credentials{Transport: "ftp"}).Validate())
+	require.Error(t, (&Credentials{Hosts: map[string]HostCredentials{"h": {Transport: "ftp"}}}).Validate())
+	require.NoError(t, creds.Validate())
+}
+
+func TestCredentials_HTTPSAuth(t *testing.T) {
+	t.Setenv(DefaultTokenEnv, "")
+	t.Setenv("HOST_TOKEN", "host-token")
+
+	netrcPath := filepath.Join(t.TempDir(), "netrc")
+	require.NoError(t, os.WriteFile(netrcPath, []byte("machine netrc.example.com login carol password netrc-pass\n"), 0600))
+
+	creds := &Credentials{
+		NetrcFile: netrcPath,
+		Hosts: map[string]HostCredentials{
+			"token.example.com": {Username: "gitlab-ci-token", TokenEnv: "HOST_TOKEN"},
+			"empty.example.com": {TokenEnv: "MISSING_TOKEN"},
+		},
+	}
+
+	auth, err := creds.Auth("https://token.example.com/org/repo.git")
+	require.NoError(t, err)
+	require.Equal(t, &http.BasicAuth{Username: "gitlab-ci-token", Password: "host-token"}, auth)
+
+	auth, err = creds.Auth("https://netrc.example.com/org/repo.git")
+	require.NoError(t, err)
+	require.Equal(t, &http.BasicAuth{Username: "carol", Password: "netrc-pass"}, auth)
+
+	auth, err = creds.Auth("https://anonymous.example.com/org/repo.git")
+	require.NoError(t, err)
+	require.Nil(t, auth)
+
+	_, err = creds.Auth("https://empty.example.com/org/repo.git")
+	require.ErrorContains(t, err, "MISSING_TOKEN")
+
+	t.Setenv(DefaultTokenEnv, "global-token")
+	t.Setenv(DefaultTokenHostsEnv, "")
+	auth, err = creds.Auth("https://anonymous.example.com/org/repo.git")
+	require.NoError(t, err)
+	require.Nil(t, auth)
+}
+
+func TestCredentials_DefaultTokenHosts(t *testing.T) {
+	t.Setenv(DefaultTokenEnv, "global-token")
+	t.Setenv(DefaultUsernameEnv, "")
+	t.Setenv(DefaultTokenHostsEnv, "env.example.com, other.example.com")
+	netrcPath := filepath.Join(t.TempDir(), "netrc")
+	require.NoError(t, os.WriteFile(netrcPath, nil, 0600))
+
+	creds := &Credentials{
+		NetrcFile:  netrcPath,
+		TokenHosts: []string{"Listed.example.com"},
+		Hosts: map[string]HostCredentials{
+			"configured.example.com": {Transport: TransportHTTPS},
+		},
+	}
+	tokenAuth := &http.BasicAuth{Username: "git", Password: "global-token"}
+
+	tests := []struct {
+		url  string
+		want *http.BasicAuth
+	}{
+		{url: "https://listed.example.com/org/repo.git", want: tokenAuth},
+		{url: "https://configured.example.com/org/repo.git", want: tokenAuth},
+		{url: "https://env.example.com/org/repo.git", want: tokenAuth},
+		{url: "https://other.example.com/org/repo.git", want: tokenAuth},
+		{url: "https://submodule.example.com/org/repo.git"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			auth, err := creds.Auth(tt.url)
+			require.NoError(t, err)
+			if tt.want == nil {
+				require.Nil(t, auth)
+				return
+			}
+			require.Equal(t, tt.want, auth)
+		})
+	}
+}
+
+func TestCredentials_PlainHTTP(t *testing.T) {
+	t.Setenv(DefaultTokenEnv, "global-token")
+	t.Setenv("HOST_TOKEN", "host-token")
+
+	netrcPath := filepath.Join(t.TempDir(), "netrc")
+	require.NoError(t, os.WriteFile(netrcPath, []byte("default login carol password netrc-pass\n"), 0600))
+	creds := &Credentials{
+		NetrcFile:  netrcPath,
+		TokenHosts: []string{"git.example.com"},
+		Hosts: map[string]HostCredentials{
+			"token.example.com": {TokenEnv: "HOST_TOKEN"},
+		},
+	}
+
+	// Ни токен по умолчанию, ни netrc не отправляются открытым текстом
+	auth, err := creds.Auth("http://git.example.com/org/repo.git")
+	require.NoError(t, err)
+	require.Nil(t, auth)
+
+	_, err = creds.Auth("http://token.example.com/org/repo.git")
+	require.EqualError(t, err, "refusing to send credentials for token.example.com over plain http, use https")
+}
+
+func TestCredentials_SSHAndLocalAuth(t *testing.T) {
+	creds := &Credentials{}
+
+	// Без явного ключа и known_hosts go-git использует ssh-agent сам
+	auth, err := creds.Auth("git@git.example.com:org/repo.git")
+	require.NoError(t, err)
+	require.Nil(t, auth)
+
+	auth, err = creds.Auth(t.TempDir())
+	require.NoError(t, err)
+	require.Nil(t, auth)
+
+	creds.Hosts = map[string]HostCredentials{"git.example.com": {SSHKeyFile: filepath.Join(t.TempDir(), "missing")}}
+	_, err = creds.Auth("git@git.example.com:org/repo.git")
+	require.ErrorContains(t, err, "failed to load SSH key")
+}
+
+func TestHostOf(t *testing.T) {
+	require.Equal(t, "git.example.com", HostOf("https://git.example.com/org/repo.git"))
+	require.Equal(t, "git.example.com", HostOf("git@git.example.com:org/repo.git"))
+	require.Equal(t, "git.example.com", HostOf("ssh://git@git.example.com:2222/org/repo.git"))
+	require.Equal(t, "", HostOf("/tmp/repo"))
+}
@@ -1,30 +1,130 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"roar/internal/pkg/logger"
+	"strings"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
 )
 
-func Clone(repoURL, revision, targetPath string) error {
+// Remote - адрес репозитория и способ аутентификации для него.
+// Auth == nil означает поведение go-git по умолчанию (ssh-agent для SSH).
+type Remote struct {
+	URL  string
+	Auth transport.AuthMethod
+}
+
+// CloneOptions - дополнительные параметры клонирования
+type CloneOptions struct {
+	// Commit - если задан, рабочее дерево переключается на этот коммит ветки (locked-режим).
+	// Клон в этом случае выполняется без ограничения глубины, так как коммит может быть не на вершине.
+	Commit string
+	// SparseDirs - если заданы, в рабочее дерево извлекаются только эти директории (sparse checkout)
+	SparseDirs []string
+	// Submodules - если задан, сабмодули извлекаются рекурсивно; каждый URL сабмодуля
+	// проходит через этот резолвер
+	Submodules RemoteResolver
+}
+
+func Clone(ctx context.Context, remote Remote, revision, targetPath string, cloneOpts CloneOptions) error {
+	repoURL := remote.URL
 	logCtx := logger.Log.WithField("repo", repoURL).WithField("revision", revision)
+	if cloneOpts.Commit != "" {
+		logCtx = logCtx.WithField("commit", cloneOpts.Commit)
+	}
 	logCtx.Info("Cloning repository using go-git...")
 
 	opts := &git.CloneOptions{
 		URL:           repoURL,
+		Auth:          remote.Auth,
 		ReferenceName: plumbing.NewBranchReferenceName(revision),
 		SingleBranch:  true,
 		Depth:         1,
 		Progress:      nil,
 	}
+	if cloneOpts.Commit != "" {
+		opts.Depth = 0
+	}
+	if cloneOpts.Commit != "" || len(cloneOpts.SparseDirs) > 0 {
+		opts.NoCheckout = true
+	}
 
-	_, err := git.PlainClone(targetPath, false, opts)
+	repo, err := git.PlainCloneContext(ctx, targetPath, false, opts)
 	if err != nil {
 		return fmt.Errorf("go-git clone failed for %s (revision %s): %w", repoURL, revision, err)
 	}
 
+	if opts.NoCheckout {
+		checkoutOpts := &git.CheckoutOptions{
+			Branch:                    plumbing.NewBranchReferenceName(revision),
+			SparseCheckoutDirectories: cloneOpts.SparseDirs,
+			Force:                     true,
+		}
+		if cloneOpts.Commit != "" {
+			checkoutOpts.Branch = ""
+			checkoutOpts.Hash = plumbing.NewHash(cloneOpts.Commit)
+		}
+		if len(cloneOpts.SparseDirs) > 0 {
+			logCtx.Infof("Sparse checkout of %s", strings.Join(cloneOpts.SparseDirs, ", "))
+		}
+
+		w, err := repo.Worktree()
+		if err != nil {
+			return fmt.Errorf("failed to open worktree of %s: %w", targetPath, err)
+		}
+		if err := w.Checkout(checkoutOpts); err != nil {
+			return fmt.Errorf("failed to checkout %s (revision %s): %w", repoURL, revision, err)
+		}
+	}
+
+	if cloneOpts.Submodules != nil {
+		if err := updateSubmodules(ctx, repo, repoURL, cloneOpts.Submodules, 1); err != nil {
+			return fmt.Errorf("failed to update submodules of %s: %w", repoURL, err)
+		}
+	}
+
 	logCtx.Info("Successfully cloned repository.")
 	return nil
 }
+
+// HeadCommit возвращает SHA коммита, на который указывает HEAD склонированного репозитория.
+func HeadCommit(repoPath string) (string, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repository %s: %w", repoPath, err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD of %s: %w", repoPath, err)
+	}
+	return head.Hash().String(), nil
+}
+
+// ResolveRevision возвращает SHA коммита, на который указывает ветка revision
+// в удаленном репозитории, без клонирования (аналог git ls-remote).
+func ResolveRevision(ctx context.Context, remote Remote, revision string) (string, error) {
+	repoURL := remote.URL
+	lister := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{repoURL},
+	})
+
+	refs, err := lister.ListContext(ctx, &git.ListOptions{Auth: remote.Auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to list references of %s: %w", repoURL, err)
+	}
+
+	branch := plumbing.NewBranchReferenceName(revision)
+	for _, ref := range refs {
+		if ref.Name() == branch {
+			return ref.Hash().String(), nil
+		}
+	}
+	return "", fmt.Errorf("revision %s not found in %s", revision, repoURL)
+}
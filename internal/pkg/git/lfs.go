@@ -0,0 +1,133 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	lfsPointerPrefix  = "version https://git-lfs.github.com/spec/v1"
+	lfsPointerMaxSize = 1024
+)
+
+// LFSPointer - файл рабочего дерева, который содержит указатель Git LFS вместо данных
+type LFSPointer struct {
+	Path string
+	OID  string
+	Size int64
+}
+
+// FindLFSPointers ищет в директории файлы-указатели Git LFS (директория .git пропускается)
+func FindLFSPointers(dir string) ([]LFSPointer, error) {
+	var pointers []LFSPointer
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > lfsPointerMaxSize {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if pointer, ok := parseLFSPointer(content); ok {
+			pointer.Path = path
+			pointers = append(pointers, pointer)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s for LFS pointers: %w", dir, err)
+	}
+	return pointers, nil
+}
+
+func parseLFSPointer(content []byte) (LFSPointer, bool) {
+	if !bytes.HasPrefix(content, []byte(lfsPointerPrefix)) {
+		return LFSPointer{}, false
+	}
+
+	var pointer LFSPointer
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		switch key {
+		case "oid":
+			pointer.OID = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			pointer.Size, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return pointer, pointer.OID != ""
+}
+
+// ResolveLFSPointers заменяет указатели содержимым объектов из локального хранилища LFS.
+// Хранилище имеет ту же структуру, что и .git/lfs/objects: <oid[0:2]>/<oid[2:4]>/<oid>.
+// Если storeDir пуст или объекта нет, возвращается ошибка со списком файлов.
+func ResolveLFSPointers(pointers []LFSPointer, storeDir string) error {
+	var missing []string
+	for _, pointer := range pointers {
+		if storeDir == "" {
+			missing = append(missing, pointer.Path)
+			continue
+		}
+		if err := replaceLFSPointer(pointer, storeDir); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				missing = append(missing, fmt.Sprintf("%s (object %s)", pointer.Path, pointer.OID))
+				continue
+			}
+			return err
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+	if storeDir == "" {
+		return fmt.Errorf("files are Git LFS pointers, but LFS objects are not fetched (provide a local LFS object store): %s", strings.Join(missing, ", "))
+	}
+	return fmt.Errorf("LFS objects not found in %s for: %s", storeDir, strings.Join(missing, ", "))
+}
+
+func replaceLFSPointer(pointer LFSPointer, storeDir string) error {
+	if len(pointer.OID) < 5 {
+		return fmt.Errorf("invalid LFS oid '%s' in %s", pointer.OID, pointer.Path)
+	}
+	objectPath := filepath.Join(storeDir, pointer.OID[0:2], pointer.OID[2:4], pointer.OID)
+	content, err := os.ReadFile(objectPath)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != pointer.OID {
+		return fmt.Errorf("LFS object %s is corrupted: checksum mismatch", objectPath)
+	}
+	if pointer.Size != 0 && int64(len(content)) != pointer.Size {
+		return fmt.Errorf("LFS object %s has size %d, pointer %s expects %d", objectPath, len(content), pointer.Path, pointer.Size)
+	}
+	return os.WriteFile(pointer.Path, content, 0644)
+}
@@ -0,0 +1,69 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func lfsPointerFor(content []byte) (string, string) {
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+	return oid, fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content))
+}
+
+func TestFindAndResolveLFSPointers(t *testing.T) {
+	repoDir := t.TempDir()
+	content := []byte("binary chart asset")
+	oid, pointer := lfsPointerFor(content)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(repoDir, "files"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "files", "asset.bin"), []byte(pointer), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "values.yaml"), []byte("key: value\n"), 0644))
+
+	pointers, err := FindLFSPointers(repoDir)
+	require.NoError(t, err)
+	require.Len(t, pointers, 1)
+	require.Equal(t, oid, pointers[0].OID)
+	require.Equal(t, int64(len(content)), pointers[0].Size)
+
+	// Без хранилища объектов - понятная ошибка со списком файлов
+	err = ResolveLFSPointers(pointers, "")
+	require.ErrorContains(t, err, "Git LFS pointers")
+	require.ErrorContains(t, err, "asset.bin")
+
+	// Объекта нет в хранилище
+	storeDir := t.TempDir()
+	err = ResolveLFSPointers(pointers, storeDir)
+	require.ErrorContains(t, err, "LFS objects not found")
+
+	// Объект есть - указатель заменяется содержимым
+	objectDir := filepath.Join(storeDir, oid[0:2], oid[2:4])
+	require.NoError(t, os.MkdirAll(objectDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(objectDir, oid), content, 0644))
+	require.NoError(t, ResolveLFSPointers(pointers, storeDir))
+
+	resolved, err := os.ReadFile(filepath.Join(repoDir, "files", "asset.bin"))
+	require.NoError(t, err)
+	require.Equal(t, content, resolved)
+}
+
+func TestResolveLFSPointers_Corrupted(t *testing.T) {
+	repoDir := t.TempDir()
+	oid, pointer := lfsPointerFor([]byte("expected"))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "asset.bin"), []byte(pointer), 0644))
+
+	storeDir := t.TempDir()
+	objectDir := filepath.Join(storeDir, oid[0:2], oid[2:4])
+	require.NoError(t, os.MkdirAll(objectDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(objectDir, oid), []byte("something else"), 0644))
+
+	pointers, err := FindLFSPointers(repoDir)
+	require.NoError(t, err)
+	require.ErrorContains(t, ResolveLFSPointers(pointers, storeDir), "checksum mismatch")
+}
@@ -0,0 +1,142 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"roar/internal/pkg/logger"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// RetryPolicy - таймаут одной попытки и повторы для сетевых операций с git
+type RetryPolicy struct {
+	// Attempts - общее число попыток (0 и 1 означают без повторов)
+	Attempts int
+	// Timeout - ограничение времени одной попытки (0 - без ограничения)
+	Timeout time.Duration
+	// InitialBackoff - пауза перед второй попыткой, далее она удваивается
+	InitialBackoff time.Duration
+}
+
+const maxBackoff = time.Minute
+
+// Retry выполняет op, повторяя ее с экспоненциальной паузой, пока ошибка временная.
+// Отмена родительского контекста прерывает и текущую попытку, и ожидание.
+func Retry(ctx context.Context, policy RetryPolicy, description string, op func(ctx context.Context) error) error {
+	attempts := policy.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := policy.InitialBackoff
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = runAttempt(ctx, policy.Timeout, op)
+		if err == nil || ctx.Err() != nil || !IsTransient(err) || attempt == attempts {
+			break
+		}
+
+		logger.Log.WithField("attempt", attempt).Warnf("%s failed with a transient error, retrying in %s: %v", description, backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%s interrupted: %w", description, ctx.Err())
+	}
+	return err
+}
+
+func runAttempt(ctx context.Context, timeout time.Duration, op func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return op(ctx)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := op(attemptCtx)
+	if err != nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("timed out after %s: %w", timeout, context.DeadlineExceeded)
+	}
+	return err
+}
+
+// permanentErrors - ошибки, повтор которых не имеет смысла
+var permanentErrors = []error{
+	transport.ErrAuthenticationRequired,
+	transport.ErrAuthorizationFailed,
+	transport.ErrRepositoryNotFound,
+	transport.ErrEmptyRemoteRepository,
+	transport.ErrInvalidAuthMethod,
+	plumbing.ErrReferenceNotFound,
+	plumbing.ErrObjectNotFound,
+	git.ErrBranchNotFound,
+	git.ErrRepositoryAlreadyExists,
+}
+
+// permanentMessages - признаки ошибок аутентификации и проверки ключа хоста
+// SSH в тексте ошибок; они проверяются раньше transientMessages, так как
+// приходят как "ssh: handshake failed: ..."
+var permanentMessages = []string{
+	"unable to authenticate",
+	"knownhosts:",
+	"host key mismatch",
+}
+
+// transientMessages - признаки сетевых сбоев в тексте ошибок, которые go-git не оборачивает
+var transientMessages = []string{
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"temporary failure",
+	"no route to host",
+	"unexpected eof",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+}
+
+// IsTransient сообщает, похожа ли ошибка на временный сетевой сбой
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, permanent := range permanentErrors {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, permanent := range permanentMessages {
+		if strings.Contains(msg, permanent) {
+			return false
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	for _, transient := range transientMessages {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
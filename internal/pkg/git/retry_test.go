@@ -0,0 +1,88 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "auth required", err: fmt.Errorf("clone: %w", transport.ErrAuthenticationRequired), want: false},
+		{name: "repository not found", err: fmt.Errorf("clone: %w", transport.ErrRepositoryNotFound), want: false},
+		{name: "attempt timeout", err: fmt.Errorf("timed out: %w", context.DeadlineExceeded), want: true},
+		{name: "connection reset", err: errors.New("read tcp 10.0.0.1:22: connection reset by peer"), want: true},
+		{name: "bad gateway", err: errors.New("unexpected client error: 502 Bad Gateway"), want: true},
+		{name: "other error", err: errors.New("invalid pkt-len found"), want: false},
+		{name: "ssh auth failure", err: errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey], no supported methods remain"), want: false},
+		{name: "known hosts mismatch", err: errors.New("ssh: handshake failed: knownhosts: key mismatch"), want: false},
+		{name: "unknown host key", err: errors.New("ssh: handshake failed: knownhosts: key is unknown"), want: false},
+		{name: "tls handshake timeout", err: errors.New("net/http: TLS handshake timeout"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, IsTransient(tt.err))
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond}
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		calls := 0
+		err := Retry(context.Background(), policy, "clone", func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return errors.New("connection reset by peer")
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("stops on permanent error", func(t *testing.T) {
+		calls := 0
+		err := Retry(context.Background(), policy, "clone", func(ctx context.Context) error {
+			calls++
+			return transport.ErrAuthenticationRequired
+		})
+		require.ErrorIs(t, err, transport.ErrAuthenticationRequired)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("retries attempt timeout", func(t *testing.T) {
+		calls := 0
+		timed := RetryPolicy{Attempts: 2, Timeout: 10 * time.Millisecond, InitialBackoff: time.Millisecond}
+		err := Retry(context.Background(), timed, "clone", func(ctx context.Context) error {
+			calls++
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("stops when parent context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := Retry(ctx, policy, "clone", func(ctx context.Context) error {
+			calls++
+			cancel()
+			return errors.New("connection reset by peer")
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,89 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"roar/internal/pkg/logger"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// maxSubmoduleDepth ограничивает глубину рекурсии вложенных сабмодулей, как в go-git
+const maxSubmoduleDepth = int(git.DefaultSubmoduleRecursionDepth)
+
+// RemoteResolver приводит URL сабмодуля к нужному транспорту и подбирает для него аутентификацию
+type RemoteResolver func(repoURL string) (Remote, error)
+
+// updateSubmodules инициализирует и извлекает сабмодули репозитория рекурсивно.
+// Относительные URL разрешаются от URL родительского репозитория, после чего к ним
+// применяются те же правила транспорта и аутентификации, что и к основному репозиторию.
+func updateSubmodules(ctx context.Context, repo *git.Repository, parentURL string, resolve RemoteResolver, depth int) error {
+	if depth > maxSubmoduleDepth {
+		return fmt.Errorf("submodule recursion depth exceeds %d", maxSubmoduleDepth)
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	submodules, err := w.Submodules()
+	if err != nil {
+		return fmt.Errorf("failed to read submodules: %w", err)
+	}
+
+	for _, sub := range submodules {
+		subCfg := sub.Config()
+		remote, err := resolve(ResolveSubmoduleURL(parentURL, subCfg.URL))
+		if err != nil {
+			return fmt.Errorf("submodule %s: %w", subCfg.Name, err)
+		}
+		subCfg.URL = remote.URL
+
+		logCtx := logger.Log.WithField("repo", remote.URL).WithField("submodule", subCfg.Path)
+		logCtx.Info("Updating submodule...")
+		err = sub.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+			Init:              true,
+			Auth:              remote.Auth,
+			RecurseSubmodules: git.NoRecurseSubmodules,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update submodule %s from %s: %w", subCfg.Path, remote.URL, err)
+		}
+
+		subRepo, err := sub.Repository()
+		if err != nil {
+			return fmt.Errorf("failed to open submodule %s: %w", subCfg.Path, err)
+		}
+		if err := updateSubmodules(ctx, subRepo, remote.URL, resolve, depth+1); err != nil {
+			return fmt.Errorf("submodule %s: %w", subCfg.Path, err)
+		}
+	}
+	return nil
+}
+
+// ResolveSubmoduleURL разрешает относительный URL сабмодуля ("../lib.git", "./lib")
+// от URL родительского репозитория так же, как это делает git. Абсолютные URL возвращаются как есть.
+func ResolveSubmoduleURL(parentURL, submoduleURL string) string {
+	if !strings.HasPrefix(submoduleURL, "./") && !strings.HasPrefix(submoduleURL, "../") {
+		return submoduleURL
+	}
+
+	// URL со схемой: https://host/org/repo.git
+	if u, err := url.Parse(parentURL); err == nil && u.Scheme != "" && u.Host != "" {
+		u.Path = path.Join(u.Path, submoduleURL)
+		return u.String()
+	}
+
+	// scp-подобный URL: git@host:org/repo.git
+	if host, repoPath, found := strings.Cut(parentURL, ":"); found && !strings.Contains(host, "/") && len(host) > 1 {
+		return host + ":" + strings.TrimPrefix(path.Join(repoPath, submoduleURL), "/")
+	}
+
+	// Локальный путь
+	return filepath.Join(parentURL, submoduleURL)
+}
@@ -0,0 +1,28 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSubmoduleURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		parentURL string
+		subURL    string
+		want      string
+	}{
+		{name: "absolute url", parentURL: "https://git.example.com/org/repo.git", subURL: "https://other.example.com/lib.git", want: "https://other.example.com/lib.git"},
+		{name: "https sibling", parentURL: "https://git.example.com/org/repo.git", subURL: "../lib.git", want: "https://git.example.com/org/lib.git"},
+		{name: "https nested", parentURL: "https://git.example.com/org/repo.git", subURL: "./lib", want: "https://git.example.com/org/repo.git/lib"},
+		{name: "scp-like sibling", parentURL: "git@git.example.com:org/repo.git", subURL: "../../shared/lib.git", want: "git@git.example.com:shared/lib.git"},
+		{name: "local path", parentURL: "/srv/git/repo", subURL: "../lib", want: filepath.Join("/srv/git", "lib")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, ResolveSubmoduleURL(tt.parentURL, tt.subURL))
+		})
+	}
+}
@@ -3,33 +3,65 @@ package helm
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"roar/internal/pkg/logger"
+	"sort"
 	"strings"
 )
 
 type RenderOptions struct {
-	ReleaseName string
-	ChartPath   string
-	ValuesFiles []string
-	SetValues   map[string]string
+	ReleaseName string            `json:"releaseName,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
+	ChartPath   string            `json:"chartPath"`
+	ValuesFiles []string          `json:"valuesFiles"`
+	SetValues   map[string]string `json:"setValues"`
 }
 
-func Template(opts RenderOptions) ([]byte, error) {
+// Args returns the arguments of 'helm template' for opts. --set values are
+// sorted by key so the command is the same from run to run.
+func Args(opts RenderOptions) []string {
 	args := []string{"template"}
 	if opts.ReleaseName != "" {
 		args = append(args, opts.ReleaseName)
 	}
 	args = append(args, opts.ChartPath)
+	if opts.Namespace != "" {
+		args = append(args, "--namespace", opts.Namespace)
+	}
 	for _, valuesFile := range opts.ValuesFiles {
 		args = append(args, "--values", valuesFile)
 	}
-	for key, value := range opts.SetValues {
-		setValue := strings.Join([]string{key, value}, "=")
+	keys := make([]string, 0, len(opts.SetValues))
+	for key := range opts.SetValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		setValue := strings.Join([]string{key, opts.SetValues[key]}, "=")
 		args = append(args, "--set", setValue)
 	}
-	cmd := exec.Command("helm", args...)
+	return args
+}
+
+// Version returns the output of 'helm version --short', e.g. "v3.14.0+g3fc9f4b".
+func Version(ctx context.Context) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "helm", "version", "--short")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("helm version failed: %w\nStderr:\n%s", err, stderr.String())
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Template runs 'helm template'. The process is killed when ctx is canceled or its deadline expires.
+func Template(ctx context.Context, opts RenderOptions) ([]byte, error) {
+	args := Args(opts)
+	cmd := exec.CommandContext(ctx, "helm", args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -38,6 +70,12 @@ func Template(opts RenderOptions) ([]byte, error) {
 	if stderr.Len() > 0 {
 		logger.Log.Warn(strings.TrimSpace(stderr.String()))
 	}
+	if err != nil && ctx.Err() != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("helm template timed out: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("helm template interrupted: %w", ctx.Err())
+	}
 	if err != nil {
 		return nil, fmt.Errorf("helm template failed: %w\nStderr:\n%s", err, stderr.String())
 	}
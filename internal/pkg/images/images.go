@@ -0,0 +1,162 @@
+package images
+
+import (
+	"strings"
+
+	"roar/internal/pkg/manifest"
+)
+
+// Типы контейнеров в pod spec
+const (
+	ContainerRegular   = "container"
+	ContainerInit      = "initContainer"
+	ContainerEphemeral = "ephemeralContainer"
+)
+
+// Usage - контейнер ресурса, в котором используется образ
+type Usage struct {
+	Resource  string `json:"resource"`
+	Container string `json:"container"`
+	Type      string `json:"type"`
+}
+
+// Reference - разобранная ссылка на образ
+type Reference struct {
+	// Image - ссылка как есть, например registry.example.com/team/app:1.2@sha256:...
+	Image      string `json:"image"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// Pinned сообщает, закреплен ли образ по digest
+func (r Reference) Pinned() bool {
+	return r.Digest != ""
+}
+
+// ParseReference разбирает ссылку на образ на репозиторий, тег и digest.
+// Тег по умолчанию (latest) не подставляется.
+func ParseReference(image string) Reference {
+	ref := Reference{Image: image, Repository: image}
+	if name, digest, found := strings.Cut(ref.Repository, "@"); found {
+		ref.Repository, ref.Digest = name, digest
+	}
+	// Двоеточие после последнего "/" отделяет тег, а не порт реестра
+	lastSlash := strings.LastIndex(ref.Repository, "/")
+	if colon := strings.LastIndex(ref.Repository, ":"); colon > lastSlash {
+		ref.Repository, ref.Tag = ref.Repository[:colon], ref.Repository[colon+1:]
+	}
+	return ref
+}
+
+// Found - образ, найденный в ресурсе
+type Found struct {
+	Reference
+	Usage
+}
+
+// podSpecPaths - где лежат pod spec у встроенных ресурсов и распространенных CRD
+var podSpecPaths = map[string][][]string{
+	"Pod":                   {{"spec"}},
+	"Deployment":            {{"spec", "template", "spec"}},
+	"StatefulSet":           {{"spec", "template", "spec"}},
+	"DaemonSet":             {{"spec", "template", "spec"}},
+	"ReplicaSet":            {{"spec", "template", "spec"}},
+	"ReplicationController": {{"spec", "template", "spec"}},
+	"Job":                   {{"spec", "template", "spec"}},
+	"CronJob":               {{"spec", "jobTemplate", "spec", "template", "spec"}},
+	// Argo Rollouts, OpenKruise CloneSet/Advanced StatefulSet/Advanced DaemonSet, Knative Service
+	"Rollout":     {{"spec", "template", "spec"}},
+	"CloneSet":    {{"spec", "template", "spec"}},
+	"Service":     {{"spec", "template", "spec"}},
+	"PodTemplate": {{"template", "spec"}},
+	// KEDA
+	"ScaledJob": {{"spec", "jobTargetRef", "template", "spec"}},
+}
+
+// workflowKinds - ресурсы Argo Workflows, у которых контейнеры описаны в шаблонах
+var workflowKinds = map[string][]string{
+	"Workflow":                {"spec"},
+	"WorkflowTemplate":        {"spec"},
+	"ClusterWorkflowTemplate": {"spec"},
+	"CronWorkflow":            {"spec", "workflowSpec"},
+}
+
+// Extract возвращает образы всех контейнеров, init- и ephemeral-контейнеров ресурса
+func Extract(res manifest.Resource) []Found {
+	var found []Found
+	for _, path := range podSpecPaths[res.Kind] {
+		spec, ok := dig(res.Object, path).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		found = append(found, fromPodSpec(res.ID(), spec)...)
+	}
+
+	if path, ok := workflowKinds[res.Kind]; ok && res.Group() == "argoproj.io" {
+		spec, _ := dig(res.Object, path).(map[string]interface{})
+		templates, _ := spec["templates"].([]interface{})
+		for _, item := range templates {
+			tmpl, _ := item.(map[string]interface{})
+			for _, key := range []string{"container", "script"} {
+				if c, ok := tmpl[key].(map[string]interface{}); ok {
+					found = append(found, fromContainer(res.ID(), c, ContainerRegular, stringField(tmpl, "name"))...)
+				}
+			}
+			found = append(found, fromList(res.ID(), tmpl["initContainers"], ContainerInit)...)
+			found = append(found, fromList(res.ID(), tmpl["sidecars"], ContainerRegular)...)
+		}
+	}
+	return found
+}
+
+func fromPodSpec(resource string, spec map[string]interface{}) []Found {
+	var found []Found
+	found = append(found, fromList(resource, spec["initContainers"], ContainerInit)...)
+	found = append(found, fromList(resource, spec["containers"], ContainerRegular)...)
+	found = append(found, fromList(resource, spec["ephemeralContainers"], ContainerEphemeral)...)
+	return found
+}
+
+func fromList(resource string, list interface{}, containerType string) []Found {
+	items, _ := list.([]interface{})
+	var found []Found
+	for _, item := range items {
+		if c, ok := item.(map[string]interface{}); ok {
+			found = append(found, fromContainer(resource, c, containerType, "")...)
+		}
+	}
+	return found
+}
+
+func fromContainer(resource string, c map[string]interface{}, containerType, fallbackName string) []Found {
+	image := stringField(c, "image")
+	if image == "" {
+		return nil
+	}
+	name := stringField(c, "name")
+	if name == "" {
+		name = fallbackName
+	}
+	return []Found{{
+		Reference: ParseReference(image),
+		Usage:     Usage{Resource: resource, Container: name, Type: containerType},
+	}}
+}
+
+func dig(object map[string]interface{}, path []string) interface{} {
+	var current interface{} = object
+	for _, key := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+func stringField(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
@@ -0,0 +1,66 @@
+package images
+
+import (
+	"testing"
+
+	"roar/internal/pkg/manifest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  Reference
+	}{
+		{image: "nginx", want: Reference{Image: "nginx", Repository: "nginx"}},
+		{image: "nginx:1.25", want: Reference{Image: "nginx:1.25", Repository: "nginx", Tag: "1.25"}},
+		{image: "registry.example.com:5000/team/app", want: Reference{Image: "registry.example.com:5000/team/app", Repository: "registry.example.com:5000/team/app"}},
+		{image: "registry.example.com:5000/team/app:v2", want: Reference{Image: "registry.example.com:5000/team/app:v2", Repository: "registry.example.com:5000/team/app", Tag: "v2"}},
+		{image: "app@sha256:abc", want: Reference{Image: "app@sha256:abc", Repository: "app", Digest: "sha256:abc"}},
+		{image: "app:v1@sha256:abc", want: Reference{Image: "app:v1@sha256:abc", Repository: "app", Tag: "v1", Digest: "sha256:abc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			require.Equal(t, tt.want, ParseReference(tt.image))
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	resources, err := manifest.Parse([]byte(`apiVersion: batch/v1
+kind: CronJob
+metadata: {name: backup}
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers: [{name: init, image: "busybox:1.36"}]
+          containers: [{name: backup, image: "backup@sha256:abc"}]
+---
+apiVersion: argoproj.io/v1alpha1
+kind: WorkflowTemplate
+metadata: {name: build}
+spec:
+  templates:
+    - name: compile
+      container: {image: golang:1.22}
+---
+apiVersion: v1
+kind: Service
+metadata: {name: web}
+spec:
+  ports: [{port: 80}]
+`))
+	require.NoError(t, err)
+
+	require.Equal(t, []Found{
+		{Reference: ParseReference("busybox:1.36"), Usage: Usage{Resource: "CronJob/backup", Container: "init", Type: ContainerInit}},
+		{Reference: ParseReference("backup@sha256:abc"), Usage: Usage{Resource: "CronJob/backup", Container: "backup", Type: ContainerRegular}},
+	}, Extract(resources[0]))
+	require.Equal(t, []Found{
+		{Reference: ParseReference("golang:1.22"), Usage: Usage{Resource: "WorkflowTemplate/build", Container: "compile", Type: ContainerRegular}},
+	}, Extract(resources[1]))
+	require.Empty(t, Extract(resources[2]))
+}
@@ -0,0 +1,110 @@
+package lock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultFileName - имя lock-файла по умолчанию
+	DefaultFileName = "roar.lock"
+
+	currentVersion = 1
+	header         = "# This file is generated by roar. Do not edit it manually.\n# Run 'roar lock update' to refresh resolved commits.\n"
+)
+
+// Entry фиксирует коммит, в который разрешилась ревизия репозитория
+type Entry struct {
+	Repository string `yaml:"repository"`
+	Revision   string `yaml:"revision"`
+	Commit     string `yaml:"commit"`
+}
+
+// File - содержимое roar.lock
+type File struct {
+	Version      int     `yaml:"version"`
+	Repositories []Entry `yaml:"repositories"`
+}
+
+// New создает пустой lock-файл
+func New() *File {
+	return &File{Version: currentVersion}
+}
+
+// Load читает lock-файл. Если файла нет, возвращается ошибка, проверяемая через os.ErrNotExist.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file %s: %w", path, err)
+	}
+
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse lock file %s: %w", path, err)
+	}
+	if f.Version != currentVersion {
+		return nil, fmt.Errorf("unsupported lock file version %d in %s (expected %d)", f.Version, path, currentVersion)
+	}
+	return &f, nil
+}
+
+// LoadOrNew читает lock-файл или возвращает пустой, если файла еще нет
+func LoadOrNew(path string) (*File, error) {
+	f, err := Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return New(), nil
+	}
+	return f, err
+}
+
+// Get возвращает зафиксированный коммит для пары репозиторий/ревизия
+func (f *File) Get(repository, revision string) (string, bool) {
+	for _, e := range f.Repositories {
+		if e.Repository == repository && e.Revision == revision {
+			return e.Commit, true
+		}
+	}
+	return "", false
+}
+
+// Set добавляет или обновляет запись для пары репозиторий/ревизия
+func (f *File) Set(repository, revision, commit string) {
+	for i, e := range f.Repositories {
+		if e.Repository == repository && e.Revision == revision {
+			f.Repositories[i].Commit = commit
+			return
+		}
+	}
+	f.Repositories = append(f.Repositories, Entry{Repository: repository, Revision: revision, Commit: commit})
+}
+
+// Save записывает lock-файл с записями, отсортированными для стабильного diff
+func (f *File) Save(path string) error {
+	sort.Slice(f.Repositories, func(i, j int) bool {
+		if f.Repositories[i].Repository != f.Repositories[j].Repository {
+			return f.Repositories[i].Repository < f.Repositories[j].Repository
+		}
+		return f.Repositories[i].Revision < f.Repositories[j].Revision
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(f); err != nil {
+		return fmt.Errorf("failed to encode lock file: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to encode lock file: %w", err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write lock file %s: %w", path, err)
+	}
+	return nil
+}
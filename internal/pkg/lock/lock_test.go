@@ -0,0 +1,60 @@
+package lock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile_SetGet(t *testing.T) {
+	f := New()
+	f.Set("https://git.example.com/a.git", "master", "aaa")
+	f.Set("https://git.example.com/a.git", "dev", "bbb")
+	f.Set("https://git.example.com/a.git", "master", "ccc")
+
+	commit, ok := f.Get("https://git.example.com/a.git", "master")
+	require.True(t, ok)
+	require.Equal(t, "ccc", commit)
+
+	_, ok = f.Get("https://git.example.com/b.git", "master")
+	require.False(t, ok)
+	require.Len(t, f.Repositories, 2)
+}
+
+func TestFile_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+
+	f := New()
+	f.Set("https://git.example.com/b.git", "master", "222")
+	f.Set("https://git.example.com/a.git", "master", "111")
+	require.NoError(t, f.Save(path))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(content), "# This file is generated by roar")
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, []Entry{
+		{Repository: "https://git.example.com/a.git", Revision: "master", Commit: "111"},
+		{Repository: "https://git.example.com/b.git", Revision: "master", Commit: "222"},
+	}, loaded.Repositories)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Load(filepath.Join(dir, "missing.lock"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	f, err := LoadOrNew(filepath.Join(dir, "missing.lock"))
+	require.NoError(t, err)
+	require.Empty(t, f.Repositories)
+
+	badVersion := filepath.Join(dir, "bad.lock")
+	require.NoError(t, os.WriteFile(badVersion, []byte("version: 42\n"), 0644))
+	_, err = Load(badVersion)
+	require.ErrorContains(t, err, "unsupported lock file version")
+}
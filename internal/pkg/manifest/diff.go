@@ -0,0 +1,59 @@
+package manifest
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Changes - различия двух манифестов по ресурсам, идентификаторы в формате Resource.ID
+type Changes struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty сообщает, что манифесты совпадают с точностью до порядка ресурсов и форматирования
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// Diff сравнивает ресурсы двух манифестов. Ресурсы сопоставляются по ID, а
+// сравнивается их содержимое, поэтому порядок документов, комментарии и
+// форматирование не считаются изменениями.
+func Diff(before, after []byte) (Changes, error) {
+	oldResources, err := Parse(before)
+	if err != nil {
+		return Changes{}, err
+	}
+	newResources, err := Parse(after)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	old := make(map[string]Resource, len(oldResources))
+	for _, res := range oldResources {
+		old[res.ID()] = res
+	}
+	var changes Changes
+	seen := make(map[string]bool, len(newResources))
+	for _, res := range newResources {
+		id := res.ID()
+		seen[id] = true
+		prev, ok := old[id]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, id)
+		case !reflect.DeepEqual(prev.Object, res.Object):
+			changes.Changed = append(changes.Changed, id)
+		}
+	}
+	for id := range old {
+		if !seen[id] {
+			changes.Removed = append(changes.Removed, id)
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Changed)
+	return changes, nil
+}
@@ -0,0 +1,106 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sourcePrefix - комментарий, которым helm template помечает шаблон каждого документа
+const sourcePrefix = "# Source: "
+
+// Resource - один Kubernetes-ресурс из отрендеренного манифеста
+type Resource struct {
+	APIVersion string
+	Kind       string
+	Name       string
+	Namespace  string
+	// Source - путь к шаблону из комментария "# Source:", если он есть
+	Source string
+	// Index - порядковый номер непустого документа в манифесте, начиная с 0
+	Index int
+	// Object - содержимое документа
+	Object map[string]interface{}
+}
+
+// Group возвращает API-группу ресурса (пустая строка для core)
+func (r Resource) Group() string {
+	group, _, found := strings.Cut(r.APIVersion, "/")
+	if !found {
+		return ""
+	}
+	return group
+}
+
+// Version возвращает версию API ресурса
+func (r Resource) Version() string {
+	_, version, found := strings.Cut(r.APIVersion, "/")
+	if !found {
+		return r.APIVersion
+	}
+	return version
+}
+
+// ID - человекочитаемый идентификатор ресурса: Kind/namespace/name или Kind/name
+func (r Resource) ID() string {
+	if r.Namespace != "" {
+		return fmt.Sprintf("%s/%s/%s", r.Kind, r.Namespace, r.Name)
+	}
+	return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+}
+
+// Parse разбирает многодокументный YAML (вывод helm template) на ресурсы.
+// Пустые документы и документы из одних комментариев пропускаются.
+func Parse(data []byte) ([]Resource, error) {
+	var resources []Resource
+	for i, doc := range splitDocuments(data) {
+		var object map[string]interface{}
+		if err := yaml.Unmarshal(doc, &object); err != nil {
+			return nil, fmt.Errorf("failed to decode document %d: %w", i+1, err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+
+		res := Resource{Source: findSource(doc), Index: len(resources), Object: object}
+		res.APIVersion, _ = object["apiVersion"].(string)
+		res.Kind, _ = object["kind"].(string)
+		if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+			res.Name, _ = metadata["name"].(string)
+			res.Namespace, _ = metadata["namespace"].(string)
+		}
+		resources = append(resources, res)
+	}
+	return resources, nil
+}
+
+// splitDocuments делит поток по разделителям "---"
+func splitDocuments(data []byte) [][]byte {
+	var docs [][]byte
+	var current bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "---" || strings.HasPrefix(line, "--- ") {
+			docs = append(docs, bytes.Clone(current.Bytes()))
+			current.Reset()
+			continue
+		}
+		current.WriteString(line)
+		current.WriteByte('\n')
+	}
+	return append(docs, current.Bytes())
+}
+
+func findSource(doc []byte) string {
+	for _, line := range strings.Split(string(doc), "\n") {
+		if source, ok := strings.CutPrefix(line, sourcePrefix); ok {
+			return strings.TrimSpace(source)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	data := []byte(`---
+# Source: svc/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: svc
+  namespace: prod
+---
+# Source: svc/templates/empty.yaml
+---
+# Source: svc/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc
+`)
+
+	resources, err := Parse(data)
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+
+	require.Equal(t, "Deployment/prod/svc", resources[0].ID())
+	require.Equal(t, "svc/templates/deployment.yaml", resources[0].Source)
+	require.Equal(t, "apps", resources[0].Group())
+	require.Equal(t, "v1", resources[0].Version())
+
+	require.Equal(t, "Service/svc", resources[1].ID())
+	require.Equal(t, 1, resources[1].Index)
+	require.Equal(t, "", resources[1].Group())
+	require.Equal(t, "v1", resources[1].Version())
+}
+
+func TestParse_InvalidYAML(t *testing.T) {
+	_, err := Parse([]byte("kind: [unclosed\n"))
+	require.ErrorContains(t, err, "failed to decode document 1")
+}
+
+func TestDiff(t *testing.T) {
+	before := []byte(`---
+# Source: svc/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: svc}
+spec: {replicas: 1}
+---
+kind: Service
+metadata: {name: svc}
+---
+kind: Secret
+metadata: {name: old}
+`)
+	after := []byte(`---
+kind: Service
+metadata:
+  name: svc
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: svc}
+spec: {replicas: 2}
+---
+kind: ConfigMap
+metadata: {name: svc-config}
+`)
+
+	changes, err := Diff(before, after)
+	require.NoError(t, err)
+	require.Equal(t, Changes{
+		Added:   []string{"ConfigMap/svc-config"},
+		Removed: []string{"Secret/old"},
+		Changed: []string{"Deployment/svc"},
+	}, changes)
+
+	// Одинаковые манифесты изменений не дают
+	changes, err = Diff(before, before)
+	require.NoError(t, err)
+	require.True(t, changes.Empty())
+}
@@ -0,0 +1,400 @@
+package output
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"roar/internal/pkg/manifest"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Stdout - значение цели вывода, означающее стандартный вывод
+const Stdout = "-"
+
+// Форматы манифестов
+const (
+	// FormatYAML - вывод helm template как есть
+	FormatYAML = "yaml"
+	// FormatYAMLNormalized - каждый документ перекодирован с отсортированными
+	// ключами и единообразными отступами
+	FormatYAMLNormalized = "yaml-normalized"
+	// FormatJSON - JSON-список ресурсов приложения
+	FormatJSON = "json"
+	// FormatNDJSON - по одному ресурсу в строке (newline-delimited JSON)
+	FormatNDJSON = "ndjson"
+)
+
+// FormatTar - выбор архива через --output-format: манифесты в FormatYAML,
+// записанные tar-архивом (то же, что Options.Archive)
+const FormatTar = "tar"
+
+// Formats - все поддерживаемые форматы
+var Formats = []string{FormatYAML, FormatYAMLNormalized, FormatJSON, FormatNDJSON}
+
+// Options - формат вывода
+type Options struct {
+	// Format - один из Formats; пусто - FormatYAML
+	Format string
+	// Archive - писать tar-архив с той же раскладкой, что и директория вывода
+	Archive bool
+}
+
+// Entry - отрендеренный манифест приложения
+type Entry struct {
+	// Path - относительный путь в раскладке вывода без расширения, например
+	// dev/inf1/app; расширение добавляется по формату
+	Path        string
+	Application string
+	Env         string
+	Instance    string
+	Data        []byte
+}
+
+// Writer сохраняет отрендеренные манифесты
+type Writer interface {
+	// Write сохраняет манифест и возвращает, где он оказался
+	// (путь к файлу, путь внутри архива или пустую строку для stdout)
+	Write(entry Entry) (string, error)
+	// Close дописывает и закрывает вывод
+	Close() error
+}
+
+// Loader - Writer, который может прочитать ранее записанный манифест.
+// Его реализует только вывод в директорию.
+type Loader interface {
+	// Load возвращает путь к файлу манифеста entry и его содержимое в YAML;
+	// ошибка os.ErrNotExist - манифест еще не записан
+	Load(entry Entry) (string, []byte, error)
+}
+
+// New создает Writer для цели target: директории (файла архива при
+// opts.Archive) или "-" для stdout
+func New(target string, opts Options, stdout io.Writer) (Writer, error) {
+	format := opts.Format
+	if format == "" {
+		format = FormatYAML
+	}
+	if !slices.Contains(Formats, format) {
+		return nil, fmt.Errorf("unsupported output format '%s' (supported: %s)", format, strings.Join(Formats, ", "))
+	}
+
+	if opts.Archive {
+		if target == Stdout {
+			return newTarWriter(stdout, nil, format), nil
+		}
+		if info, err := os.Stat(target); err == nil && info.IsDir() {
+			return nil, fmt.Errorf("archive path %s is a directory: pass a file path such as %s.tar", target, filepath.Clean(target))
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for archive %s: %w", target, err)
+		}
+		file, err := os.Create(target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create archive %s: %w", target, err)
+		}
+		return newTarWriter(file, file, format), nil
+	}
+	if target == Stdout {
+		return &streamWriter{out: stdout, format: format}, nil
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory %s: %w", target, err)
+	}
+	return &dirWriter{dir: target, format: format}, nil
+}
+
+// fileName - путь файла приложения с расширением формата
+func fileName(entry Entry, format string) string {
+	switch format {
+	case FormatJSON:
+		return entry.Path + ".json"
+	case FormatNDJSON:
+		return entry.Path + ".ndjson"
+	default:
+		return entry.Path + ".yaml"
+	}
+}
+
+// FormatOf определяет по расширению файла манифеста формат, в котором его
+// нужно читать через Decode. yaml-normalized читается как обычный YAML.
+func FormatOf(name string) (string, bool) {
+	switch filepath.Ext(name) {
+	case ".yaml":
+		return FormatYAML, true
+	case ".json":
+		return FormatJSON, true
+	case ".ndjson":
+		return FormatNDJSON, true
+	default:
+		return "", false
+	}
+}
+
+// Encode перекодирует вывод helm template в формат format
+func Encode(data []byte, format string) ([]byte, error) {
+	if format == "" || format == FormatYAML {
+		return data, nil
+	}
+	resources, err := manifest.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case FormatYAMLNormalized:
+		for _, res := range resources {
+			buf.WriteString("---\n")
+			if res.Source != "" {
+				fmt.Fprintf(&buf, "# Source: %s\n", res.Source)
+			}
+			encoder := yaml.NewEncoder(&buf)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(res.Object); err != nil {
+				return nil, fmt.Errorf("failed to encode %s: %w", res.ID(), err)
+			}
+			encoder.Close()
+		}
+	case FormatJSON:
+		objects := make([]map[string]interface{}, 0, len(resources))
+		for _, res := range resources {
+			objects = append(objects, res.Object)
+		}
+		encoded, err := json.MarshalIndent(objects, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode manifest as JSON: %w", err)
+		}
+		buf.Write(encoded)
+		buf.WriteString("\n")
+	case FormatNDJSON:
+		encoder := json.NewEncoder(&buf)
+		for _, res := range resources {
+			if err := encoder.Encode(res.Object); err != nil {
+				return nil, fmt.Errorf("failed to encode %s as JSON: %w", res.ID(), err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported output format '%s'", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode переводит манифест, записанный в формате format, обратно в
+// многодокументный YAML, который принимает manifest.Parse
+func Decode(data []byte, format string) ([]byte, error) {
+	var objects []map[string]interface{}
+	switch format {
+	case "", FormatYAML, FormatYAMLNormalized:
+		return data, nil
+	case FormatJSON:
+		if err := json.Unmarshal(data, &objects); err != nil {
+			return nil, fmt.Errorf("failed to decode JSON manifest: %w", err)
+		}
+	case FormatNDJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var object map[string]interface{}
+			if err := decoder.Decode(&object); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to decode NDJSON manifest: %w", err)
+			}
+			objects = append(objects, object)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported output format '%s'", format)
+	}
+
+	var buf bytes.Buffer
+	for _, object := range objects {
+		buf.WriteString("---\n")
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(object); err != nil {
+			return nil, fmt.Errorf("failed to encode manifest as YAML: %w", err)
+		}
+		encoder.Close()
+	}
+	return buf.Bytes(), nil
+}
+
+type dirWriter struct {
+	dir    string
+	format string
+}
+
+func (w *dirWriter) Write(entry Entry) (string, error) {
+	data, err := Encode(entry.Data, w.format)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest of %s: %w", entry.Application, err)
+	}
+	outputFile := filepath.Join(w.dir, filepath.FromSlash(fileName(entry, w.format)))
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return "", fmt.Errorf("failed to create output subdirectory %s: %w", filepath.Dir(outputFile), err)
+	}
+	if err := os.WriteFile(outputFile, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write manifest to %s: %w", outputFile, err)
+	}
+	return outputFile, nil
+}
+
+func (w *dirWriter) Load(entry Entry) (string, []byte, error) {
+	outputFile := filepath.Join(w.dir, filepath.FromSlash(fileName(entry, w.format)))
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err = Decode(data, w.format)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read manifest %s: %w", outputFile, err)
+	}
+	return outputFile, data, nil
+}
+
+func (w *dirWriter) Close() error {
+	return nil
+}
+
+// streamWriter пишет все манифесты одним потоком. В YAML перед манифестом
+// каждого приложения - комментарий с его именем, env и instance; в JSON -
+// по объекту на приложение в строке, с ресурсами в поле resources; в NDJSON -
+// по ресурсу в строке без разбивки по приложениям.
+type streamWriter struct {
+	out    io.Writer
+	format string
+}
+
+// streamedApplication - приложение в потоке JSON
+type streamedApplication struct {
+	Application string                   `json:"application"`
+	Env         string                   `json:"env,omitempty"`
+	Instance    string                   `json:"instance,omitempty"`
+	Path        string                   `json:"path"`
+	Resources   []map[string]interface{} `json:"resources"`
+}
+
+func (w *streamWriter) Write(entry Entry) (string, error) {
+	var b bytes.Buffer
+	switch w.format {
+	case FormatJSON:
+		resources, err := manifest.Parse(entry.Data)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode manifest of %s: %w", entry.Application, err)
+		}
+		app := streamedApplication{
+			Application: entry.Application,
+			Env:         entry.Env,
+			Instance:    entry.Instance,
+			Path:        fileName(entry, w.format),
+			Resources:   make([]map[string]interface{}, 0, len(resources)),
+		}
+		for _, res := range resources {
+			app.Resources = append(app.Resources, res.Object)
+		}
+		if err := json.NewEncoder(&b).Encode(app); err != nil {
+			return "", fmt.Errorf("failed to encode manifest of %s: %w", entry.Application, err)
+		}
+	case FormatNDJSON:
+		data, err := Encode(entry.Data, w.format)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode manifest of %s: %w", entry.Application, err)
+		}
+		b.Write(data)
+	default:
+		data, err := Encode(entry.Data, w.format)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode manifest of %s: %w", entry.Application, err)
+		}
+		b.WriteString("---\n")
+		fmt.Fprintf(&b, "# Application: %s\n", entry.Application)
+		if entry.Env != "" {
+			fmt.Fprintf(&b, "# Env: %s\n", entry.Env)
+		}
+		if entry.Instance != "" {
+			fmt.Fprintf(&b, "# Instance: %s\n", entry.Instance)
+		}
+		fmt.Fprintf(&b, "# Path: %s\n", fileName(entry, w.format))
+		b.Write(data)
+		if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+			b.WriteString("\n")
+		}
+	}
+	if _, err := w.out.Write(b.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to write manifest of %s: %w", entry.Application, err)
+	}
+	return "", nil
+}
+
+func (w *streamWriter) Close() error {
+	return nil
+}
+
+// tarWriter пишет манифесты в tar-архив, добавляя записи для директорий
+type tarWriter struct {
+	format  string
+	tw      *tar.Writer
+	closer  io.Closer
+	dirs    map[string]bool
+	modTime time.Time
+}
+
+func newTarWriter(out io.Writer, closer io.Closer, format string) *tarWriter {
+	return &tarWriter{format: format, tw: tar.NewWriter(out), closer: closer, dirs: make(map[string]bool), modTime: time.Now()}
+}
+
+func (w *tarWriter) Write(entry Entry) (string, error) {
+	data, err := Encode(entry.Data, w.format)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest of %s: %w", entry.Application, err)
+	}
+	name := path.Clean(filepath.ToSlash(fileName(entry, w.format)))
+	if err := w.addDirs(path.Dir(name)); err != nil {
+		return "", err
+	}
+	header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(data)), ModTime: w.modTime}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return "", fmt.Errorf("failed to write archive entry %s: %w", name, err)
+	}
+	if _, err := w.tw.Write(data); err != nil {
+		return "", fmt.Errorf("failed to write archive entry %s: %w", name, err)
+	}
+	return name, nil
+}
+
+func (w *tarWriter) addDirs(dir string) error {
+	if dir == "." || dir == "/" || w.dirs[dir] {
+		return nil
+	}
+	if err := w.addDirs(path.Dir(dir)); err != nil {
+		return err
+	}
+	header := &tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0755, ModTime: w.modTime}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive entry %s: %w", dir, err)
+	}
+	w.dirs[dir] = true
+	return nil
+}
+
+func (w *tarWriter) Close() error {
+	err := w.tw.Close()
+	if w.closer != nil {
+		if closeErr := w.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return nil
+}
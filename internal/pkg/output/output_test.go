@@ -0,0 +1,257 @@
+package output
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var entries = []Entry{
+	{Path: "dev/inf1/web", Application: "web", Env: "dev", Instance: "inf1", Data: []byte("---\n# Source: web/templates/cm.yaml\nkind: ConfigMap\n")},
+	{Path: "dev/api", Application: "api", Env: "dev", Data: []byte("kind: Service")},
+	{Path: "broken", Application: "broken", Data: []byte{}},
+}
+
+func writeAll(t *testing.T, w Writer) []string {
+	t.Helper()
+	var locations []string
+	for _, entry := range entries {
+		location, err := w.Write(entry)
+		require.NoError(t, err)
+		locations = append(locations, location)
+	}
+	require.NoError(t, w.Close())
+	return locations
+}
+
+func TestDirWriter(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rendered")
+	w, err := New(dir, Options{}, nil)
+	require.NoError(t, err)
+
+	locations := writeAll(t, w)
+	require.Equal(t, filepath.Join(dir, "dev", "inf1", "web.yaml"), locations[0])
+	data, err := os.ReadFile(locations[1])
+	require.NoError(t, err)
+	require.Equal(t, "kind: Service", string(data))
+	require.FileExists(t, filepath.Join(dir, "broken.yaml"))
+}
+
+func TestStreamWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := New(Stdout, Options{Format: FormatYAML}, &out)
+	require.NoError(t, err)
+
+	locations := writeAll(t, w)
+	require.Equal(t, []string{"", "", ""}, locations)
+	require.Equal(t, `---
+# Application: web
+# Env: dev
+# Instance: inf1
+# Path: dev/inf1/web.yaml
+---
+# Source: web/templates/cm.yaml
+kind: ConfigMap
+---
+# Application: api
+# Env: dev
+# Path: dev/api.yaml
+kind: Service
+---
+# Application: broken
+# Path: broken.yaml
+`, out.String())
+}
+
+func TestTarWriter(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "out", "rendered.tar")
+	w, err := New(archive, Options{Archive: true}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"dev/inf1/web.yaml", "dev/api.yaml", "broken.yaml"}, writeAll(t, w))
+
+	file, err := os.Open(archive)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var names []string
+	contents := make(map[string]string)
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		contents[header.Name] = string(data)
+	}
+	require.Equal(t, []string{"dev/", "dev/inf1/", "dev/inf1/web.yaml", "dev/api.yaml", "broken.yaml"}, names)
+	require.Equal(t, "kind: Service", contents["dev/api.yaml"])
+}
+
+func TestNew_ArchiveIsDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rendered")
+	require.NoError(t, os.Mkdir(dir, 0755))
+
+	_, err := New(dir, Options{Archive: true}, nil)
+	require.EqualError(t, err, "archive path "+dir+" is a directory: pass a file path such as "+dir+".tar")
+}
+
+func TestNew_UnsupportedFormat(t *testing.T) {
+	_, err := New(Stdout, Options{Format: "zip"}, nil)
+	require.ErrorContains(t, err, "unsupported output format 'zip'")
+}
+
+const helmOutput = `---
+# Source: web/templates/deployment.yaml
+kind: Deployment
+apiVersion: apps/v1
+metadata:
+    name: web
+    labels: {"app": web}
+spec:
+  replicas: 2
+---
+# Source: web/templates/empty.yaml
+---
+apiVersion: v1
+kind: Service
+metadata: {name: web}
+`
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: FormatYAML, want: helmOutput},
+		{
+			format: FormatYAMLNormalized,
+			want: `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    app: web
+  name: web
+spec:
+  replicas: 2
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`,
+		},
+		{
+			format: FormatJSON,
+			want: `[
+  {
+    "apiVersion": "apps/v1",
+    "kind": "Deployment",
+    "metadata": {
+      "labels": {
+        "app": "web"
+      },
+      "name": "web"
+    },
+    "spec": {
+      "replicas": 2
+    }
+  },
+  {
+    "apiVersion": "v1",
+    "kind": "Service",
+    "metadata": {
+      "name": "web"
+    }
+  }
+]
+`,
+		},
+		{
+			format: FormatNDJSON,
+			want: `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"labels":{"app":"web"},"name":"web"},"spec":{"replicas":2}}
+{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"}}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data, err := Encode([]byte(helmOutput), tt.format)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(data))
+		})
+	}
+
+	data, err := Encode(nil, FormatJSON)
+	require.NoError(t, err)
+	require.Equal(t, "[]\n", string(data))
+}
+
+func TestWriter_JSON(t *testing.T) {
+	dir := t.TempDir()
+	w, err := New(dir, Options{Format: FormatJSON}, nil)
+	require.NoError(t, err)
+	location, err := w.Write(Entry{Path: "dev/web", Application: "web", Data: []byte(helmOutput)})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "dev", "web.json"), location)
+
+	var out bytes.Buffer
+	w, err = New(Stdout, Options{Format: FormatJSON}, &out)
+	require.NoError(t, err)
+	_, err = w.Write(Entry{Path: "dev/web", Application: "web", Env: "dev", Data: []byte("kind: ConfigMap\n")})
+	require.NoError(t, err)
+	require.Equal(t, `{"application":"web","env":"dev","path":"dev/web.json","resources":[{"kind":"ConfigMap"}]}`+"\n", out.String())
+}
+
+func TestDirWriter_Load(t *testing.T) {
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			w, err := New(dir, Options{Format: format}, nil)
+			require.NoError(t, err)
+			entry := Entry{Path: "dev/web", Application: "web", Data: []byte(helmOutput)}
+
+			_, _, err = w.(Loader).Load(entry)
+			require.ErrorIs(t, err, os.ErrNotExist)
+
+			location, err := w.Write(entry)
+			require.NoError(t, err)
+			loaded, data, err := w.(Loader).Load(entry)
+			require.NoError(t, err)
+			require.Equal(t, location, loaded)
+
+			// Прочитанный манифест содержит те же ресурсы, что и исходный
+			want, err := Encode([]byte(helmOutput), FormatNDJSON)
+			require.NoError(t, err)
+			got, err := Encode(data, FormatNDJSON)
+			require.NoError(t, err)
+			require.Equal(t, string(want), string(got))
+		})
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	// Имя, записанное в каждом формате, читается в том же формате
+	for _, format := range Formats {
+		got, ok := FormatOf(fileName(Entry{Path: "dev/web"}, format))
+		require.True(t, ok)
+		want := format
+		if format == FormatYAMLNormalized {
+			want = FormatYAML
+		}
+		require.Equal(t, want, got)
+	}
+
+	_, ok := FormatOf("dev/web.txt")
+	require.False(t, ok)
+}
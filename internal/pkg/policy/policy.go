@@ -0,0 +1,306 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"roar/internal/pkg/manifest"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Уровни серьезности нарушений. Нарушения уровня error приводят к ошибке запуска.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Policy - набор правил из файла политик
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule - правило: для ресурсов, подходящих под Match, должно выполняться Assert
+type Rule struct {
+	Name        string    `yaml:"name"`
+	Description string    `yaml:"description"`
+	Severity    string    `yaml:"severity"`
+	Match       Match     `yaml:"match"`
+	Assert      Condition `yaml:"assert"`
+}
+
+// Match выбирает ресурсы, к которым применяется правило. Пустые списки подходят под все.
+type Match struct {
+	Kinds       []string `yaml:"kinds"`
+	APIVersions []string `yaml:"apiVersions"`
+}
+
+// Condition - проверка значений по пути вида "spec.template.spec.containers[*].image".
+// Все заданные операторы должны выполняться для каждого найденного значения.
+type Condition struct {
+	Path       string  `yaml:"path"`
+	Exists     *bool   `yaml:"exists"`
+	Equals     *string `yaml:"equals"`
+	NotEquals  *string `yaml:"notEquals"`
+	Matches    string  `yaml:"matches"`
+	NotMatches string  `yaml:"notMatches"`
+
+	matches    *regexp.Regexp
+	notMatches *regexp.Regexp
+}
+
+// Violation - нарушение правила ресурсом
+type Violation struct {
+	Rule     string
+	Severity string
+	// Path - конкретный путь к значению, например spec.template.spec.containers[1].image
+	Path    string
+	Message string
+}
+
+// Load читает и проверяет файлы политик, объединяя их правила
+func Load(paths ...string) (*Policy, error) {
+	combined := &Policy{}
+	names := make(map[string]string)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy file %s: %w", path, err)
+		}
+		var p Policy
+		if err := yaml.Unmarshal(data, &p); err != nil {
+			return nil, fmt.Errorf("failed to parse policy file %s: %w", path, err)
+		}
+		for i := range p.Rules {
+			rule := &p.Rules[i]
+			if err := rule.compile(); err != nil {
+				return nil, fmt.Errorf("policy file %s: %w", path, err)
+			}
+			if previous, ok := names[rule.Name]; ok {
+				return nil, fmt.Errorf("policy file %s: rule '%s' is already defined in %s", path, rule.Name, previous)
+			}
+			names[rule.Name] = path
+		}
+		combined.Rules = append(combined.Rules, p.Rules...)
+	}
+	return combined, nil
+}
+
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule without a name")
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = SeverityError
+	case SeverityError, SeverityWarning, SeverityInfo:
+	default:
+		return fmt.Errorf("rule '%s': unsupported severity '%s' (supported: %s, %s, %s)", r.Name, r.Severity, SeverityError, SeverityWarning, SeverityInfo)
+	}
+
+	c := &r.Assert
+	if c.Path == "" {
+		return fmt.Errorf("rule '%s': assert.path is required", r.Name)
+	}
+	if _, err := parsePath(c.Path); err != nil {
+		return fmt.Errorf("rule '%s': %w", r.Name, err)
+	}
+	if c.Exists == nil && c.Equals == nil && c.NotEquals == nil && c.Matches == "" && c.NotMatches == "" {
+		return fmt.Errorf("rule '%s': assert has no operator (exists, equals, notEquals, matches, notMatches)", r.Name)
+	}
+	var err error
+	if c.Matches != "" {
+		if c.matches, err = regexp.Compile(c.Matches); err != nil {
+			return fmt.Errorf("rule '%s': invalid matches: %w", r.Name, err)
+		}
+	}
+	if c.NotMatches != "" {
+		if c.notMatches, err = regexp.Compile(c.NotMatches); err != nil {
+			return fmt.Errorf("rule '%s': invalid notMatches: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate применяет все правила к ресурсу
+func (p *Policy) Evaluate(res manifest.Resource) []Violation {
+	var violations []Violation
+	for _, rule := range p.Rules {
+		if !rule.Match.matches(res) {
+			continue
+		}
+		for _, v := range rule.Assert.evaluate(res.Object) {
+			v.Rule = rule.Name
+			v.Severity = rule.Severity
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+func (m Match) matches(res manifest.Resource) bool {
+	return matchesAny(m.Kinds, res.Kind) && matchesAny(m.APIVersions, res.APIVersion)
+}
+
+func matchesAny(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Condition) evaluate(object map[string]interface{}) []Violation {
+	segments, _ := parsePath(c.Path)
+	var violations []Violation
+	for _, found := range lookup(object, segments, "") {
+		if msg := c.check(found); msg != "" {
+			violations = append(violations, Violation{Path: found.path, Message: msg})
+		}
+	}
+	return violations
+}
+
+func (c *Condition) check(found value) string {
+	if c.Exists != nil {
+		if *c.Exists && !found.present {
+			return "field is missing"
+		}
+		if !*c.Exists && found.present {
+			return "field must not be set"
+		}
+	}
+	if !found.present {
+		// Сравнения с отсутствующим значением выполняются только для equals и matches
+		if c.Equals != nil || c.matches != nil {
+			return "field is missing"
+		}
+		return ""
+	}
+
+	str := scalarString(found.value)
+	if c.Equals != nil && str != *c.Equals {
+		return fmt.Sprintf("value '%s' must equal '%s'", str, *c.Equals)
+	}
+	if c.NotEquals != nil && str == *c.NotEquals {
+		return fmt.Sprintf("value must not equal '%s'", *c.NotEquals)
+	}
+	if c.matches != nil && !c.matches.MatchString(str) {
+		return fmt.Sprintf("value '%s' must match '%s'", str, c.Matches)
+	}
+	if c.notMatches != nil && c.notMatches.MatchString(str) {
+		return fmt.Sprintf("value '%s' must not match '%s'", str, c.NotMatches)
+	}
+	return ""
+}
+
+func scalarString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case map[string]interface{}, []interface{}:
+		data, _ := yaml.Marshal(v)
+		return strings.TrimSpace(string(data))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// segment - часть пути: имя поля, индекс элемента или [*] для всех элементов
+type segment struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func parsePath(path string) ([]segment, error) {
+	var segments []segment
+	for _, part := range strings.Split(path, ".") {
+		name, rest, _ := strings.Cut(part, "[")
+		if name == "" && rest == "" {
+			return nil, fmt.Errorf("invalid path '%s': empty segment", path)
+		}
+		if name != "" {
+			segments = append(segments, segment{field: name})
+		}
+		for rest != "" {
+			idx, tail, found := strings.Cut(rest, "]")
+			if !found {
+				return nil, fmt.Errorf("invalid path '%s': missing ']'", path)
+			}
+			if idx == "*" {
+				segments = append(segments, segment{wildcard: true})
+			} else {
+				n, err := strconv.Atoi(idx)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid path '%s': bad index '%s'", path, idx)
+				}
+				segments = append(segments, segment{index: n, isIndex: true})
+			}
+			rest = strings.TrimPrefix(tail, "[")
+			if tail != "" && !strings.HasPrefix(tail, "[") {
+				return nil, fmt.Errorf("invalid path '%s': unexpected '%s'", path, tail)
+			}
+		}
+	}
+	return segments, nil
+}
+
+// value - значение, найденное по пути, или место, где путь оборвался
+type value struct {
+	path    string
+	value   interface{}
+	present bool
+}
+
+// lookup раскрывает путь по объекту; [*] по пустому массиву не дает значений
+func lookup(current interface{}, segments []segment, path string) []value {
+	if len(segments) == 0 {
+		return []value{{path: path, value: current, present: true}}
+	}
+	seg := segments[0]
+	switch {
+	case seg.wildcard:
+		items, ok := current.([]interface{})
+		if !ok {
+			return nil
+		}
+		var found []value
+		for i, item := range items {
+			found = append(found, lookup(item, segments[1:], fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return found
+	case seg.isIndex:
+		items, ok := current.([]interface{})
+		itemPath := fmt.Sprintf("%s[%d]", path, seg.index)
+		if !ok || seg.index < 0 || seg.index >= len(items) {
+			return []value{{path: itemPath}}
+		}
+		return lookup(items[seg.index], segments[1:], itemPath)
+	default:
+		fieldPath := seg.field
+		if path != "" {
+			fieldPath = path + "." + seg.field
+		}
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return []value{{path: fieldPath}}
+		}
+		next, ok := object[seg.field]
+		if !ok || next == nil {
+			return []value{{path: fieldPath}}
+		}
+		return lookup(next, segments[1:], fieldPath)
+	}
+}
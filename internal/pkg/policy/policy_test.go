@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"roar/internal/pkg/manifest"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `rules:
+  - name: resource-limits
+    severity: error
+    match:
+      kinds: [Deployment, StatefulSet]
+    assert:
+      path: spec.template.spec.containers[*].resources.limits
+      exists: true
+  - name: no-latest-tag
+    severity: warning
+    match:
+      kinds: [Deployment]
+    assert:
+      path: spec.template.spec.containers[*].image
+      notMatches: ":latest$"
+  - name: first-container-named-app
+    severity: info
+    match:
+      apiVersions: [apps/v1]
+    assert:
+      path: spec.template.spec.containers[0].name
+      equals: app
+`
+
+func loadTestPolicy(t *testing.T, content string) (*Policy, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return Load(path)
+}
+
+func TestPolicy_Evaluate(t *testing.T) {
+	p, err := loadTestPolicy(t, testPolicy)
+	require.NoError(t, err)
+
+	resources, err := manifest.Parse([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: nginx:1.25
+          resources: {limits: {cpu: 100m}}
+        - name: sidecar
+          image: envoy:latest
+---
+apiVersion: v1
+kind: Service
+metadata: {name: web}
+`))
+	require.NoError(t, err)
+
+	require.Equal(t, []Violation{
+		{Rule: "resource-limits", Severity: SeverityError, Path: "spec.template.spec.containers[1].resources", Message: "field is missing"},
+		{Rule: "no-latest-tag", Severity: SeverityWarning, Path: "spec.template.spec.containers[1].image", Message: "value 'envoy:latest' must not match ':latest$'"},
+	}, p.Evaluate(resources[0]))
+	require.Empty(t, p.Evaluate(resources[1]))
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "no name", content: "rules:\n  - assert: {path: a, exists: true}\n", err: "rule without a name"},
+		{name: "bad severity", content: "rules:\n  - name: r\n    severity: fatal\n    assert: {path: a, exists: true}\n", err: "unsupported severity 'fatal'"},
+		{name: "no operator", content: "rules:\n  - name: r\n    assert: {path: a}\n", err: "assert has no operator"},
+		{name: "bad path", content: "rules:\n  - name: r\n    assert: {path: \"a[x]\", exists: true}\n", err: "bad index 'x'"},
+		{name: "negative index", content: "rules:\n  - name: r\n    assert: {path: \"spec.containers[-1].image\", exists: true}\n", err: "bad index '-1'"},
+		{name: "bad regexp", content: "rules:\n  - name: r\n    assert: {path: a, matches: \"(\"}\n", err: "invalid matches"},
+		{name: "duplicate", content: "rules:\n  - name: r\n    assert: {path: a, exists: true}\n  - name: r\n    assert: {path: b, exists: true}\n", err: "rule 'r' is already defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadTestPolicy(t, tt.content)
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
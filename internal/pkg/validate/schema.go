@@ -0,0 +1,281 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema - подмножество JSON Schema / OpenAPI v3, которого достаточно для
+// схем Kubernetes (kubernetes-json-schema) и openAPIV3Schema из CRD
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 schemaType         `json:"type"`
+	Format               string             `json:"format"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *additional        `json:"additionalProperties"`
+	Required             []string           `json:"required"`
+	Items                *Schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	OneOf                []*Schema          `json:"oneOf"`
+	AnyOf                []*Schema          `json:"anyOf"`
+	AllOf                []*Schema          `json:"allOf"`
+	Definitions          map[string]*Schema `json:"definitions"`
+
+	PreserveUnknownFields bool `json:"x-kubernetes-preserve-unknown-fields"`
+	IntOrString           bool `json:"x-kubernetes-int-or-string"`
+}
+
+// schemaType - поле type, которое может быть строкой или списком строк
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaType{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings: %w", err)
+	}
+	*t = list
+	return nil
+}
+
+// additional - additionalProperties: true/false или схема значений
+type additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *additional) UnmarshalJSON(data []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		a.Allowed = allowed
+		return nil
+	}
+	a.Allowed = true
+	a.Schema = &Schema{}
+	return json.Unmarshal(data, a.Schema)
+}
+
+// refResolver находит схему по значению $ref и возвращает резолвер для ссылок
+// внутри документа, в котором она найдена
+type refResolver func(ref string) (*Schema, refResolver, error)
+
+// checker обходит объект и копит нарушения схемы
+type checker struct {
+	resolve refResolver
+	errors  *[]string
+}
+
+func newChecker(resolve refResolver) *checker {
+	return &checker{resolve: resolve, errors: &[]string{}}
+}
+
+func (c *checker) fail(path, format string, args ...interface{}) {
+	if path == "" {
+		path = "(root)"
+	}
+	*c.errors = append(*c.errors, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+func (c *checker) check(schema *Schema, value interface{}, path string) {
+	if schema == nil {
+		return
+	}
+	if schema.Ref != "" {
+		resolved, resolver, err := c.resolve(schema.Ref)
+		if err != nil {
+			c.fail(path, "%v", err)
+			return
+		}
+		(&checker{resolve: resolver, errors: c.errors}).check(resolved, value, path)
+		return
+	}
+
+	// null в манифесте API-сервер трактует как отсутствие значения
+	if value == nil {
+		return
+	}
+
+	for _, sub := range schema.AllOf {
+		c.check(sub, value, path)
+	}
+	// oneOf проверяется как anyOf: в схемах Kubernetes варианты часто пересекаются
+	for _, variants := range [][]*Schema{schema.AnyOf, schema.OneOf} {
+		if len(variants) > 0 && !c.matchesAny(variants, value, path) {
+			c.fail(path, "does not match any of the allowed schemas")
+		}
+	}
+
+	if schema.IntOrString {
+		if !isInteger(value) && !isString(value) {
+			c.fail(path, "expected integer or string, got %s", typeName(value))
+		}
+		return
+	}
+	if len(schema.Type) > 0 && !matchesType(schema.Type, value) {
+		c.fail(path, "expected %s, got %s", strings.Join(schema.Type, " or "), typeName(value))
+		return
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		c.fail(path, "value %v is not one of %v", value, schema.Enum)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c.checkObject(schema, v, path)
+	case []interface{}:
+		for i, item := range v {
+			c.check(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+func (c *checker) checkObject(schema *Schema, object map[string]interface{}, path string) {
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			c.fail(path, "missing required field '%s'", name)
+		}
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fieldPath := joinPath(path, key)
+		if prop, ok := schema.Properties[key]; ok {
+			c.check(prop, object[key], fieldPath)
+			continue
+		}
+		switch {
+		case schema.AdditionalProperties != nil && schema.AdditionalProperties.Schema != nil:
+			c.check(schema.AdditionalProperties.Schema, object[key], fieldPath)
+		case schema.AdditionalProperties != nil && schema.AdditionalProperties.Allowed:
+		case schema.PreserveUnknownFields:
+		case schema.AdditionalProperties != nil || len(schema.Properties) > 0:
+			// Как и API-сервер в режиме strict, считаем ошибкой поля, которых нет в схеме
+			c.fail(fieldPath, "unknown field")
+		}
+	}
+}
+
+// matchesAny проверяет значение на соответствие хотя бы одной из схем
+func (c *checker) matchesAny(variants []*Schema, value interface{}, path string) bool {
+	for _, variant := range variants {
+		sub := newChecker(c.resolve)
+		sub.check(variant, value, path)
+		if len(*sub.errors) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func matchesType(types schemaType, value interface{}) bool {
+	for _, t := range types {
+		switch t {
+		case "object":
+			if _, ok := value.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := value.([]interface{}); ok {
+				return true
+			}
+		case "string":
+			if isString(value) {
+				return true
+			}
+		case "integer":
+			if isInteger(value) {
+				return true
+			}
+		case "number":
+			if isNumber(value) {
+				return true
+			}
+		case "boolean":
+			if _, ok := value.(bool); ok {
+				return true
+			}
+		case "null":
+			if value == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isString(value interface{}) bool {
+	switch value.(type) {
+	case string, time.Time:
+		return true
+	}
+	return false
+}
+
+func isNumber(value interface{}) bool {
+	switch value.(type) {
+	case int, int64, uint64, float64:
+		return true
+	}
+	return false
+}
+
+func isInteger(value interface{}) bool {
+	switch v := value.(type) {
+	case int, int64, uint64:
+		return true
+	case float64:
+		return v == math.Trunc(v)
+	}
+	return false
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(allowed, value) || fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string, time.Time:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
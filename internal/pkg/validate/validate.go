@@ -0,0 +1,238 @@
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"roar/internal/pkg/manifest"
+)
+
+// DefaultKubeVersion - версия Kubernetes, схемы которой используются по умолчанию
+const DefaultKubeVersion = "master"
+
+// ErrSchemaNotFound возвращается, если для ресурса нет ни схемы в директории, ни CRD
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// Validator проверяет ресурсы по JSON-схемам Kubernetes из локальной директории
+// (раскладка kubernetes-json-schema / kubeconform) и по схемам CRD из манифестов
+type Validator struct {
+	schemaDir   string
+	kubeVersion string
+	crds        map[string]*Schema
+	docs        map[string]*Schema
+}
+
+// New создает валидатор. kubeVersion - "master" или версия вида "1.29.0".
+func New(schemaDir, kubeVersion string) (*Validator, error) {
+	info, err := os.Stat(schemaDir)
+	if err != nil {
+		return nil, fmt.Errorf("schema directory is not accessible: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("schema path %s is not a directory", schemaDir)
+	}
+	if kubeVersion == "" {
+		kubeVersion = DefaultKubeVersion
+	}
+	if kubeVersion != DefaultKubeVersion && !strings.HasPrefix(kubeVersion, "v") {
+		kubeVersion = "v" + kubeVersion
+	}
+	return &Validator{
+		schemaDir:   schemaDir,
+		kubeVersion: kubeVersion,
+		crds:        make(map[string]*Schema),
+		docs:        make(map[string]*Schema),
+	}, nil
+}
+
+// AddCRDs извлекает openAPIV3Schema из CustomResourceDefinition среди ресурсов,
+// чтобы проверять по ним custom resources
+func (v *Validator) AddCRDs(resources []manifest.Resource) error {
+	for _, res := range resources {
+		if res.Kind != "CustomResourceDefinition" || res.Group() != "apiextensions.k8s.io" {
+			continue
+		}
+		if err := v.addCRD(res); err != nil {
+			return fmt.Errorf("CRD %s: %w", res.Name, err)
+		}
+	}
+	return nil
+}
+
+func (v *Validator) addCRD(res manifest.Resource) error {
+	var crd struct {
+		Spec struct {
+			Group string `json:"group"`
+			Names struct {
+				Kind string `json:"kind"`
+			} `json:"names"`
+			Version    string `json:"version"`
+			Validation *struct {
+				OpenAPIV3Schema *Schema `json:"openAPIV3Schema"`
+			} `json:"validation"`
+			Versions []struct {
+				Name   string `json:"name"`
+				Schema *struct {
+					OpenAPIV3Schema *Schema `json:"openAPIV3Schema"`
+				} `json:"schema"`
+			} `json:"versions"`
+		} `json:"spec"`
+	}
+	data, err := json.Marshal(res.Object)
+	if err != nil {
+		return fmt.Errorf("failed to encode: %w", err)
+	}
+	if err := json.Unmarshal(data, &crd); err != nil {
+		return fmt.Errorf("failed to decode schema: %w", err)
+	}
+
+	spec := crd.Spec
+	// apiextensions.k8s.io/v1beta1: общая схема для всех версий
+	var shared *Schema
+	if spec.Validation != nil {
+		shared = spec.Validation.OpenAPIV3Schema
+	}
+	if spec.Version != "" && shared != nil {
+		v.crds[gvkKey(spec.Group, spec.Version, spec.Names.Kind)] = withObjectMeta(shared)
+	}
+	for _, version := range spec.Versions {
+		schema := shared
+		if version.Schema != nil && version.Schema.OpenAPIV3Schema != nil {
+			schema = version.Schema.OpenAPIV3Schema
+		}
+		if schema != nil {
+			v.crds[gvkKey(spec.Group, version.Name, spec.Names.Kind)] = withObjectMeta(schema)
+		}
+	}
+	return nil
+}
+
+// withObjectMeta добавляет в схему CRD поля, которые API-сервер допускает всегда
+func withObjectMeta(schema *Schema) *Schema {
+	if len(schema.Properties) == 0 {
+		return schema
+	}
+	for _, field := range []string{"apiVersion", "kind"} {
+		if _, ok := schema.Properties[field]; !ok {
+			schema.Properties[field] = &Schema{Type: schemaType{"string"}}
+		}
+	}
+	if _, ok := schema.Properties["metadata"]; !ok {
+		schema.Properties["metadata"] = &Schema{Type: schemaType{"object"}, PreserveUnknownFields: true}
+	}
+	return schema
+}
+
+func gvkKey(group, version, kind string) string {
+	return fmt.Sprintf("%s/%s/%s", group, version, kind)
+}
+
+// Validate проверяет ресурс и возвращает найденные нарушения схемы.
+// Если схема не найдена, возвращается ошибка ErrSchemaNotFound.
+func (v *Validator) Validate(res manifest.Resource) ([]string, error) {
+	if res.APIVersion == "" || res.Kind == "" {
+		return []string{"(root): missing apiVersion or kind"}, nil
+	}
+
+	schema, resolver, err := v.schemaFor(res)
+	if err != nil {
+		return nil, err
+	}
+	c := newChecker(resolver)
+	c.check(schema, res.Object, "")
+	return *c.errors, nil
+}
+
+func (v *Validator) schemaFor(res manifest.Resource) (*Schema, refResolver, error) {
+	if schema, ok := v.crds[gvkKey(res.Group(), res.Version(), res.Kind)]; ok {
+		return schema, noRefs, nil
+	}
+
+	for _, path := range v.candidates(res) {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		schema, err := v.loadDoc(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return schema, v.resolverFor(path), nil
+	}
+	return nil, nil, fmt.Errorf("%w for %s %s (kubernetes %s)", ErrSchemaNotFound, res.APIVersion, res.Kind, v.kubeVersion)
+}
+
+// candidates возвращает возможные пути схемы ресурса в порядке приоритета
+func (v *Validator) candidates(res manifest.Resource) []string {
+	kind := strings.ToLower(res.Kind)
+	group, version := res.Group(), res.Version()
+
+	fileName := fmt.Sprintf("%s-%s.json", kind, version)
+	if group != "" {
+		groupPrefix, _, _ := strings.Cut(group, ".")
+		fileName = fmt.Sprintf("%s-%s-%s.json", kind, groupPrefix, version)
+	}
+
+	var paths []string
+	for _, suffix := range []string{"-standalone-strict", "-standalone", ""} {
+		paths = append(paths, filepath.Join(v.schemaDir, v.kubeVersion+suffix, fileName))
+	}
+	paths = append(paths, filepath.Join(v.schemaDir, fileName))
+	if group != "" {
+		// Раскладка каталога схем CRD: <group>/<kind>_<version>.json
+		paths = append(paths, filepath.Join(v.schemaDir, group, fmt.Sprintf("%s_%s.json", kind, version)))
+	}
+	return paths
+}
+
+func (v *Validator) loadDoc(path string) (*Schema, error) {
+	if schema, ok := v.docs[path]; ok {
+		return schema, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema %s: %w", path, err)
+	}
+	v.docs[path] = &schema
+	return &schema, nil
+}
+
+// resolverFor разрешает ссылки вида "#/definitions/<name>" и
+// "<file>#/definitions/<name>" относительно документа path
+func (v *Validator) resolverFor(path string) refResolver {
+	return func(ref string) (*Schema, refResolver, error) {
+		file, pointer, _ := strings.Cut(ref, "#")
+		docPath := path
+		if file != "" {
+			docPath = filepath.Join(filepath.Dir(path), file)
+		}
+		doc, err := v.loadDoc(docPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve $ref %s: %w", ref, err)
+		}
+
+		if pointer == "" || pointer == "/" {
+			return doc, v.resolverFor(docPath), nil
+		}
+		name, ok := strings.CutPrefix(pointer, "/definitions/")
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported $ref %s", ref)
+		}
+		schema, ok := doc.Definitions[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("$ref %s not found", ref)
+		}
+		return schema, v.resolverFor(docPath), nil
+	}
+}
+
+func noRefs(ref string) (*Schema, refResolver, error) {
+	return nil, nil, fmt.Errorf("unsupported $ref %s in CRD schema", ref)
+}
@@ -0,0 +1,204 @@
+package validate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"roar/internal/pkg/manifest"
+
+	"github.com/stretchr/testify/require"
+)
+
+const deploymentSchema = `{
+  "type": "object",
+  "required": ["apiVersion", "kind", "metadata"],
+  "properties": {
+    "apiVersion": {"type": "string", "enum": ["apps/v1"]},
+    "kind": {"type": "string", "enum": ["Deployment"]},
+    "metadata": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+      }
+    },
+    "spec": {
+      "type": "object",
+      "properties": {
+        "replicas": {"type": "integer"},
+        "template": {
+          "type": "object",
+          "properties": {
+            "spec": {
+              "type": "object",
+              "required": ["containers"],
+              "properties": {
+                "containers": {
+                  "type": "array",
+                  "items": {
+                    "type": "object",
+                    "properties": {
+                      "name": {"type": "string"},
+                      "ports": {"type": "array", "items": {"type": "object", "properties": {"containerPort": {"oneOf": [{"type": "string"}, {"type": "integer"}]}}}}
+                    },
+                    "additionalProperties": false
+                  }
+                }
+              },
+              "additionalProperties": false
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+func writeSchema(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func parseOne(t *testing.T, doc string) manifest.Resource {
+	t.Helper()
+	resources, err := manifest.Parse([]byte(doc))
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	return resources[0]
+}
+
+func TestValidator_Validate(t *testing.T) {
+	dir := t.TempDir()
+	writeSchema(t, filepath.Join(dir, "v1.29.0-standalone-strict", "deployment-apps-v1.json"), deploymentSchema)
+
+	v, err := New(dir, "1.29.0")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		doc    string
+		errors []string
+	}{
+		{
+			name: "valid",
+			doc: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels: {app: web}
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+        - name: web
+          ports: [{containerPort: 8080}]
+`,
+		},
+		{
+			name: "typo and wrong type",
+			doc: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: "2"
+  template:
+    spec:
+      contianers:
+        - name: web
+`,
+			errors: []string{
+				"spec.replicas: expected integer, got string",
+				"spec.template.spec: missing required field 'containers'",
+				"spec.template.spec.contianers: unknown field",
+			},
+		},
+		{
+			name: "nested array item",
+			doc: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          imagee: nginx
+          ports: [{containerPort: true}]
+`,
+			errors: []string{
+				"spec.template.spec.containers[0].imagee: unknown field",
+				"spec.template.spec.containers[0].ports[0].containerPort: does not match any of the allowed schemas",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, err := v.Validate(parseOne(t, tt.doc))
+			require.NoError(t, err)
+			require.ElementsMatch(t, tt.errors, errs)
+		})
+	}
+}
+
+func TestValidator_Refs(t *testing.T) {
+	dir := t.TempDir()
+	writeSchema(t, filepath.Join(dir, "master", "service-v1.json"), `{"$ref": "_definitions.json#/definitions/io.k8s.api.core.v1.Service"}`)
+	writeSchema(t, filepath.Join(dir, "master", "_definitions.json"), `{"definitions": {
+  "io.k8s.api.core.v1.Service": {"type": "object", "properties": {"apiVersion": {"type": "string"}, "kind": {"type": "string"}, "metadata": {"type": "object"}, "spec": {"$ref": "#/definitions/io.k8s.api.core.v1.ServiceSpec"}}},
+  "io.k8s.api.core.v1.ServiceSpec": {"type": "object", "properties": {"type": {"type": "string", "enum": ["ClusterIP", "NodePort", "LoadBalancer"]}}}
+}}`)
+
+	v, err := New(dir, "")
+	require.NoError(t, err)
+
+	errs, err := v.Validate(parseOne(t, "apiVersion: v1\nkind: Service\nmetadata: {name: web}\nspec: {type: Ingress}\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"spec.type: value Ingress is not one of [ClusterIP NodePort LoadBalancer]"}, errs)
+
+	_, err = v.Validate(parseOne(t, "apiVersion: v1\nkind: ConfigMap\nmetadata: {name: web}\n"))
+	require.True(t, errors.Is(err, ErrSchemaNotFound))
+}
+
+func TestValidator_CRD(t *testing.T) {
+	v, err := New(t.TempDir(), "1.29")
+	require.NoError(t, err)
+
+	crds, err := manifest.Parse([]byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: backups.example.com
+spec:
+  group: example.com
+  names: {kind: Backup}
+  versions:
+    - name: v1
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              properties:
+                schedule: {type: string}
+                extra: {type: object, x-kubernetes-preserve-unknown-fields: true}
+`))
+	require.NoError(t, err)
+	require.NoError(t, v.AddCRDs(crds))
+
+	errs, err := v.Validate(parseOne(t, `apiVersion: example.com/v1
+kind: Backup
+metadata: {name: nightly}
+spec:
+  schedule: "0 1 * * *"
+  extra: {anything: goes}
+  retention: 7
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"spec.retention: unknown field"}, errs)
+}
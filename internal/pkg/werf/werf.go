@@ -0,0 +1,375 @@
+package werf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultHelmChartDir - директория чарта, которую werf использует по умолчанию
+	DefaultHelmChartDir = ".helm"
+
+	templatesDir     = ".werf"
+	giterminismFile  = "werf-giterminism.yaml"
+	releaseNameLimit = 53
+	namespaceLimit   = 63
+)
+
+var configFileNames = []string{"werf.yaml", "werf.yml"}
+
+// Config - та часть werf.yaml, которая влияет на рендеринг чарта
+type Config struct {
+	Project string `yaml:"project"`
+	Deploy  Deploy `yaml:"deploy"`
+}
+
+// Deploy описывает секцию deploy из meta-документа werf.yaml
+type Deploy struct {
+	HelmChartDir      string `yaml:"helmChartDir"`
+	HelmRelease       string `yaml:"helmRelease"`
+	HelmReleaseSlug   *bool  `yaml:"helmReleaseSlug"`
+	HelmNamespace     string `yaml:"helmNamespace"`
+	HelmNamespaceSlug *bool  `yaml:"helmNamespaceSlug"`
+}
+
+// Giterminism - разрешения из werf-giterminism.yaml, относящиеся к рендерингу werf.yaml
+type Giterminism struct {
+	Config struct {
+		GoTemplateRendering struct {
+			AllowEnvVariables []string `yaml:"allowEnvVariables"`
+		} `yaml:"goTemplateRendering"`
+	} `yaml:"config"`
+}
+
+// LoadOptions - ограничения при рендеринге werf.yaml
+type LoadOptions struct {
+	// DisableEnv запрещает функцию env для любых переменных, даже разрешенных
+	// в werf-giterminism.yaml: так werf.yaml из недоверенного репозитория не
+	// может прочитать окружение процесса
+	DisableEnv bool
+}
+
+// InputPaths возвращает файлы и директории проекта (относительно его директории),
+// от которых зависит результат Load
+func InputPaths() []string {
+	return append(slices.Clone(configFileNames), giterminismFile, templatesDir)
+}
+
+// Load ищет werf.yaml в директории проекта, рендерит его как Go-шаблон
+// и возвращает meta-секцию. Если werf.yaml отсутствует, возвращает nil без ошибки.
+func Load(projectDir, env string, opts LoadOptions) (*Config, error) {
+	configPath, err := findConfig(projectDir)
+	if err != nil || configPath == "" {
+		return nil, err
+	}
+
+	giterminism, err := loadGiterminism(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := renderConfig(configPath, projectDir, env, giterminism, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := parseMeta(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", configPath, err)
+	}
+	if dir := cfg.Deploy.HelmChartDir; dir != "" && !filepath.IsLocal(filepath.Clean(dir)) {
+		return nil, fmt.Errorf("%s: deploy.helmChartDir '%s' must be inside the project directory", configPath, dir)
+	}
+	return cfg, nil
+}
+
+// ChartDir возвращает путь к чарту относительно директории проекта.
+// Load гарантирует, что путь не выходит за пределы директории проекта
+func (c *Config) ChartDir() string {
+	if c == nil || c.Deploy.HelmChartDir == "" {
+		return DefaultHelmChartDir
+	}
+	return filepath.Clean(c.Deploy.HelmChartDir)
+}
+
+// Release возвращает имя релиза из deploy.helmRelease.
+// Второе значение false, если шаблон релиза в werf.yaml не задан.
+func (c *Config) Release(env string) (string, bool) {
+	if c == nil || c.Deploy.HelmRelease == "" {
+		return "", false
+	}
+	vars := map[string]string{"project": c.Project, "env": env}
+	if namespace, ok := c.Namespace(env); ok {
+		vars["namespace"] = namespace
+	}
+	release := expand(c.Deploy.HelmRelease, vars)
+	if c.Deploy.HelmReleaseSlug == nil || *c.Deploy.HelmReleaseSlug {
+		release = slug(release, releaseNameLimit)
+	}
+	return release, true
+}
+
+// Namespace возвращает namespace из deploy.helmNamespace.
+// Второе значение false, если шаблон namespace в werf.yaml не задан.
+func (c *Config) Namespace(env string) (string, bool) {
+	if c == nil || c.Deploy.HelmNamespace == "" {
+		return "", false
+	}
+	namespace := expand(c.Deploy.HelmNamespace, map[string]string{"project": c.Project, "env": env})
+	if c.Deploy.HelmNamespaceSlug == nil || *c.Deploy.HelmNamespaceSlug {
+		namespace = slug(namespace, namespaceLimit)
+	}
+	return namespace, true
+}
+
+var werfVariable = regexp.MustCompile(`\[\[\s*(\w+)\s*\]\]`)
+
+// expand подставляет werf-переменные вида [[ project ]] и [[ env ]]
+func expand(s string, vars map[string]string) string {
+	return werfVariable.ReplaceAllStringFunc(s, func(match string) string {
+		name := werfVariable.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+func findConfig(projectDir string) (string, error) {
+	for _, name := range configFileNames {
+		path := filepath.Join(projectDir, name)
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+	}
+	return "", nil
+}
+
+func loadGiterminism(projectDir string) (*Giterminism, error) {
+	path := filepath.Join(projectDir, giterminismFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var g Giterminism
+	if err := yaml.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &g, nil
+}
+
+// AllowsEnv проверяет, разрешено ли использование переменной окружения в werf.yaml.
+// Элементы вида /regexp/ трактуются как регулярные выражения, как это делает werf.
+// Без werf-giterminism.yaml (g == nil) запрещены все переменные.
+func (g *Giterminism) AllowsEnv(name string) bool {
+	if g == nil {
+		return false
+	}
+	for _, allowed := range g.Config.GoTemplateRendering.AllowEnvVariables {
+		if len(allowed) > 1 && strings.HasPrefix(allowed, "/") && strings.HasSuffix(allowed, "/") {
+			re, err := regexp.Compile("^" + allowed[1:len(allowed)-1] + "$")
+			if err == nil && re.MatchString(name) {
+				return true
+			}
+			continue
+		}
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// templateData - контекст, доступный в werf.yaml как "."
+type templateData struct {
+	Env   string
+	Files files
+}
+
+type files struct {
+	dir string
+}
+
+// Get возвращает содержимое файла проекта, аналогично .Files.Get в werf.
+// Абсолютные пути, пути с выходом через ".." и символические ссылки за
+// пределы директории проекта запрещены
+func (f files) Get(path string) (string, error) {
+	if !filepath.IsLocal(filepath.Clean(path)) {
+		return "", fmt.Errorf("file %q is outside the project directory", path)
+	}
+	root, err := os.OpenRoot(f.dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open project directory: %w", err)
+	}
+	defer root.Close()
+	file, err := root.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("file %q not found in project directory: %w", path, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %q: %w", path, err)
+	}
+	return string(data), nil
+}
+
+func renderConfig(configPath, projectDir, env string, giterminism *Giterminism, opts LoadOptions) ([]byte, error) {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", configPath, err)
+	}
+
+	tmpl := template.New(filepath.Base(configPath))
+	tmpl.Funcs(templateFuncs(tmpl, giterminism, opts))
+
+	if _, err := tmpl.Parse(string(content)); err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", configPath, err)
+	}
+	if err := parsePartials(tmpl, filepath.Join(projectDir, templatesDir)); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	data := templateData{Env: env, Files: files{dir: projectDir}}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", configPath, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// parsePartials подключает шаблоны из .werf/**/*.tmpl под именами относительно .werf
+func parsePartials(tmpl *template.Template, dir string) error {
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".tmpl" {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if _, err := tmpl.New(filepath.ToSlash(name)).Parse(string(content)); err != nil {
+			return fmt.Errorf("failed to parse template %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+func templateFuncs(tmpl *template.Template, giterminism *Giterminism, opts LoadOptions) template.FuncMap {
+	return template.FuncMap{
+		"env": func(name string, defaultValue ...string) (string, error) {
+			if opts.DisableEnv {
+				return "", fmt.Errorf("env variable %q is not allowed: env is disabled for this repository", name)
+			}
+			if !giterminism.AllowsEnv(name) {
+				return "", fmt.Errorf("env variable %q is not allowed: list it in config.goTemplateRendering.allowEnvVariables of %s", name, giterminismFile)
+			}
+			if value, ok := os.LookupEnv(name); ok {
+				return value, nil
+			}
+			if len(defaultValue) > 0 {
+				return defaultValue[0], nil
+			}
+			return "", nil
+		},
+		"include": func(name string, data interface{}) (string, error) {
+			var buf bytes.Buffer
+			if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+				return "", err
+			}
+			return buf.String(), nil
+		},
+		"required": func(msg string, value interface{}) (interface{}, error) {
+			if value == nil || value == "" {
+				return nil, errors.New(msg)
+			}
+			return value, nil
+		},
+		"default": func(defaultValue interface{}, value ...interface{}) interface{} {
+			if len(value) == 0 || value[0] == nil || value[0] == "" {
+				return defaultValue
+			}
+			return value[0]
+		},
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"quote":      func(s string) string { return fmt.Sprintf("%q", s) },
+		"squote":     func(s string) string { return "'" + s + "'" },
+	}
+}
+
+// parseMeta находит в многодокументном werf.yaml meta-секцию (документ с ключом project)
+func parseMeta(data []byte) (*Config, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc map[string]interface{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := doc["project"]; !ok {
+			continue
+		}
+
+		raw, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		var cfg Config
+		if err := yaml.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+		return &cfg, nil
+	}
+	return nil, errors.New("meta section with 'project' not found")
+}
+
+var slugInvalidChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// slug приводит строку к DNS-совместимому виду, как это делает werf для релизов и namespace
+func slug(s string, limit int) string {
+	s = strings.ToLower(s)
+	s = slugInvalidChars.ReplaceAllString(s, "-")
+	s = strings.Trim(s, "-")
+	if len(s) > limit {
+		s = strings.TrimRight(s[:limit], "-")
+	}
+	return s
+}
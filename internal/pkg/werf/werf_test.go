@@ -0,0 +1,199 @@
+package werf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestLoad_NoConfig(t *testing.T) {
+	cfg, err := Load(t.TempDir(), "dev", LoadOptions{})
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+	require.Equal(t, ".helm", cfg.ChartDir())
+
+	_, ok := cfg.Release("dev")
+	require.False(t, ok)
+}
+
+func TestLoad_DeploySection(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "werf.yaml", `
+project: my-service
+configVersion: 1
+deploy:
+  helmChartDir: deploy/chart
+  helmRelease: "[[ project ]]-[[ env ]]"
+  helmNamespace: "[[ project ]]-{{ .Env }}"
+---
+image: backend
+dockerfile: Dockerfile
+`)
+
+	cfg, err := Load(dir, "Prod", LoadOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "my-service", cfg.Project)
+	require.Equal(t, filepath.Join("deploy", "chart"), cfg.ChartDir())
+
+	release, ok := cfg.Release("Prod")
+	require.True(t, ok)
+	require.Equal(t, "my-service-prod", release)
+
+	namespace, ok := cfg.Namespace("Prod")
+	require.True(t, ok)
+	require.Equal(t, "my-service-prod", namespace)
+}
+
+func TestLoad_SlugDisabled(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "werf.yaml", `
+project: svc
+configVersion: 1
+deploy:
+  helmRelease: "[[ project ]]_[[ env ]]"
+  helmReleaseSlug: false
+`)
+
+	cfg, err := Load(dir, "dev", LoadOptions{})
+	require.NoError(t, err)
+	release, ok := cfg.Release("dev")
+	require.True(t, ok)
+	require.Equal(t, "svc_dev", release)
+}
+
+func TestLoad_TemplateFunctions(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ROAR_TEST_PROJECT", "from-env")
+	writeFile(t, dir, ".werf/deploy.tmpl", `deploy:
+  helmChartDir: {{ .Files.Get "chart-dir.txt" | trim }}
+`)
+	writeFile(t, dir, "chart-dir.txt", "charts/main\n")
+	writeFile(t, dir, "werf-giterminism.yaml", "config:\n  goTemplateRendering:\n    allowEnvVariables: [ROAR_TEST_PROJECT]\n")
+	writeFile(t, dir, "werf.yaml", `
+project: {{ env "ROAR_TEST_PROJECT" }}
+configVersion: 1
+{{ include "deploy.tmpl" . }}
+`)
+
+	cfg, err := Load(dir, "dev", LoadOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "from-env", cfg.Project)
+	require.Equal(t, filepath.Join("charts", "main"), cfg.ChartDir())
+}
+
+func TestLoad_Giterminism(t *testing.T) {
+	t.Setenv("CI_COMMIT_REF", "main")
+	t.Setenv("SECRET_TOKEN", "x")
+
+	tests := []struct {
+		name        string
+		envVar      string
+		expectError bool
+	}{
+		{name: "allowed by exact name", envVar: "SECRET_TOKEN"},
+		{name: "allowed by regexp", envVar: "CI_COMMIT_REF"},
+		{name: "not allowed", envVar: "HOME", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "werf-giterminism.yaml", `
+giterminismConfigVersion: 1
+config:
+  goTemplateRendering:
+    allowEnvVariables:
+      - /CI_.*/
+      - SECRET_TOKEN
+`)
+			writeFile(t, dir, "werf.yaml", "project: p-{{ env \""+tt.envVar+"\" | lower }}\nconfigVersion: 1\n")
+
+			_, err := Load(dir, "dev", LoadOptions{})
+			if tt.expectError {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "not allowed")
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLoad_EnvWithoutGiterminism(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ROAR_TEST_PROJECT", "from-env")
+	writeFile(t, dir, "werf.yaml", "project: {{ env \"ROAR_TEST_PROJECT\" }}\nconfigVersion: 1\n")
+
+	// Без werf-giterminism.yaml переменные окружения недоступны
+	_, err := Load(dir, "dev", LoadOptions{})
+	require.ErrorContains(t, err, `env variable "ROAR_TEST_PROJECT" is not allowed`)
+}
+
+func TestLoad_DisableEnv(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ROAR_TEST_PROJECT", "from-env")
+	writeFile(t, dir, "werf-giterminism.yaml", "config:\n  goTemplateRendering:\n    allowEnvVariables: [ROAR_TEST_PROJECT]\n")
+	writeFile(t, dir, "werf.yaml", "project: {{ env \"ROAR_TEST_PROJECT\" }}\nconfigVersion: 1\n")
+
+	// DisableEnv сильнее разрешений из werf-giterminism.yaml
+	_, err := Load(dir, "dev", LoadOptions{DisableEnv: true})
+	require.ErrorContains(t, err, `env variable "ROAR_TEST_PROJECT" is not allowed: env is disabled for this repository`)
+
+	cfg, err := Load(dir, "dev", LoadOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "from-env", cfg.Project)
+}
+
+func TestLoad_FilesOutsideProject(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("token"), 0644))
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "parent directory", path: "../secret.txt"},
+		{name: "absolute path", path: secret},
+		{name: "symlink", path: "link.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.Symlink(secret, filepath.Join(dir, "link.txt")))
+			writeFile(t, dir, "werf.yaml", "project: p\nconfigVersion: 1\n# {{ .Files.Get \""+tt.path+"\" }}\n")
+
+			_, err := Load(dir, "dev", LoadOptions{})
+			require.Error(t, err)
+			require.NotContains(t, err.Error(), "token")
+		})
+	}
+}
+
+func TestLoad_ChartDirOutsideProject(t *testing.T) {
+	for _, chartDir := range []string{"../shared/.helm", "/etc", "charts/../../x"} {
+		t.Run(chartDir, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "werf.yaml", "project: p\nconfigVersion: 1\ndeploy:\n  helmChartDir: "+chartDir+"\n")
+
+			_, err := Load(dir, "dev", LoadOptions{})
+			require.ErrorContains(t, err, "must be inside the project directory")
+		})
+	}
+}
+
+func TestLoad_MissingMeta(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "werf.yaml", "image: backend\n")
+
+	_, err := Load(dir, "dev", LoadOptions{})
+	require.Error(t, err)
+}